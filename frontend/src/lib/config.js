@@ -0,0 +1,6 @@
+// Runtime config injected into index.html by the Go server. The dev server
+// does not inject it, so values fall back to VITE_ variables from .env files.
+const injected = window.__GLOG_CONFIG__ || {}
+
+export const apiBaseUrl = injected.apiBaseUrl ?? import.meta.env.VITE_API_BASE_URL ?? ''
+export const tenant = injected.tenant ?? import.meta.env.VITE_TENANT ?? ''
@@ -1,7 +1,26 @@
+import fs from 'node:fs'
+import path from 'node:path'
+import { fileURLToPath } from 'node:url'
 import { defineConfig } from 'vite'
 import { svelte } from '@sveltejs/vite-plugin-svelte'
 
+// The Go server embeds the build from here.
+const outDir = fileURLToPath(new URL('../server/web/dist', import.meta.url))
+
+// Vite empties outDir on every build; the placeholder lets the server build
+// before the frontend ever was.
+const keepPlaceholder = {
+  name: 'glog-keep-placeholder',
+  closeBundle() {
+    fs.writeFileSync(path.join(outDir, '.gitkeep'), '')
+  }
+}
+
 // https://vitejs.dev/config/
 export default defineConfig({
-  plugins: [svelte()]
+  plugins: [svelte(), keepPlaceholder],
+  build: {
+    outDir,
+    emptyOutDir: true
+  }
 })
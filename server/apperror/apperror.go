@@ -0,0 +1,120 @@
+package apperror
+
+import (
+	"errors"
+
+	"glog/validation"
+)
+
+// Kind classifies an error independently of the transport that reports it.
+// The HTTP layer maps each kind to a status code.
+type Kind string
+
+const (
+	KindNotFound             Kind = "not-found"
+	KindConflict             Kind = "conflict"
+	KindValidation           Kind = "validation"
+	KindUnauthorized         Kind = "unauthorized"
+	KindUnavailable          Kind = "unavailable"
+	KindTimeout              Kind = "timeout"
+	KindCanceled             Kind = "canceled"
+	KindBadRequest           Kind = "bad-request"
+	KindUnsupportedMediaType Kind = "unsupported-media-type"
+	KindPayloadTooLarge      Kind = "payload-too-large"
+	KindNotAcceptable        Kind = "not-acceptable"
+	KindMethodNotAllowed     Kind = "method-not-allowed"
+	KindTooManyRequests      Kind = "too-many-requests"
+	KindInternal             Kind = "internal"
+)
+
+// Error is a domain error with a stable machine-readable code and a human
+// readable detail. Err keeps the underlying cause for logging; it is never
+// shown to clients.
+type Error struct {
+	Kind   Kind
+	Code   string
+	Detail string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(kind Kind, code string, detail string) *Error {
+	return &Error{
+		Kind:   kind,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+func Wrap(kind Kind, code string, detail string, err error) *Error {
+	return &Error{
+		Kind:   kind,
+		Code:   code,
+		Detail: detail,
+		Err:    err,
+	}
+}
+
+func NotFound(code string, detail string) *Error {
+	return New(KindNotFound, code, detail)
+}
+
+func Conflict(code string, detail string) *Error {
+	return New(KindConflict, code, detail)
+}
+
+func Unauthorized(code string, detail string) *Error {
+	return New(KindUnauthorized, code, detail)
+}
+
+func BadRequest(code string, detail string) *Error {
+	return New(KindBadRequest, code, detail)
+}
+
+func Unavailable(code string, detail string, err error) *Error {
+	return Wrap(KindUnavailable, code, detail, err)
+}
+
+func Timeout(code string, detail string, err error) *Error {
+	return Wrap(KindTimeout, code, detail, err)
+}
+
+func Canceled(code string, detail string, err error) *Error {
+	return Wrap(KindCanceled, code, detail, err)
+}
+
+func Internal(err error) *Error {
+	return Wrap(KindInternal, "internal_error", "an unexpected error occurred", err)
+}
+
+// KindOf reports the kind of err. Validation errors are recognized as
+// KindValidation; anything that isn't a domain error is KindInternal.
+func KindOf(err error) Kind {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Kind
+	}
+
+	var validationErrs validation.Errors
+	if errors.As(err, &validationErrs) {
+		return KindValidation
+	}
+
+	return KindInternal
+}
+
+// Is reports whether err is a domain error of the given kind.
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
@@ -0,0 +1,51 @@
+// Package auth guards routes with the API keys of auth.api_keys.
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"glog/apperror"
+	"glog/responsehandler"
+)
+
+var errAPIKeyRequired = apperror.Unauthorized("api_key_required", "a valid API key is required")
+
+// RequireAPIKey rejects requests that do not send one of keys as
+// `Authorization: Bearer <key>`.
+func RequireAPIKey(keys []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !valid(keys, bearer(r)) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="glog"`)
+				responsehandler.EncodeError(w, r, errAPIKeyRequired)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// valid compares key with every key in constant time, so the time taken
+// does not tell how much of a key was guessed.
+func valid(keys []string, key string) bool {
+	ok := 0
+	for _, k := range keys {
+		ok |= subtle.ConstantTimeCompare([]byte(k), []byte(key))
+	}
+
+	return key != "" && ok == 1
+}
+
+func bearer(r *http.Request) string {
+	const prefix = "Bearer "
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return strings.TrimSpace(auth[len(prefix):])
+	}
+
+	return ""
+}
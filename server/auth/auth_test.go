@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	h := RequireAPIKey([]string{"0123456789abcdef", "fedcba9876543210"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for authorization, expected := range map[string]int{
+		"":                        http.StatusUnauthorized,
+		"Bearer":                  http.StatusUnauthorized,
+		"Bearer wrong":            http.StatusUnauthorized,
+		"Basic fedcba9876543210":  http.StatusUnauthorized,
+		"Bearer fedcba9876543210": http.StatusOK,
+		"bearer 0123456789abcdef": http.StatusOK,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/admin/tenants/acme/export", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != expected {
+			t.Errorf("Expected %d for %q, got %d", expected, authorization, w.Code)
+		}
+
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Expected a challenge for %q", authorization)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+// Package backup moves whole tenants in and out of glog as portable
+// archives.
+//
+// An archive is a zip holding:
+//
+//	manifest.json     format, version, tenant and export time
+//	posts/<id>.json   every field of a post but its content
+//	posts/<id>.md     the content, as written
+//
+// Posts are written to and read from the archive one at a time, so the size
+// of a tenant is bounded by disk, not memory.
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"glog/apperror"
+	"glog/logging"
+	"glog/post"
+)
+
+const (
+	// Format names the archive format in manifests.
+	Format = "glog-tenant-archive"
+	// Version is the version of the format Export writes. Import reads
+	// archives of this version and earlier ones.
+	Version = 1
+
+	manifestName = "manifest.json"
+)
+
+// Manifest describes an archive.
+type Manifest struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	Tenant     string    `json:"tenant"`
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+// Record is the JSON file of a post.
+type Record struct {
+	ID           string    `json:"id"`
+	Slug         string    `json:"slug"`
+	Title        string    `json:"title"`
+	Abstract     string    `json:"abstract"`
+	Tags         []string  `json:"tags,omitempty"`
+	AuthorID     string    `json:"authorId"`
+	LastEditedBy string    `json:"lastEditedBy,omitempty"`
+	IsPublished  bool      `json:"isPublished"`
+	Version      int       `json:"version"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	PublishedAt  time.Time `json:"publishedAt"`
+	// Content is the path of the post's Markdown file in the archive.
+	Content string `json:"content"`
+	// Media lists the images the content embeds. The archive holds the
+	// references only, not the files.
+	Media []string `json:"media,omitempty"`
+	// Revisions lists earlier versions of the post. glog does not keep
+	// any yet, so Export leaves it empty and Import ignores it.
+	Revisions []Revision `json:"revisions,omitempty"`
+}
+
+// Revision is an earlier version of a post.
+type Revision struct {
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Content is the path of the revision's Markdown file in the archive.
+	Content string `json:"content"`
+}
+
+// Source is where Export reads posts from; *post.Repository is one.
+type Source interface {
+	Each(ctx context.Context, tenantID string, fn func(*post.Post) error) error
+}
+
+// Target is where Import writes posts to; *post.Repository is one.
+type Target interface {
+	Import(ctx context.Context, tenantID string, p *post.Post, conflict post.Conflict) (post.ImportOutcome, error)
+}
+
+// fileName keeps IDs fit for a path as they are.
+var fileName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,100}$`)
+
+// Export writes every post of a tenant to w as an archive and returns how
+// many it wrote.
+func Export(ctx context.Context, w io.Writer, source Source, tenantID string) (int, error) {
+	zw := zip.NewWriter(w)
+
+	if err := writeJSON(zw, manifestName, Manifest{
+		Format:     Format,
+		Version:    Version,
+		Tenant:     tenantID,
+		ExportedAt: time.Now().UTC(),
+	}); err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	err := source.Each(ctx, tenantID, func(p *post.Post) error {
+		count++
+
+		name := p.ID
+		if !fileName.MatchString(name) {
+			// fileName does not match ~, so this cannot be a post's ID.
+			name = "post~" + strconv.Itoa(count)
+		}
+
+		record := Record{
+			ID:           p.ID,
+			Slug:         p.Slug,
+			Title:        p.Title,
+			Abstract:     p.Abstract,
+			Tags:         p.Tags,
+			AuthorID:     p.AuthorID,
+			LastEditedBy: p.LastEditedBy,
+			IsPublished:  p.IsPublished,
+			Version:      p.Version,
+			CreatedAt:    p.CreatedAt,
+			UpdatedAt:    p.UpdatedAt,
+			PublishedAt:  p.PublishedAt,
+			Content:      "posts/" + name + ".md",
+			Media:        post.MediaReferences(p.ContentRaw),
+		}
+
+		if err := writeJSON(zw, "posts/"+name+".json", record); err != nil {
+			return err
+		}
+
+		f, err := zw.Create(record.Content)
+		if err == nil {
+			_, err = io.WriteString(f, p.ContentRaw)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return count, err
+	}
+
+	return count, zw.Close()
+}
+
+// interrupted reports an import stopped by its context as the storage
+// does, so that it is answered 499 or 504 rather than 500.
+func interrupted(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return apperror.Timeout("import_timeout", "the import did not finish in time", err)
+	}
+
+	return apperror.Canceled("request_canceled", "the request was canceled", err)
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Report tells what Import did.
+type Report struct {
+	Tenant      string    `json:"tenant"`
+	Created     int       `json:"created"`
+	Overwritten int       `json:"overwritten"`
+	Renamed     int       `json:"renamed"`
+	Skipped     int       `json:"skipped"`
+	Renames     []Rename  `json:"renames,omitempty"`
+	Failures    []Failure `json:"failures,omitempty"`
+}
+
+// Rename is a post that Import stored under another ID or slug.
+type Rename struct {
+	FromID   string `json:"fromId"`
+	FromSlug string `json:"fromSlug"`
+	ID       string `json:"id"`
+	Slug     string `json:"slug"`
+}
+
+// Failure is a post of the archive that could not be imported.
+type Failure struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// maxFileSize bounds what is read from any file of an archive, so a
+// crafted archive cannot exhaust memory.
+const maxFileSize = 4*post.MaxContentLength + 64<<10
+
+// Import reads the archive in r and stores its posts in a tenant, resolving
+// posts whose ID or slug is taken with conflict. Posts that are invalid or
+// conflict with each other are reported and skipped; storage errors stop
+// the import.
+func Import(ctx context.Context, r io.ReaderAt, size int64, target Target, tenantID string, conflict post.Conflict) (*Report, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, apperror.Wrap(apperror.KindBadRequest, "invalid_archive", "the archive is not a zip file", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var manifest Manifest
+	if err := readJSON(files[manifestName], &manifest); err != nil {
+		return nil, apperror.Wrap(apperror.KindBadRequest, "invalid_archive", "the archive has no readable manifest.json", err)
+	}
+
+	if manifest.Format != Format || manifest.Version < 1 || manifest.Version > Version {
+		return nil, apperror.BadRequest("unsupported_archive",
+			fmt.Sprintf("cannot read %q archives of version %d; this server reads %q up to version %d", manifest.Format, manifest.Version, Format, Version))
+	}
+
+	report := &Report{Tenant: tenantID}
+
+	for _, f := range zr.File {
+		if path.Dir(f.Name) != "posts" || path.Ext(f.Name) != ".json" {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return report, interrupted(err)
+		}
+
+		p, err := readPost(f, files)
+		if err == nil {
+			err = validate(p)
+		}
+
+		if err != nil {
+			report.Failures = append(report.Failures, Failure{File: f.Name, Error: err.Error()})
+			continue
+		}
+
+		fromID, fromSlug := p.ID, p.Slug
+
+		outcome, err := target.Import(ctx, tenantID, p, conflict)
+		switch apperror.KindOf(err) {
+		case apperror.KindValidation, apperror.KindConflict, apperror.KindBadRequest:
+			report.Failures = append(report.Failures, Failure{File: f.Name, Error: err.Error()})
+			continue
+		}
+
+		if err != nil {
+			return report, err
+		}
+
+		switch outcome {
+		case post.ImportCreated:
+			report.Created++
+		case post.ImportOverwritten:
+			report.Overwritten++
+		case post.ImportSkipped:
+			report.Skipped++
+		case post.ImportRenamed:
+			report.Renamed++
+			report.Renames = append(report.Renames, Rename{FromID: fromID, FromSlug: fromSlug, ID: p.ID, Slug: p.Slug})
+		}
+	}
+
+	logging.FromContext(ctx).Info("imported tenant archive", "tenant", tenantID, "from", manifest.Tenant,
+		"created", report.Created, "overwritten", report.Overwritten, "renamed", report.Renamed,
+		"skipped", report.Skipped, "failed", len(report.Failures))
+
+	return report, nil
+}
+
+func readPost(f *zip.File, files map[string]*zip.File) (*post.Post, error) {
+	var record Record
+	if err := readJSON(f, &record); err != nil {
+		return nil, err
+	}
+
+	content, ok := files[record.Content]
+	if !ok {
+		return nil, fmt.Errorf("content file %q is not in the archive", record.Content)
+	}
+
+	raw, err := readFile(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.Version < 1 {
+		record.Version = 1
+	}
+
+	return &post.Post{
+		ID:           record.ID,
+		Slug:         record.Slug,
+		Title:        record.Title,
+		Abstract:     record.Abstract,
+		Tags:         post.NormalizeTags(record.Tags),
+		AuthorID:     record.AuthorID,
+		LastEditedBy: record.LastEditedBy,
+		IsPublished:  record.IsPublished,
+		Version:      record.Version,
+		CreatedAt:    record.CreatedAt,
+		UpdatedAt:    record.UpdatedAt,
+		PublishedAt:  record.PublishedAt,
+		ContentRaw:   string(raw),
+	}, nil
+}
+
+// validate holds imported posts to the rules of new ones.
+func validate(p *post.Post) error {
+	if strings.TrimSpace(p.ID) == "" {
+		return errors.New("id is required")
+	}
+
+	if p.Slug == "" || strings.ContainsAny(p.Slug, `/\?#`) {
+		return fmt.Errorf("slug %q cannot be part of a URL", p.Slug)
+	}
+
+	return post.CreatePostRequest{
+		Title:      p.Title,
+		Abstract:   p.Abstract,
+		ContentRaw: p.ContentRaw,
+		Tags:       p.Tags,
+	}.Validate()
+}
+
+func readJSON(f *zip.File, v interface{}) error {
+	if f == nil {
+		return errors.New("file missing")
+	}
+
+	b, err := readFile(f)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+
+	return nil
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	b, err := io.ReadAll(io.LimitReader(rc, maxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+
+	if len(b) > maxFileSize {
+		return nil, fmt.Errorf("%s: larger than %d bytes", f.Name, maxFileSize)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,284 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"glog/apperror"
+	"glog/post"
+	"glog/responsehandler"
+
+	"github.com/gorilla/mux"
+)
+
+type fakeSource []*post.Post
+
+func (s fakeSource) Each(ctx context.Context, tenantID string, fn func(*post.Post) error) error {
+	for _, p := range s {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fakeTarget renames posts whose slug is taken and records what it got.
+type fakeTarget struct {
+	imported []*post.Post
+	slugs    map[string]bool
+}
+
+func (t *fakeTarget) Import(ctx context.Context, tenantID string, p *post.Post, conflict post.Conflict) (post.ImportOutcome, error) {
+	if t.slugs[p.Slug] {
+		if conflict != post.ConflictRename {
+			return post.ImportSkipped, nil
+		}
+
+		p.Slug += "-2"
+		t.imported = append(t.imported, p)
+		return post.ImportRenamed, nil
+	}
+
+	t.imported = append(t.imported, p)
+	return post.ImportCreated, nil
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	posts := fakeSource{
+		{ID: "0b9c5f3e-1", Slug: "hello", Title: "Hello", Abstract: "First", ContentRaw: "# Hi\n\n![cat](/media/cat.png)\n", Tags: []string{"go"},
+			AuthorID: "ana", IsPublished: true, Version: 3, CreatedAt: at, UpdatedAt: at.Add(time.Hour), PublishedAt: at},
+		{ID: "odd/id", Slug: "draft", Title: "Draft", ContentRaw: "Not yet.", Version: 1, CreatedAt: at},
+	}
+
+	var buf bytes.Buffer
+
+	count, err := Export(context.Background(), &buf, posts, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Errorf("Expected 2 posts exported, got %d", count)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+
+	expected := []string{"manifest.json", "posts/0b9c5f3e-1.json", "posts/0b9c5f3e-1.md", "posts/post~2.json", "posts/post~2.md"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected files %v, got %v", expected, names)
+	}
+
+	var record Record
+	if err := readJSON(zr.File[1], &record); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(record.Media, []string{"/media/cat.png"}) {
+		t.Errorf("Expected the image to be referenced, got %v", record.Media)
+	}
+
+	target := &fakeTarget{slugs: map[string]bool{"draft": true}}
+
+	report, err := Import(context.Background(), bytes.NewReader(buf.Bytes()), int64(buf.Len()), target, "globex", post.ConflictRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Created != 1 || report.Renamed != 1 || len(report.Failures) != 0 {
+		t.Errorf("Expected 1 post created and 1 renamed, got %+v", report)
+	}
+
+	if len(report.Renames) != 1 || report.Renames[0].FromSlug != "draft" || report.Renames[0].Slug != "draft-2" {
+		t.Errorf("Expected draft to be renamed draft-2, got %+v", report.Renames)
+	}
+
+	got := target.imported[0]
+	if got.ContentRaw != posts[0].ContentRaw || !got.UpdatedAt.Equal(posts[0].UpdatedAt) || got.Version != 3 || !got.IsPublished || got.AuthorID != "ana" {
+		t.Errorf("Expected every field to survive the round trip, got %+v", got)
+	}
+}
+
+func TestExportNamesCannotCollide(t *testing.T) {
+	posts := fakeSource{
+		{ID: "odd/id", Slug: "odd", Title: "Odd", ContentRaw: "odd"},
+		{ID: "post-1", Slug: "plain", Title: "Plain", ContentRaw: "plain"},
+	}
+
+	var buf bytes.Buffer
+	if _, err := Export(context.Background(), &buf, posts, "acme"); err != nil {
+		t.Fatal(err)
+	}
+
+	target := &fakeTarget{}
+	if _, err := Import(context.Background(), bytes.NewReader(buf.Bytes()), int64(buf.Len()), target, "acme", post.ConflictSkip); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(target.imported) != 2 {
+		t.Fatalf("Expected both posts to be imported, got %+v", target.imported)
+	}
+
+	for _, p := range target.imported {
+		if p.ContentRaw != p.Slug {
+			t.Errorf("Expected %s to keep its own content, got %q", p.ID, p.ContentRaw)
+		}
+	}
+}
+
+func archive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for name, contents := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.Write([]byte(contents))
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestImportReportsInvalidPosts(t *testing.T) {
+	b := archive(t, map[string]string{
+		"manifest.json":    `{"format": "glog-tenant-archive", "version": 1}`,
+		"posts/a.json":     `{"id": "a", "slug": "a", "title": "", "content": "posts/a.md"}`,
+		"posts/a.md":       "text",
+		"posts/b.json":     `{"id": "b", "slug": "b", "title": "Missing content", "content": "posts/nope.md"}`,
+		"posts/c.json":     `{"id": "c", "slug": "c/d", "title": "Bad slug", "content": "posts/a.md"}`,
+		"posts/ok.json":    `{"id": "ok", "slug": "ok", "title": "Fine", "content": "posts/a.md"}`,
+		"other/skip.json":  `not even JSON`,
+		"posts/notes.txt":  "ignored",
+		"posts/d.json":     `{"id": "d", broken`,
+		"posts/e.json":     `{"id": "e", "slug": "e", "title": "Fine", "content": "posts/a.md", "revisions": [{"version": 1, "content": "posts/a.md"}]}`,
+		"posts/extra.json": `{"id": "", "slug": "x", "title": "No ID", "content": "posts/a.md"}`,
+	})
+
+	target := &fakeTarget{}
+
+	report, err := Import(context.Background(), bytes.NewReader(b), int64(len(b)), target, "acme", post.ConflictSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Created != 2 {
+		t.Errorf("Expected the two valid posts to be imported, got %+v", report)
+	}
+
+	failed := make(map[string]bool)
+	for _, failure := range report.Failures {
+		failed[failure.File] = true
+	}
+
+	for _, name := range []string{"posts/a.json", "posts/b.json", "posts/c.json", "posts/d.json", "posts/extra.json"} {
+		if !failed[name] {
+			t.Errorf("Expected %s to be reported, got %+v", name, report.Failures)
+		}
+	}
+}
+
+func TestImportRejectsUnknownArchives(t *testing.T) {
+	for name, b := range map[string][]byte{
+		"not a zip":      []byte("hello"),
+		"no manifest":    archive(t, map[string]string{"posts/a.json": "{}"}),
+		"future version": archive(t, map[string]string{"manifest.json": `{"format": "glog-tenant-archive", "version": 99}`}),
+	} {
+		_, err := Import(context.Background(), bytes.NewReader(b), int64(len(b)), &fakeTarget{}, "acme", post.ConflictSkip)
+		if !apperror.Is(err, apperror.KindBadRequest) {
+			t.Errorf("%s: Expected a bad request, got %v", name, err)
+		}
+	}
+}
+
+func TestHandlerImport(t *testing.T) {
+	h := &Handler{Target: &fakeTarget{}}
+
+	serve := func(contentType, query string, body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/admin/tenants/acme/import"+query, bytes.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+
+		w := httptest.NewRecorder()
+		h.Import(w, mux.SetURLVars(r, map[string]string{"tenantID": "acme"}))
+		return w
+	}
+
+	b := archive(t, map[string]string{
+		"manifest.json": `{"format": "glog-tenant-archive", "version": 1}`,
+		"posts/a.json":  `{"id": "a", "slug": "a", "title": "A", "content": "posts/a.md"}`,
+		"posts/a.md":    "text",
+	})
+
+	if w := serve("application/json", "", b); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for JSON, got %d", w.Code)
+	}
+
+	if w := serve(ContentType, "?conflict=merge", b); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown strategy, got %d", w.Code)
+	}
+
+	w := serve(ContentType, "?conflict=overwrite", b)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"created":1`) {
+		t.Errorf("Expected the post to be imported, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+// cancelingTarget cancels the import after storing its first post.
+type cancelingTarget struct {
+	fakeTarget
+	cancel context.CancelFunc
+}
+
+func (t *cancelingTarget) Import(ctx context.Context, tenantID string, p *post.Post, conflict post.Conflict) (post.ImportOutcome, error) {
+	defer t.cancel()
+	return t.fakeTarget.Import(ctx, tenantID, p, conflict)
+}
+
+func TestHandlerImportReportsWhatWasDoneBeforeStopping(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := &Handler{Target: &cancelingTarget{cancel: cancel}}
+
+	b := archive(t, map[string]string{
+		"manifest.json": `{"format": "glog-tenant-archive", "version": 1}`,
+		"posts/a.json":  `{"id": "a", "slug": "a", "title": "A", "content": "posts/a.md"}`,
+		"posts/a.md":    "text",
+		"posts/b.json":  `{"id": "b", "slug": "b", "title": "B", "content": "posts/b.md"}`,
+		"posts/b.md":    "text",
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/tenants/acme/import", bytes.NewReader(b)).WithContext(ctx)
+	r.Header.Set("Content-Type", ContentType)
+
+	w := httptest.NewRecorder()
+	h.Import(w, mux.SetURLVars(r, map[string]string{"tenantID": "acme"}))
+
+	if w.Code != responsehandler.StatusClientClosedRequest || !strings.Contains(w.Body.String(), `"partial":{"tenant":"acme","created":1`) {
+		t.Errorf("Expected 499 with the partial report, got %d %s", w.Code, w.Body.String())
+	}
+}
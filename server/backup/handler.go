@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"glog/apperror"
+	"glog/logging"
+	"glog/post"
+	"glog/request"
+	"glog/responsehandler"
+
+	"github.com/gorilla/mux"
+)
+
+// ContentType is the media type of archives.
+const ContentType = "application/zip"
+
+// Handler serves the export and import of tenant archives.
+type Handler struct {
+	Source Source
+	Target Target
+}
+
+// Export godoc
+// @Summary      Export a tenant
+// @Description  Streams every post of the tenant, drafts included, as a zip archive of JSON and Markdown files
+// @Produce      application/zip
+// @Param        tenantID   path      string  true  "Tenant ID"
+// @Success      200
+// @Failure      500  {object}  responsehandler.Problem
+// @Failure      503  {object}  responsehandler.Problem
+// @Router       /admin/tenants/{tenantID}/export [get]
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	tenantID := mux.Vars(r)["tenantID"]
+	name := fmt.Sprintf("%s-%s.zip", tenantID, time.Now().UTC().Format("20060102-150405"))
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("Cache-Control", "no-store")
+
+	count, err := Export(r.Context(), w, h.Source, tenantID)
+	if err != nil {
+		// The archive is already on its way; abort the response so the
+		// client does not take a truncated archive for a complete one.
+		logging.FromContext(r.Context()).Error("tenant export failed", "tenant", tenantID, "posts", count, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	logging.FromContext(r.Context()).Info("tenant exported", "tenant", tenantID, "posts", count)
+}
+
+// Import godoc
+// @Summary      Import a tenant
+// @Description  Stores the posts of an archive made by Export in the tenant. conflict decides what happens to posts whose ID or slug is taken: skip (the default) keeps the stored post, overwrite replaces it and rename stores the imported post under a new ID or slug.
+// @Accept       application/zip
+// @Produce      json
+// @Param        tenantID   path      string  true   "Tenant ID"
+// @Param        conflict   query     string  false  "skip, overwrite or rename"
+// @Success      200  {object}  backup.Report
+// @Failure      400  {object}  responsehandler.Problem
+// @Failure      413  {object}  responsehandler.Problem
+// @Failure      415  {object}  responsehandler.Problem
+// @Failure      500  {object}  responsehandler.Problem
+// @Failure      503  {object}  responsehandler.Problem
+// @Router       /admin/tenants/{tenantID}/import [post]
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	tenantID := mux.Vars(r)["tenantID"]
+
+	conflict, err := post.ParseConflict(r.URL.Query().Get("conflict"))
+	if err != nil {
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != ContentType {
+		responsehandler.EncodeError(w, r, errNotAnArchive)
+		return
+	}
+
+	// Zip archives are read from their end, so the upload is spooled to
+	// disk rather than held in memory.
+	f, err := os.CreateTemp("", "glog-import-*.zip")
+	if err != nil {
+		responsehandler.EncodeError(w, r, apperror.Internal(err))
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size, err := request.CopyBody(f, r)
+	if err != nil {
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
+
+	report, err := Import(r.Context(), f, size, h.Target, tenantID, conflict)
+	if err != nil {
+		problem := responsehandler.NewProblem(r, err)
+
+		// Posts imported before the failure stay stored; the report tells
+		// which, so the import can be resumed.
+		if report != nil {
+			logging.FromContext(r.Context()).Warn("tenant import stopped", "tenant", tenantID,
+				"created", report.Created, "overwritten", report.Overwritten, "renamed", report.Renamed, "skipped", report.Skipped)
+			problem.Partial = report
+		}
+
+		responsehandler.EncodeProblem(w, r, problem, err)
+		return
+	}
+
+	responsehandler.EncodeJSONResponse(w, report, http.StatusOK, nil)
+}
+
+var errNotAnArchive = apperror.New(
+	apperror.KindUnsupportedMediaType,
+	"unsupported_media_type",
+	"archives must be sent as "+ContentType,
+)
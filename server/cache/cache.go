@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"glog/apperror"
+	"glog/logging"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNotFound is returned by Store.Get for a missing or expired key.
+var ErrNotFound = errors.New("cache: key not found")
+
+// Store keeps encoded values with a time to live.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Close() error
+}
+
+// Stats model info
+// @Description Counters of a read-through cache since the process started
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Shared counts misses served by a load another request had started.
+	Shared int64 `json:"shared"`
+	Errors int64 `json:"errors"`
+}
+
+// Cache is a read-through cache of JSON encoded values grouped by
+// namespace, typically a tenant. Invalidate drops every key of a namespace
+// at once by moving it to a new generation, which also keeps a load that
+// raced with a write from caching stale data under the current generation.
+//
+// Concurrent misses on the same key share a single load. Store failures
+// are counted and logged but never fail a request; the value is loaded
+// instead.
+type Cache struct {
+	// Timeout bounds a shared load. The load runs apart from the request
+	// that started it, so that request going away does not fail the
+	// others waiting on it; 0 leaves it to the load's own timeouts.
+	Timeout time.Duration
+
+	store Store
+	ttl   time.Duration
+	group singleflight.Group
+
+	hits   int64
+	misses int64
+	shared int64
+	errors int64
+}
+
+func New(store Store, ttl time.Duration) *Cache {
+	return &Cache{store: store, ttl: ttl}
+}
+
+// Load fills dst with the cached value of key in namespace, or with the
+// value returned by load, which is then cached. A nil Cache always loads.
+func (c *Cache) Load(ctx context.Context, namespace string, key string, dst interface{}, load func(ctx context.Context) (interface{}, error)) error {
+	if c == nil {
+		return assign(ctx, dst, load)
+	}
+
+	gen, err := c.generation(ctx, namespace)
+	if err != nil {
+		c.fail(ctx, "reading cache generation", err)
+		return assign(ctx, dst, load)
+	}
+
+	fullKey := namespace + ":" + gen + ":" + key
+
+	if b, err := c.store.Get(ctx, fullKey); err == nil {
+		if err := json.Unmarshal(b, dst); err == nil {
+			atomic.AddInt64(&c.hits, 1)
+			return nil
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		c.fail(ctx, "reading cache", err)
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+
+	// Every caller decodes its own copy, so callers sharing a load can
+	// modify what they get. The load keeps the values of the first
+	// caller's context, such as its logger and trace, but not its
+	// cancellation; each caller stops waiting when its own context is done.
+	results := c.group.DoChan(fullKey, func() (interface{}, error) {
+		ctx, cancel := c.detach(ctx)
+		defer cancel()
+
+		v, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		skip, ok := v.(uncached)
+		if ok {
+			v = skip.value
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			if err := c.store.Set(ctx, fullKey, b, c.ttl); err != nil {
+				c.fail(ctx, "writing cache", err)
+			}
+		}
+
+		return b, nil
+	})
+
+	var res singleflight.Result
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		return abandoned(ctx.Err())
+	}
+
+	if res.Shared {
+		atomic.AddInt64(&c.shared, 1)
+	}
+
+	if res.Err != nil {
+		return res.Err
+	}
+
+	return json.Unmarshal(res.Val.([]byte), dst)
+}
+
+// abandoned reports a caller that stopped waiting for a load as the
+// storage does, so that it is answered 499 or 504 rather than 500.
+func abandoned(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return apperror.Timeout("storage_timeout", "the post storage did not answer in time", err)
+	}
+
+	return apperror.Canceled("request_canceled", "the request was canceled", err)
+}
+
+// detach returns a context with the values of ctx, bounded by Timeout
+// instead of ctx's deadline and cancellation.
+func (c *Cache) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx = valueOnlyContext{ctx}
+	if c.Timeout > 0 {
+		return context.WithTimeout(ctx, c.Timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// valueOnlyContext keeps the values of a context but is never done.
+type valueOnlyContext struct {
+	context.Context
+}
+
+func (valueOnlyContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valueOnlyContext) Done() <-chan struct{}       { return nil }
+func (valueOnlyContext) Err() error                  { return nil }
+
+type uncached struct {
+	value interface{}
+}
+
+// Uncached wraps a value returned by a load function to hand it to the
+// caller without caching it.
+func Uncached(v interface{}) interface{} {
+	return uncached{value: v}
+}
+
+// Invalidate drops every cached key of namespace.
+func (c *Cache) Invalidate(ctx context.Context, namespace string) {
+	if c == nil {
+		return
+	}
+
+	if err := c.store.Set(ctx, generationKey(namespace), newGeneration(), 0); err != nil {
+		c.fail(ctx, "invalidating cache", err)
+	}
+}
+
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	return Stats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+		Shared: atomic.LoadInt64(&c.shared),
+		Errors: atomic.LoadInt64(&c.errors),
+	}
+}
+
+func (c *Cache) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	return c.store.Close()
+}
+
+// generation returns the current generation of namespace, starting a new
+// one if the store lost it, so keys of an older generation are never read
+// again.
+func (c *Cache) generation(ctx context.Context, namespace string) (string, error) {
+	b, err := c.store.Get(ctx, generationKey(namespace))
+	if err == nil {
+		return string(b), nil
+	}
+
+	if !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+
+	gen := newGeneration()
+	return string(gen), c.store.Set(ctx, generationKey(namespace), gen, 0)
+}
+
+func (c *Cache) fail(ctx context.Context, msg string, err error) {
+	atomic.AddInt64(&c.errors, 1)
+	logging.FromContext(ctx).Warn(msg, "error", err)
+}
+
+func generationKey(namespace string) string {
+	return namespace + ":generation"
+}
+
+func newGeneration() []byte {
+	return []byte(strconv.FormatInt(time.Now().UnixNano(), 36))
+}
+
+// assign stores the result of load in dst without going through the store.
+func assign(ctx context.Context, dst interface{}, load func(ctx context.Context) (interface{}, error)) error {
+	v, err := load(ctx)
+	if err != nil {
+		return err
+	}
+
+	if skip, ok := v.(uncached); ok {
+		v = skip.value
+	}
+
+	reflect.ValueOf(dst).Elem().Set(reflect.ValueOf(v))
+	return nil
+}
@@ -0,0 +1,263 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"glog/apperror"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+type item struct {
+	Name string
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRU(2)
+
+	l.Set(ctx, "a", []byte("1"), 0)
+	l.Set(ctx, "b", []byte("2"), 0)
+	l.Get(ctx, "a")
+	l.Set(ctx, "c", []byte("3"), 0)
+
+	if _, err := l.Get(ctx, "b"); err != ErrNotFound {
+		t.Errorf("Expected b to be evicted, got %v", err)
+	}
+
+	if _, err := l.Get(ctx, "a"); err != nil {
+		t.Errorf("Expected a to be kept, got %v", err)
+	}
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	l := NewLRU(10)
+	l.now = func() time.Time { return now }
+
+	l.Set(ctx, "a", []byte("1"), time.Minute)
+	now = now.Add(time.Minute)
+
+	if _, err := l.Get(ctx, "a"); err != ErrNotFound {
+		t.Errorf("Expected a to be expired, got %v", err)
+	}
+
+	if l.Len() != 0 {
+		t.Errorf("Expected the expired entry to be dropped, got %d entries", l.Len())
+	}
+}
+
+func TestLoadReadsThrough(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewLRU(10), time.Minute)
+	loads := 0
+	load := func(ctx context.Context) (interface{}, error) {
+		loads++
+		return item{Name: "hello"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		var got item
+		if err := c.Load(ctx, "tenant", "post:hello", &got, load); err != nil || got.Name != "hello" {
+			t.Fatalf("Expected hello, got %v (%v)", got, err)
+		}
+	}
+
+	if loads != 1 {
+		t.Errorf("Expected a single load, got %d", loads)
+	}
+
+	if stats := c.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %+v", stats)
+	}
+}
+
+func TestInvalidateDropsNamespace(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewLRU(10), time.Minute)
+	name := "before"
+	load := func(ctx context.Context) (interface{}, error) {
+		return item{Name: name}, nil
+	}
+
+	var got item
+	c.Load(ctx, "tenant", "post:hello", &got, load)
+	c.Load(ctx, "other", "post:hello", &got, load)
+
+	name = "after"
+	c.Invalidate(ctx, "tenant")
+
+	c.Load(ctx, "tenant", "post:hello", &got, load)
+	if got.Name != "after" {
+		t.Errorf("Expected the invalidated value to be reloaded, got %s", got.Name)
+	}
+
+	c.Load(ctx, "other", "post:hello", &got, load)
+	if got.Name != "before" {
+		t.Errorf("Expected other namespaces to be kept, got %s", got.Name)
+	}
+}
+
+func TestUncachedValuesAreNotStored(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewLRU(10), time.Minute)
+	loads := 0
+	load := func(ctx context.Context) (interface{}, error) {
+		loads++
+		return Uncached(item{Name: "draft"}), nil
+	}
+
+	for i := 0; i < 2; i++ {
+		var got item
+		if err := c.Load(ctx, "tenant", "post:draft", &got, load); err != nil || got.Name != "draft" {
+			t.Fatalf("Expected draft, got %v (%v)", got, err)
+		}
+	}
+
+	if loads != 2 {
+		t.Errorf("Expected every read to load, got %d loads", loads)
+	}
+}
+
+func TestConcurrentMissesShareALoad(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewLRU(10), time.Minute)
+	release := make(chan struct{})
+	var loads int32
+
+	load := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return item{Name: "popular"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got item
+			c.Load(ctx, "tenant", "post:popular", &got, load)
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("Expected one load for concurrent misses, got %d", n)
+	}
+}
+
+func TestCancelledCallerDoesNotFailASharedLoad(t *testing.T) {
+	c := New(NewLRU(10), time.Minute)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	load := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		select {
+		case <-release:
+			return item{Name: "popular"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		var got item
+		firstErr <- c.Load(first, "tenant", "post:popular", &got, load)
+	}()
+
+	<-started
+
+	second := make(chan error, 1)
+	var got item
+	go func() {
+		second <- c.Load(context.Background(), "tenant", "post:popular", &got, load)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := <-firstErr; apperror.KindOf(err) != apperror.KindCanceled || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the first caller to stop as canceled, got %v", err)
+	}
+
+	close(release)
+
+	if err := <-second; err != nil || got.Name != "popular" {
+		t.Errorf("Expected the second caller to get the value, got %v (%v)", got, err)
+	}
+
+	if c.Stats().Shared != 1 {
+		t.Errorf("Expected the second caller to share the load, got %+v", c.Stats())
+	}
+}
+
+func TestCallerRunningOutOfTimeIsATimeout(t *testing.T) {
+	c := New(NewLRU(10), time.Minute)
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var got item
+	err := c.Load(ctx, "tenant", "post:slow", &got, func(ctx context.Context) (interface{}, error) {
+		<-release
+		return item{Name: "slow"}, nil
+	})
+
+	if apperror.KindOf(err) != apperror.KindTimeout {
+		t.Errorf("Expected a timeout while the load is still running, got %v", err)
+	}
+}
+
+func TestNilCacheLoadsDirectly(t *testing.T) {
+	var c *Cache
+	var got *item
+
+	err := c.Load(context.Background(), "tenant", "post:hello", &got, func(ctx context.Context) (interface{}, error) {
+		return &item{Name: "hello"}, nil
+	})
+
+	if err != nil || got == nil || got.Name != "hello" {
+		t.Errorf("Expected hello, got %v (%v)", got, err)
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	store := NewRedis(redis.NewClient(&redis.Options{Addr: srv.Addr()}), "glog:")
+	defer store.Close()
+
+	if _, err := store.Get(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if err := store.Set(ctx, "a", []byte("1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if !srv.Exists("glog:a") {
+		t.Errorf("Expected the key to be prefixed")
+	}
+
+	srv.FastForward(time.Minute)
+
+	if _, err := store.Get(ctx, "a"); err != ErrNotFound {
+		t.Errorf("Expected the key to expire, got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"glog/backup"
+	"glog/config"
+	"glog/importer"
+	"glog/logging"
+	"glog/metrics"
+	"glog/post"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// commands are run by `glog <name>` instead of the server.
+var commands = map[string]func(args []string) int{
+	"export-static": exportStatic,
+	"export-tenant": exportTenant,
+	"import-tenant": importTenant,
+	"import-blog":   importBlog,
+}
+
+// errUsage makes a command print its usage.
+var errUsage = errors.New("usage")
+
+// runCommand runs a command working on the posts in Mongo. define adds the
+// command's flags and returns its body, which runs once the configuration is
+// loaded and Mongo connected. It returns the exit code.
+func runCommand(name string, args []string, define func(fs *flag.FlagSet) func(ctx context.Context, cfg *config.Config, pm *post.Repository) error) int {
+	fs := flag.NewFlagSet("glog "+name, flag.ExitOnError)
+	run := define(fs)
+	loader := config.NewLoader(fs)
+	fs.Parse(args)
+
+	cfg, err := loader.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	logLevel, _ := logging.ParseLevel(cfg.Log.Level)
+	logFormat, _ := logging.ParseFormat(cfg.Log.Format)
+
+	logger := logging.New(os.Stderr, logLevel, logFormat)
+	logging.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = logging.NewContext(ctx, logger)
+
+	pm := &post.Repository{
+		Config:  cfg,
+		Metrics: metrics.New(),
+	}
+
+	if err := pm.Connect(ctx); err != nil {
+		logger.Error("could not connect to mongo", "error", err)
+		return 1
+	}
+	defer pm.Disconnect(context.Background())
+
+	switch err := run(ctx, cfg, pm); {
+	case errors.Is(err, errUsage):
+		fs.Usage()
+		return 2
+	case err != nil:
+		logger.Error(name+" failed", "error", err)
+		return 1
+	}
+
+	return 0
+}
+
+// flagValue names a flag checked by required.
+type flagValue struct {
+	name  string
+	value *string
+}
+
+// required checks that flags were given a value, reporting the first one
+// that was not.
+func required(flags ...flagValue) error {
+	for _, f := range flags {
+		if *f.value == "" {
+			fmt.Fprintf(os.Stderr, "--%s is required\n", f.name)
+			return errUsage
+		}
+	}
+
+	return nil
+}
+
+// exportTenant runs `glog export-tenant`, which writes every post of a
+// tenant to an archive.
+func exportTenant(args []string) int {
+	return runCommand("export-tenant", args, func(fs *flag.FlagSet) func(context.Context, *config.Config, *post.Repository) error {
+		tenant := fs.String("tenant", "", "tenant to export")
+		out := fs.String("out", "", "archive to write, or - for standard output")
+
+		return func(ctx context.Context, cfg *config.Config, pm *post.Repository) error {
+			if err := required(flagValue{"tenant", tenant}, flagValue{"out", out}); err != nil {
+				return err
+			}
+
+			if *out == "-" {
+				_, err := backup.Export(ctx, os.Stdout, pm, *tenant)
+				return err
+			}
+
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+
+			count, err := backup.Export(ctx, f, pm, *tenant)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+
+			if err != nil {
+				os.Remove(*out)
+				return err
+			}
+
+			logging.FromContext(ctx).Info("exported", "tenant", *tenant, "out", *out, "posts", count)
+			return nil
+		}
+	})
+}
+
+// importTenant runs `glog import-tenant`, which stores the posts of an
+// archive in a tenant.
+func importTenant(args []string) int {
+	return runCommand("import-tenant", args, func(fs *flag.FlagSet) func(context.Context, *config.Config, *post.Repository) error {
+		tenant := fs.String("tenant", "", "tenant to import into")
+		in := fs.String("in", "", "archive to read")
+		conflictFlag := fs.String("conflict", "skip", "what to do with posts whose ID or slug is taken: skip, overwrite or rename")
+
+		return func(ctx context.Context, cfg *config.Config, pm *post.Repository) error {
+			if err := required(flagValue{"tenant", tenant}, flagValue{"in", in}); err != nil {
+				return err
+			}
+
+			conflict, err := post.ParseConflict(*conflictFlag)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return errUsage
+			}
+
+			f, err := os.Open(*in)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+
+			report, err := backup.Import(ctx, f, info.Size(), pm, *tenant, conflict)
+			if report != nil {
+				for _, rename := range report.Renames {
+					fmt.Printf("renamed %s (%s) to %s (%s)\n", rename.FromSlug, rename.FromID, rename.Slug, rename.ID)
+				}
+
+				for _, failure := range report.Failures {
+					fmt.Printf("failed %s: %s\n", failure.File, failure.Error)
+				}
+			}
+
+			return err
+		}
+	})
+}
+
+// importBlog runs `glog import-blog`, which stores the posts of a blog
+// exported from WordPress, Jekyll, Hugo or Ghost in a tenant.
+func importBlog(args []string) int {
+	return runCommand("import-blog", args, func(fs *flag.FlagSet) func(context.Context, *config.Config, *post.Repository) error {
+		tenant := fs.String("tenant", "", "tenant to import into")
+		format := fs.String("format", "", "format of the export: "+strings.Join(importer.Formats, ", "))
+		in := fs.String("in", "", "WXR file for wordpress, site directory for jekyll and hugo, JSON file for ghost")
+		dryRun := fs.Bool("dry-run", false, "report what would be imported without storing anything")
+		conflictFlag := fs.String("conflict", "skip", "what to do with posts whose slug is taken: skip, overwrite or rename")
+
+		return func(ctx context.Context, cfg *config.Config, pm *post.Repository) error {
+			if err := required(flagValue{"tenant", tenant}, flagValue{"format", format}, flagValue{"in", in}); err != nil {
+				return err
+			}
+
+			conflict, err := post.ParseConflict(*conflictFlag)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return errUsage
+			}
+
+			res, err := importer.Open(*format, *in)
+			if err != nil {
+				return err
+			}
+
+			report, err := importer.Run(ctx, pm, *tenant, res, importer.Options{DryRun: *dryRun, Conflict: conflict})
+			if report != nil {
+				if *dryRun {
+					for _, item := range report.Posts {
+						state := "draft"
+						if item.Published {
+							state = "published"
+						}
+						fmt.Printf("%s %s -> %s (%s, %s)\n", item.Outcome, item.Source, item.Slug, state, item.Title)
+					}
+					fmt.Println()
+				}
+
+				report.WriteSummary(os.Stdout)
+			}
+
+			return err
+		}
+	})
+}
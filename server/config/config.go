@@ -1,63 +1,733 @@
 package config
 
 import (
-	"log"
-	"os"
+	"fmt"
+	"net"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// Config is the effective configuration of glog. Every setting can come
+// from a YAML or TOML file, an environment variable (the env tag) or a
+// command line flag named after its path in the file, such as
+// --server.port. See Load for the precedence between them.
+//
+// Settings tagged secret are redacted when the configuration is printed.
 type Config struct {
-	Env                string
-	LogLevel           string
-	Port               string
-	DBConnectionString string
-	ReadTimeout        int
-	WriteTimeout       int
+	Env       string          `yaml:"env" toml:"env" env:"ENV"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+	Cache     CacheConfig     `yaml:"cache" toml:"cache"`
+	HTTPCache HTTPCacheConfig `yaml:"http_cache" toml:"http_cache"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	CORS      CORSConfig      `yaml:"cors" toml:"cors"`
+	Frontend  FrontendConfig  `yaml:"frontend" toml:"frontend"`
+	Site      SiteConfig      `yaml:"site" toml:"site"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Feeds     FeedsConfig     `yaml:"feeds" toml:"feeds"`
 }
 
-func NewConfig() *Config {
-	if os.Getenv("ENV") == "" {
-		os.Setenv("ENV", "development")
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" usage:"debug, info, warn or error"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" usage:"json or text"`
+}
+
+type ServerConfig struct {
+	Host            string        `yaml:"host" toml:"host" env:"SERVER_HOST" usage:"address to bind to; 0.0.0.0 for all interfaces"`
+	Port            string        `yaml:"port" toml:"port" env:"PORT"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"how long to drain requests on shutdown"`
+	DrainDelay      time.Duration `yaml:"drain_delay" toml:"drain_delay" env:"DRAIN_DELAY" usage:"how long to keep serving after readiness fails on shutdown, so load balancers stop sending requests"`
+	TransferTimeout time.Duration `yaml:"transfer_timeout" toml:"transfer_timeout" env:"SERVER_TRANSFER_TIMEOUT" usage:"how long a tenant export or import may take, instead of read_timeout and write_timeout"`
+	TLS             TLSConfig     `yaml:"tls" toml:"tls"`
+	Compression     Compression   `yaml:"compression" toml:"compression"`
+	BodyLimits      BodyLimits    `yaml:"body_limits" toml:"body_limits"`
+}
+
+// BodyLimits caps the request body of each route, in bytes. A route left at
+// 0 uses Default.
+type BodyLimits struct {
+	Default int `yaml:"default" toml:"default" env:"BODY_LIMIT" usage:"largest request body in bytes for routes without their own limit"`
+	Create  int `yaml:"create" toml:"create" env:"BODY_LIMIT_CREATE"`
+	Update  int `yaml:"update" toml:"update" env:"BODY_LIMIT_UPDATE"`
+	Patch   int `yaml:"patch" toml:"patch" env:"BODY_LIMIT_PATCH"`
+	Import  int `yaml:"import" toml:"import" env:"BODY_LIMIT_IMPORT" usage:"largest tenant archive in bytes accepted by /admin/tenants/{tenantID}/import"`
+}
+
+// For returns the body limit of a route: create, update, patch or import.
+func (l BodyLimits) For(route string) int64 {
+	var n int
+
+	switch route {
+	case "create":
+		n = l.Create
+	case "update":
+		n = l.Update
+	case "patch":
+		n = l.Patch
+	case "import":
+		n = l.Import
 	}
 
-	if os.Getenv("LOG_LEVEL") == "" {
-		os.Setenv("LogLevel", "debug")
+	if n <= 0 {
+		n = l.Default
 	}
 
-	if os.Getenv("PORT") == "" {
-		os.Setenv("PORT", "5000")
+	return int64(n)
+}
+
+// Compression sets how responses are gzip or brotli encoded.
+type Compression struct {
+	Enabled bool `yaml:"enabled" toml:"enabled" env:"COMPRESSION_ENABLED"`
+	MinSize int  `yaml:"min_size" toml:"min_size" env:"COMPRESSION_MIN_SIZE" usage:"smallest body in bytes worth compressing"`
+}
+
+// TLSConfig enables HTTPS when both CertFile and KeyFile are set.
+type TLSConfig struct {
+	CertFile       string        `yaml:"cert_file" toml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile        string        `yaml:"key_file" toml:"key_file" env:"TLS_KEY_FILE"`
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval" env:"TLS_RELOAD_INTERVAL" usage:"how often to check the certificate files for changes"`
+	RedirectPort   string        `yaml:"redirect_port" toml:"redirect_port" env:"TLS_REDIRECT_PORT" usage:"plain HTTP port redirecting to HTTPS; empty disables it"`
+	ClientCAFile   string        `yaml:"client_ca_file" toml:"client_ca_file" env:"TLS_CLIENT_CA_FILE" usage:"CA for client certificates; requires them on admin endpoints"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+type StorageConfig struct {
+	ConnectionString string          `yaml:"connection_string" toml:"connection_string" env:"MONGO_CONNECTION_STRING" secret:"true"`
+	ConnectTimeout   time.Duration   `yaml:"connect_timeout" toml:"connect_timeout" env:"MONGO_CONNECT_TIMEOUT" usage:"how long to keep retrying the first connection"`
+	Timeouts         StorageTimeouts `yaml:"timeouts" toml:"timeouts"`
+	MaxPoolSize      int             `yaml:"max_pool_size" toml:"max_pool_size" env:"MONGO_MAX_POOL_SIZE" usage:"connections per server; 0 uses the driver default"`
+	MinPoolSize      int             `yaml:"min_pool_size" toml:"min_pool_size" env:"MONGO_MIN_POOL_SIZE"`
+	ReadConcern      string          `yaml:"read_concern" toml:"read_concern" env:"MONGO_READ_CONCERN" usage:"local, available, majority, linearizable or snapshot; empty uses the server default"`
+	WriteConcern     string          `yaml:"write_concern" toml:"write_concern" env:"MONGO_WRITE_CONCERN" usage:"majority or a number of nodes; empty uses the server default"`
+	ReadPreference   string          `yaml:"read_preference" toml:"read_preference" env:"MONGO_READ_PREFERENCE" usage:"primary, primaryPreferred, secondary, secondaryPreferred or nearest"`
+	RetryWrites      bool            `yaml:"retry_writes" toml:"retry_writes" env:"MONGO_RETRY_WRITES"`
+	RetryReads       bool            `yaml:"retry_reads" toml:"retry_reads" env:"MONGO_RETRY_READS"`
+	TenantClusters   []string        `yaml:"tenant_clusters" toml:"tenant_clusters" env:"MONGO_TENANT_CLUSTERS" secret:"true" usage:"tenant=connection string pairs for tenants stored on their own cluster"`
+}
+
+// TenantRoutes parses TenantClusters into connection strings by tenant.
+func (c StorageConfig) TenantRoutes() (map[string]string, error) {
+	routes := make(map[string]string, len(c.TenantClusters))
+
+	for i, entry := range c.TenantClusters {
+		tenant, uri, ok := strings.Cut(entry, "=")
+		tenant = strings.TrimSpace(tenant)
+
+		if !ok || tenant == "" || uri == "" {
+			return nil, fmt.Errorf("entry %d is not a tenant=connection string pair", i)
+		}
+
+		if !validConnectionString(uri) {
+			return nil, fmt.Errorf("entry %d (tenant %s): must start with mongodb:// or mongodb+srv://", i, tenant)
+		}
+
+		if _, dup := routes[tenant]; dup {
+			return nil, fmt.Errorf("tenant %s is listed more than once", tenant)
+		}
+
+		routes[tenant] = strings.TrimSpace(uri)
 	}
 
-	if os.Getenv("MONGO_CONNECTION_STRING") == "" {
-		os.Setenv("MONGO_CONNECTION_STRING", "mongodb://localhost:27017")
+	return routes, nil
+}
+
+// StorageTimeouts bounds each repository operation. An operation left at 0
+// uses Default. They should stay below server.write_timeout so that a slow
+// query is reported as a timeout rather than cut off mid-response.
+type StorageTimeouts struct {
+	Default time.Duration `yaml:"default" toml:"default" env:"MONGO_TIMEOUT" usage:"timeout of repository operations without their own"`
+	Get     time.Duration `yaml:"get" toml:"get" env:"MONGO_TIMEOUT_GET"`
+	List    time.Duration `yaml:"list" toml:"list" env:"MONGO_TIMEOUT_LIST"`
+	Create  time.Duration `yaml:"create" toml:"create" env:"MONGO_TIMEOUT_CREATE"`
+	Save    time.Duration `yaml:"save" toml:"save" env:"MONGO_TIMEOUT_SAVE"`
+	Delete  time.Duration `yaml:"delete" toml:"delete" env:"MONGO_TIMEOUT_DELETE"`
+	Ping    time.Duration `yaml:"ping" toml:"ping" env:"MONGO_TIMEOUT_PING"`
+	Connect time.Duration `yaml:"connect" toml:"connect" env:"MONGO_TIMEOUT_CONNECT" usage:"timeout of each attempt to connect to mongo"`
+}
+
+// For returns the timeout of a repository operation: get, list, create,
+// save, delete, ping or connect.
+func (t StorageTimeouts) For(operation string) time.Duration {
+	var d time.Duration
+
+	switch operation {
+	case "get":
+		d = t.Get
+	case "list":
+		d = t.List
+	case "create":
+		d = t.Create
+	case "save":
+		d = t.Save
+	case "delete":
+		d = t.Delete
+	case "ping":
+		d = t.Ping
+	case "connect":
+		d = t.Connect
 	}
 
-	if os.Getenv("SERVER_READ_TIMEOUT") == "" {
-		os.Setenv("SERVER_READ_TIMEOUT", "2")
+	if d <= 0 {
+		return t.Default
 	}
 
-	if os.Getenv("SERVER_WRITE_TIMEOUT") == "" {
-		os.Setenv("SERVER_WRITE_TIMEOUT", "2")
+	return d
+}
+
+// CacheConfig selects the read-through cache of published posts.
+type CacheConfig struct {
+	Driver        string        `yaml:"driver" toml:"driver" env:"CACHE_DRIVER" usage:"memory, redis or none"`
+	TTL           time.Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL"`
+	MaxEntries    int           `yaml:"max_entries" toml:"max_entries" env:"CACHE_MAX_ENTRIES" usage:"size of the memory cache"`
+	RedisAddr     string        `yaml:"redis_addr" toml:"redis_addr" env:"REDIS_ADDR"`
+	RedisPassword string        `yaml:"redis_password" toml:"redis_password" env:"REDIS_PASSWORD" secret:"true"`
+	RedisDB       int           `yaml:"redis_db" toml:"redis_db" env:"REDIS_DB"`
+	RedisPrefix   string        `yaml:"redis_prefix" toml:"redis_prefix" env:"REDIS_PREFIX" usage:"prefix of every key glog writes to Redis"`
+}
+
+// HTTPCacheConfig sets the caching headers of post responses.
+type HTTPCacheConfig struct {
+	Published          string `yaml:"published" toml:"published" env:"HTTP_CACHE_PUBLISHED" usage:"Cache-Control of published posts and lists"`
+	Drafts             string `yaml:"drafts" toml:"drafts" env:"HTTP_CACHE_DRAFTS" usage:"Cache-Control of drafts and lists including them"`
+	SurrogateKeyHeader string `yaml:"surrogate_key_header" toml:"surrogate_key_header" env:"HTTP_CACHE_SURROGATE_KEY_HEADER" usage:"header listing CDN purge keys, e.g. Surrogate-Key or Cache-Tag; empty disables it"`
+}
+
+// RateLimitConfig sets token buckets per route class. Each bucket holds up
+// to its limit and refills at that many requests per Period.
+type RateLimitConfig struct {
+	Enabled        bool          `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	Store          string        `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE" usage:"memory, or redis to share limits between instances using the cache.redis_* settings"`
+	Period         time.Duration `yaml:"period" toml:"period" env:"RATE_LIMIT_PERIOD"`
+	TrustedProxies []string      `yaml:"trusted_proxies" toml:"trusted_proxies" env:"RATE_LIMIT_TRUSTED_PROXIES" usage:"IPs or CIDR ranges whose X-Forwarded-For is believed"`
+	Read           RateLimits    `yaml:"read" toml:"read"`
+	Write          RateLimits    `yaml:"write" toml:"write"`
+	Search         RateLimits    `yaml:"search" toml:"search"`
+}
+
+// RateLimits are the requests allowed per period to each client, identified
+// by API key or IP, and to each tenant. 0 disables a limit.
+type RateLimits struct {
+	Client int `yaml:"client" toml:"client"`
+	Tenant int `yaml:"tenant" toml:"tenant"`
+}
+
+// CORSConfig lets browser apps on other origins call the API. It is enabled
+// once any origin is allowed.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" toml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"origins such as https://app.example.com or https://*.example.com"`
+	TenantOrigins    []string      `yaml:"tenant_origins" toml:"tenant_origins" env:"CORS_TENANT_ORIGINS" usage:"tenant=origin pairs allowed on that tenant's routes only"`
+	AllowedMethods   []string      `yaml:"allowed_methods" toml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" toml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" toml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" toml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" toml:"max_age" env:"CORS_MAX_AGE" usage:"how long browsers may cache a preflight response"`
+}
+
+func (c CORSConfig) Enabled() bool {
+	return len(c.AllowedOrigins) > 0 || len(c.TenantOrigins) > 0
+}
+
+// TenantOriginsByTenant parses TenantOrigins. A tenant may be listed several
+// times to allow several origins.
+func (c CORSConfig) TenantOriginsByTenant() (map[string][]string, error) {
+	origins := make(map[string][]string)
+
+	for i, entry := range c.TenantOrigins {
+		tenant, origin, ok := strings.Cut(entry, "=")
+		tenant, origin = strings.TrimSpace(tenant), strings.TrimSpace(origin)
+
+		if !ok || tenant == "" || origin == "" {
+			return nil, fmt.Errorf("entry %d is not a tenant=origin pair", i)
+		}
+
+		origins[tenant] = append(origins[tenant], origin)
 	}
 
-	serverReadTimeout, err := strconv.Atoi(os.Getenv("SERVER_READ_TIMEOUT"))
+	return origins, nil
+}
 
-	if err != nil {
-		log.Panicf("Invalid value %v for SERVER_READ_TIMEOUT", os.Getenv("SERVER_READ_TIMEOUT"))
+// FrontendConfig sets how the embedded frontend is served and the runtime
+// config it is given.
+type FrontendConfig struct {
+	Enabled     bool     `yaml:"enabled" toml:"enabled" env:"FRONTEND_ENABLED" usage:"serve the frontend built into the binary"`
+	APIBaseURL  string   `yaml:"api_base_url" toml:"api_base_url" env:"FRONTEND_API_BASE_URL" usage:"API URL as seen by browsers; empty for the same origin"`
+	Tenant      string   `yaml:"tenant" toml:"tenant" env:"FRONTEND_TENANT" usage:"tenant shown on hosts without their own"`
+	TenantHosts []string `yaml:"tenant_hosts" toml:"tenant_hosts" env:"FRONTEND_TENANT_HOSTS" usage:"host=tenant pairs, e.g. blog.acme.com=acme"`
+}
+
+// TenantByHost parses TenantHosts.
+func (c FrontendConfig) TenantByHost() (map[string]string, error) {
+	tenants := make(map[string]string, len(c.TenantHosts))
+
+	for i, entry := range c.TenantHosts {
+		host, tenant, ok := strings.Cut(entry, "=")
+		host, tenant = strings.ToLower(strings.TrimSpace(host)), strings.TrimSpace(tenant)
+
+		if !ok || host == "" || tenant == "" {
+			return nil, fmt.Errorf("entry %d is not a host=tenant pair", i)
+		}
+
+		if _, dup := tenants[host]; dup {
+			return nil, fmt.Errorf("host %s is listed more than once", host)
+		}
+
+		tenants[host] = tenant
 	}
 
-	serverWriteTimeout, err := strconv.Atoi(os.Getenv("SERVER_WRITE_TIMEOUT"))
+	return tenants, nil
+}
 
-	if err != nil {
-		log.Panicf("Invalid value %v for SERVER_WRITE_TIMEOUT", os.Getenv("SERVER_WRITE_TIMEOUT"))
+// SiteConfig sets up the server rendered blog pages under /blog.
+type SiteConfig struct {
+	Enabled      bool     `yaml:"enabled" toml:"enabled" env:"SITE_ENABLED"`
+	ThemesDir    string   `yaml:"themes_dir" toml:"themes_dir" env:"SITE_THEMES_DIR" usage:"directory of themes besides the built-in ones"`
+	Theme        string   `yaml:"theme" toml:"theme" env:"SITE_THEME" usage:"theme of tenants without their own"`
+	TenantThemes []string `yaml:"tenant_themes" toml:"tenant_themes" env:"SITE_TENANT_THEMES" usage:"tenant=theme pairs"`
+	PageSize     int      `yaml:"page_size" toml:"page_size" env:"SITE_PAGE_SIZE" usage:"posts per page"`
+	Reload       bool     `yaml:"reload" toml:"reload" env:"SITE_RELOAD" usage:"re-read themes on every request, for theme development"`
+}
+
+// ThemeByTenant parses TenantThemes.
+func (c SiteConfig) ThemeByTenant() (map[string]string, error) {
+	themes := make(map[string]string, len(c.TenantThemes))
+
+	for i, entry := range c.TenantThemes {
+		tenant, theme, ok := strings.Cut(entry, "=")
+		tenant, theme = strings.TrimSpace(tenant), strings.TrimSpace(theme)
+
+		if !ok || tenant == "" || theme == "" {
+			return nil, fmt.Errorf("entry %d is not a tenant=theme pair", i)
+		}
+
+		if _, dup := themes[tenant]; dup {
+			return nil, fmt.Errorf("tenant %s is listed more than once", tenant)
+		}
+
+		themes[tenant] = theme
 	}
 
+	return themes, nil
+}
+
+type TracingConfig struct {
+	OTLPEndpoint string  `yaml:"otlp_endpoint" toml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" usage:"host:port of the OTLP/HTTP collector; empty disables tracing"`
+	OTLPInsecure bool    `yaml:"otlp_insecure" toml:"otlp_insecure" env:"TRACING_OTLP_INSECURE"`
+	SampleRatio  float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+type AuthConfig struct {
+	APIKeys []string `yaml:"api_keys" toml:"api_keys" env:"AUTH_API_KEYS" secret:"true" usage:"comma separated API keys"`
+}
+
+// FeedsConfig holds the defaults of export-static's --base-url and
+// --feed-items.
+type FeedsConfig struct {
+	Enabled  bool   `yaml:"enabled" toml:"enabled" env:"FEEDS_ENABLED" usage:"write the Atom feed in static exports"`
+	BaseURL  string `yaml:"base_url" toml:"base_url" env:"FEEDS_BASE_URL" usage:"public URL of the blogs, used for links in static exports"`
+	MaxItems int    `yaml:"max_items" toml:"max_items" env:"FEEDS_MAX_ITEMS" usage:"number of posts in the feed of static exports"`
+}
+
+// Default returns the configuration used when no other source sets a value.
+func Default() *Config {
 	return &Config{
-		Env:                os.Getenv("ENV"),
-		LogLevel:           os.Getenv("LOG_LEVEL"),
-		Port:               os.Getenv("PORT"),
-		DBConnectionString: os.Getenv("MONGO_CONNECTION_STRING"),
-		ReadTimeout:        serverReadTimeout,
-		WriteTimeout:       serverWriteTimeout,
+		Env: "development",
+		Log: LogConfig{
+			Level:  "debug",
+			Format: "json",
+		},
+		Server: ServerConfig{
+			Host:            "127.0.0.1",
+			Port:            "5000",
+			ReadTimeout:     2 * time.Second,
+			WriteTimeout:    2 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+			DrainDelay:      5 * time.Second,
+			TransferTimeout: 30 * time.Minute,
+			TLS: TLSConfig{
+				ReloadInterval: time.Minute,
+			},
+			Compression: Compression{
+				Enabled: true,
+				MinSize: 1024,
+			},
+			BodyLimits: BodyLimits{
+				Default: 1 << 20,
+				Import:  256 << 20,
+			},
+		},
+		Storage: StorageConfig{
+			ConnectionString: "mongodb://localhost:27017",
+			ConnectTimeout:   time.Minute,
+			Timeouts: StorageTimeouts{
+				Default: 1500 * time.Millisecond,
+				Connect: 10 * time.Second,
+			},
+			ReadPreference: "primary",
+			RetryWrites:    true,
+			RetryReads:     true,
+		},
+		Cache: CacheConfig{
+			Driver:      "memory",
+			TTL:         time.Minute,
+			MaxEntries:  10000,
+			RedisAddr:   "localhost:6379",
+			RedisPrefix: "glog:",
+		},
+		HTTPCache: HTTPCacheConfig{
+			Published:          "public, max-age=60, stale-while-revalidate=60",
+			Drafts:             "private, no-cache",
+			SurrogateKeyHeader: "Surrogate-Key",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Store:   "memory",
+			Period:  time.Minute,
+			Read:    RateLimits{Client: 600, Tenant: 6000},
+			Write:   RateLimits{Client: 60, Tenant: 600},
+			Search:  RateLimits{Client: 120, Tenant: 1200},
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "If-Modified-Since", "If-None-Match", "X-Request-ID"},
+			ExposedHeaders: []string{"ETag", "Last-Modified", "RateLimit-Limit", "RateLimit-Policy", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+		Frontend: FrontendConfig{
+			Enabled: true,
+		},
+		Site: SiteConfig{
+			Enabled:  true,
+			Theme:    "default",
+			PageSize: 10,
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
+		Feeds: FeedsConfig{
+			Enabled:  true,
+			MaxItems: 20,
+		},
+	}
+}
+
+// ValidationError lists every invalid setting found while loading.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+func (e *ValidationError) orNil() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// Validate checks every setting and reports all problems at once.
+func (c *Config) Validate() error {
+	errs := &ValidationError{}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		errs.add("log.level: unknown level %q", c.Log.Level)
+	}
+
+	switch strings.ToLower(c.Log.Format) {
+	case "json", "text":
+	default:
+		errs.add("log.format: unknown format %q", c.Log.Format)
+	}
+
+	if err := validatePort(c.Server.Port); err != nil {
+		errs.add("server.port: %v", err)
+	}
+
+	if c.Server.Host != "" && net.ParseIP(c.Server.Host) == nil && c.Server.Host != "localhost" {
+		errs.add("server.host: %q is not an IP address", c.Server.Host)
+	}
+
+	if tls := c.Server.TLS; tls.Enabled() {
+		if tls.CertFile == "" || tls.KeyFile == "" {
+			errs.add("server.tls: cert_file and key_file must be set together")
+		}
+
+		if tls.RedirectPort != "" {
+			if err := validatePort(tls.RedirectPort); err != nil {
+				errs.add("server.tls.redirect_port: %v", err)
+			} else if tls.RedirectPort == c.Server.Port {
+				errs.add("server.tls.redirect_port: must differ from server.port")
+			}
+		}
+	} else if c.Server.TLS.RedirectPort != "" || c.Server.TLS.ClientCAFile != "" {
+		errs.add("server.tls: redirect_port and client_ca_file require cert_file and key_file")
+	}
+
+	if c.Server.Compression.MinSize < 0 {
+		errs.add("server.compression.min_size: must not be negative, got %d", c.Server.Compression.MinSize)
+	}
+
+	if c.Server.DrainDelay < 0 {
+		errs.add("server.drain_delay: must not be negative, got %s", c.Server.DrainDelay)
+	}
+
+	if c.Server.BodyLimits.Default <= 0 {
+		errs.add("server.body_limits.default: must be positive, got %d", c.Server.BodyLimits.Default)
+	}
+
+	durations := []namedDuration{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"server.transfer_timeout", c.Server.TransferTimeout},
+		{"server.tls.reload_interval", c.Server.TLS.ReloadInterval},
+		{"storage.connect_timeout", c.Storage.ConnectTimeout},
+		{"storage.timeouts.default", c.Storage.Timeouts.Default},
 	}
+
+	for _, d := range durations {
+		if d.value <= 0 {
+			errs.add("%s: must be positive, got %s", d.key, d.value)
+		}
+	}
+
+	t := c.Storage.Timeouts
+	operations := []namedDuration{
+		{"get", t.Get},
+		{"list", t.List},
+		{"create", t.Create},
+		{"save", t.Save},
+		{"delete", t.Delete},
+		{"ping", t.Ping},
+		{"connect", t.Connect},
+	}
+
+	for _, op := range operations {
+		if op.value < 0 {
+			errs.add("storage.timeouts.%s: must not be negative, got %s", op.key, op.value)
+		}
+	}
+
+	// Pings run from the readiness check and connections at startup, not
+	// inside a request.
+	limits := append(operations[:5:5], namedDuration{"default", t.Default})
+
+	for _, op := range limits {
+		if op.value > 0 && c.Server.WriteTimeout > 0 && op.value >= c.Server.WriteTimeout {
+			errs.add("storage.timeouts.%s: must be shorter than server.write_timeout (%s), got %s", op.key, c.Server.WriteTimeout, op.value)
+		}
+	}
+
+	if c.Storage.ConnectionString == "" {
+		errs.add("storage.connection_string: is required")
+	} else if !validConnectionString(c.Storage.ConnectionString) {
+		errs.add("storage.connection_string: must start with mongodb:// or mongodb+srv://")
+	}
+
+	if _, err := c.Storage.TenantRoutes(); err != nil {
+		errs.add("storage.tenant_clusters: %v", err)
+	}
+
+	if c.Storage.MaxPoolSize < 0 || c.Storage.MinPoolSize < 0 {
+		errs.add("storage: pool sizes must not be negative")
+	} else if c.Storage.MaxPoolSize > 0 && c.Storage.MinPoolSize > c.Storage.MaxPoolSize {
+		errs.add("storage.min_pool_size: must not exceed max_pool_size (%d)", c.Storage.MaxPoolSize)
+	}
+
+	switch c.Storage.ReadConcern {
+	case "", "local", "available", "majority", "linearizable", "snapshot":
+	default:
+		errs.add("storage.read_concern: unknown level %q", c.Storage.ReadConcern)
+	}
+
+	if wc := c.Storage.WriteConcern; wc != "" && wc != "majority" {
+		if n, err := strconv.Atoi(wc); err != nil || n < 0 {
+			errs.add("storage.write_concern: must be majority or a number of nodes, got %q", wc)
+		}
+	}
+
+	switch c.Storage.ReadPreference {
+	case "primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest":
+	default:
+		errs.add("storage.read_preference: unknown mode %q", c.Storage.ReadPreference)
+	}
+
+	switch c.Cache.Driver {
+	case "none":
+	case "memory", "redis":
+		if c.Cache.TTL <= 0 {
+			errs.add("cache.ttl: must be positive, got %s", c.Cache.TTL)
+		}
+
+		if c.Cache.Driver == "memory" && c.Cache.MaxEntries < 1 {
+			errs.add("cache.max_entries: must be at least 1, got %d", c.Cache.MaxEntries)
+		}
+
+		if c.Cache.Driver == "redis" && c.Cache.RedisAddr == "" {
+			errs.add("cache.redis_addr: is required by the redis driver")
+		}
+	default:
+		errs.add("cache.driver: unknown driver %q", c.Cache.Driver)
+	}
+
+	if h := c.HTTPCache.SurrogateKeyHeader; h != "" && strings.ContainsAny(h, " :\t\r\n") {
+		errs.add("http_cache.surrogate_key_header: %q is not a valid header name", h)
+	}
+
+	if rl := c.RateLimit; rl.Enabled {
+		switch rl.Store {
+		case "memory":
+		case "redis":
+			if c.Cache.RedisAddr == "" {
+				errs.add("cache.redis_addr: is required by the redis rate limit store")
+			}
+		default:
+			errs.add("rate_limit.store: unknown store %q", rl.Store)
+		}
+
+		if rl.Period <= 0 {
+			errs.add("rate_limit.period: must be positive, got %s", rl.Period)
+		}
+
+		for _, proxy := range rl.TrustedProxies {
+			if !validNetwork(proxy) {
+				errs.add("rate_limit.trusted_proxies: %q is not an IP address or CIDR range", proxy)
+			}
+		}
+
+		classes := []struct {
+			name   string
+			limits RateLimits
+		}{
+			{"read", rl.Read},
+			{"write", rl.Write},
+			{"search", rl.Search},
+		}
+
+		for _, class := range classes {
+			if class.limits.Client < 0 || class.limits.Tenant < 0 {
+				errs.add("rate_limit.%s: limits must not be negative", class.name)
+			}
+		}
+	}
+
+	if cors := c.CORS; cors.Enabled() {
+		origins := append([]string(nil), cors.AllowedOrigins...)
+
+		if byTenant, err := cors.TenantOriginsByTenant(); err != nil {
+			errs.add("cors.tenant_origins: %v", err)
+		} else {
+			for _, tenantOrigins := range byTenant {
+				origins = append(origins, tenantOrigins...)
+			}
+		}
+
+		for _, origin := range origins {
+			if origin == "*" {
+				if cors.AllowCredentials {
+					errs.add("cors.allow_credentials: cannot be combined with the origin *")
+				}
+			} else if !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+				errs.add("cors: origin %q must start with http:// or https://", origin)
+			}
+		}
+
+		if len(cors.AllowedMethods) == 0 {
+			errs.add("cors.allowed_methods: must not be empty")
+		}
+
+		if cors.MaxAge < 0 {
+			errs.add("cors.max_age: must not be negative, got %s", cors.MaxAge)
+		}
+	}
+
+	if _, err := c.Frontend.TenantByHost(); err != nil {
+		errs.add("frontend.tenant_hosts: %v", err)
+	}
+
+	if u := c.Frontend.APIBaseURL; u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "/") {
+		errs.add("frontend.api_base_url: must be an http or https URL or a path, got %q", u)
+	}
+
+	if c.Site.Enabled {
+		if _, err := c.Site.ThemeByTenant(); err != nil {
+			errs.add("site.tenant_themes: %v", err)
+		}
+
+		if c.Site.Theme == "" {
+			errs.add("site.theme: is required")
+		}
+
+		if c.Site.PageSize < 1 || c.Site.PageSize > 100 {
+			errs.add("site.page_size: must be between 1 and 100, got %d", c.Site.PageSize)
+		}
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs.add("tracing.sample_ratio: must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	for i, key := range c.Auth.APIKeys {
+		if len(key) < 16 {
+			errs.add("auth.api_keys[%d]: must be at least 16 characters long", i)
+		}
+	}
+
+	if c.Feeds.MaxItems < 1 {
+		errs.add("feeds.max_items: must be at least 1, got %d", c.Feeds.MaxItems)
+	}
+
+	if c.Feeds.BaseURL != "" && !strings.HasPrefix(c.Feeds.BaseURL, "http://") && !strings.HasPrefix(c.Feeds.BaseURL, "https://") {
+		errs.add("feeds.base_url: must be an http or https URL")
+	}
+
+	return errs.orNil()
+}
+
+func validConnectionString(uri string) bool {
+	uri = strings.TrimSpace(uri)
+	return strings.HasPrefix(uri, "mongodb://") || strings.HasPrefix(uri, "mongodb+srv://")
+}
+
+func validNetwork(s string) bool {
+	if strings.Contains(s, "/") {
+		_, _, err := net.ParseCIDR(s)
+		return err == nil
+	}
+
+	return net.ParseIP(s) != nil
+}
+
+type namedDuration struct {
+	key   string
+	value time.Duration
+}
+
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	if n < 1 || n > 65535 {
+		return fmt.Errorf("port %d out of range", n)
+	}
+
+	return nil
 }
@@ -0,0 +1,294 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func load(t *testing.T, env map[string]string, args ...string) (*Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := NewLoader(fs)
+	l.lookupEnv = func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Expected flags to parse, got %v", err)
+	}
+
+	return l.Load()
+}
+
+func writeFile(t *testing.T, name string, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	cfg, err := load(t, nil)
+
+	if err != nil {
+		t.Fatalf("Expected defaults to be valid, got %v", err)
+	}
+
+	if cfg.Server.Port != "5000" || cfg.Server.ReadTimeout != 2*time.Second {
+		t.Errorf("Unexpected defaults %+v", cfg.Server)
+	}
+}
+
+func TestPrecedenceIsFileThenEnvThenFlags(t *testing.T) {
+	file := writeFile(t, "glog.yaml", `
+server:
+  port: "6000"
+  read_timeout: 5s
+log:
+  level: info
+  format: text
+`)
+
+	cfg, err := load(t, map[string]string{"LOG_LEVEL": "warn", "PORT": "7000"}, "--config", file, "--server.port", "8000")
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if cfg.Server.Port != "8000" {
+		t.Errorf("Expected the flag to win, got port %s", cfg.Server.Port)
+	}
+
+	if cfg.Log.Level != "warn" {
+		t.Errorf("Expected the env var to win over the file, got %s", cfg.Log.Level)
+	}
+
+	if cfg.Log.Format != "text" || cfg.Server.ReadTimeout != 5*time.Second {
+		t.Errorf("Expected file values to override defaults, got %+v %+v", cfg.Log, cfg.Server)
+	}
+}
+
+func TestLoadsTOML(t *testing.T) {
+	file := writeFile(t, "glog.toml", `
+[auth]
+api_keys = ["0123456789abcdef"]
+
+[feeds]
+max_items = 5
+`)
+
+	cfg, err := load(t, map[string]string{ConfigFileEnv: file})
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(cfg.Auth.APIKeys) != 1 || cfg.Feeds.MaxItems != 5 {
+		t.Errorf("Expected TOML values, got %+v %+v", cfg.Auth, cfg.Feeds)
+	}
+}
+
+func TestErrorsAreAggregated(t *testing.T) {
+	file := writeFile(t, "glog.yaml", "server:\n  prot: 1\n")
+
+	_, err := load(t, map[string]string{"SERVER_READ_TIMEOUT": "soon"}, "--config", file, "--tracing.sample_ratio", "2", "--log.level", "loud")
+
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+
+	for _, expected := range []string{`unknown setting "server.prot"`, "server.read_timeout", "tracing.sample_ratio", "log.level"} {
+		if !strings.Contains(verr.Error(), expected) {
+			t.Errorf("Expected %q to be reported in %s", expected, verr)
+		}
+	}
+}
+
+func TestLegacyIntegerTimeoutsAreSeconds(t *testing.T) {
+	cfg, err := load(t, map[string]string{"SERVER_WRITE_TIMEOUT": "3"})
+
+	if err != nil || cfg.Server.WriteTimeout != 3*time.Second {
+		t.Errorf("Expected 3s, got %v (%v)", cfg.Server.WriteTimeout, err)
+	}
+}
+
+func TestStorageTimeoutsFallBackToDefault(t *testing.T) {
+	cfg, err := load(t, map[string]string{"MONGO_TIMEOUT_LIST": "500ms"})
+	if err != nil {
+		t.Fatalf("Expected a valid configuration, got %v", err)
+	}
+
+	if d := cfg.Storage.Timeouts.For("list"); d != 500*time.Millisecond {
+		t.Errorf("Expected the list override, got %s", d)
+	}
+
+	if d := cfg.Storage.Timeouts.For("get"); d != 1500*time.Millisecond {
+		t.Errorf("Expected the default timeout, got %s", d)
+	}
+
+	if d := cfg.Storage.Timeouts.For("connect"); d != 10*time.Second {
+		t.Errorf("Expected the connect timeout, got %s", d)
+	}
+}
+
+func TestStorageTimeoutsMustBeShorterThanWriteTimeout(t *testing.T) {
+	_, err := load(t, nil, "--storage.timeouts.save", "5s")
+
+	if err == nil || !strings.Contains(err.Error(), "storage.timeouts.save: must be shorter than server.write_timeout") {
+		t.Errorf("Expected the save timeout to be rejected, got %v", err)
+	}
+}
+
+func TestDrainDelayMustNotBeNegative(t *testing.T) {
+	if _, err := load(t, nil, "--server.drain_delay", "0s"); err != nil {
+		t.Errorf("Expected no drain delay to be valid, got %v", err)
+	}
+
+	if _, err := load(t, map[string]string{"DRAIN_DELAY": "-1s"}); err == nil || !strings.Contains(err.Error(), "server.drain_delay") {
+		t.Errorf("Expected a negative drain delay to be rejected, got %v", err)
+	}
+}
+
+func TestTransferTimeoutMustBePositive(t *testing.T) {
+	cfg, err := load(t, map[string]string{"SERVER_TRANSFER_TIMEOUT": "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.TransferTimeout != time.Hour {
+		t.Errorf("Expected a transfer timeout of 1h, got %v", cfg.Server.TransferTimeout)
+	}
+
+	if _, err := load(t, nil, "--server.transfer_timeout", "0s"); err == nil || !strings.Contains(err.Error(), "server.transfer_timeout") {
+		t.Errorf("Expected no transfer timeout to be rejected, got %v", err)
+	}
+}
+
+func TestTenantClustersAreParsed(t *testing.T) {
+	cfg, err := load(t, map[string]string{"MONGO_TENANT_CLUSTERS": "acme=mongodb+srv://acme.example.com, globex=mongodb://globex:27017"})
+	if err != nil {
+		t.Fatalf("Expected a valid configuration, got %v", err)
+	}
+
+	routes, _ := cfg.Storage.TenantRoutes()
+	if routes["acme"] != "mongodb+srv://acme.example.com" || routes["globex"] != "mongodb://globex:27017" {
+		t.Errorf("Unexpected routes %v", routes)
+	}
+}
+
+func TestStorageSettingsAreValidated(t *testing.T) {
+	_, err := load(t, nil,
+		"--storage.tenant_clusters", "acme",
+		"--storage.read_concern", "eventual",
+		"--storage.write_concern", "all",
+		"--storage.read_preference", "any",
+		"--storage.min_pool_size", "10",
+		"--storage.max_pool_size", "5",
+		"--storage.timeouts.connect", "-1s",
+	)
+
+	for _, expected := range []string{"storage.timeouts.connect", "storage.tenant_clusters", "storage.read_concern", "storage.write_concern", "storage.read_preference", "storage.min_pool_size"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to be reported, got %v", expected, err)
+		}
+	}
+}
+
+func TestRateLimitSettingsAreValidated(t *testing.T) {
+	_, err := load(t, nil,
+		"--rate_limit.store", "etcd",
+		"--rate_limit.trusted_proxies", "10.0.0.0/8,proxy.local",
+		"--rate_limit.write.client", "-1",
+	)
+
+	for _, expected := range []string{"rate_limit.store", `"proxy.local"`, "rate_limit.write"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to be reported, got %v", expected, err)
+		}
+	}
+
+	cfg, err := load(t, nil, "--rate_limit.read.tenant", "50")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.RateLimit.Read.Tenant != 50 || cfg.RateLimit.Read.Client != 600 {
+		t.Errorf("Expected read limits 600/50, got %+v", cfg.RateLimit.Read)
+	}
+}
+
+func TestCORSSettingsAreValidated(t *testing.T) {
+	_, err := load(t, nil,
+		"--cors.allowed_origins", "*,app.example.com",
+		"--cors.tenant_origins", "acme",
+		"--cors.allow_credentials", "true",
+	)
+
+	for _, expected := range []string{"cors.allow_credentials", `"app.example.com"`, "cors.tenant_origins"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to be reported, got %v", expected, err)
+		}
+	}
+
+	cfg, err := load(t, nil, "--cors.tenant_origins", "acme=https://acme.blog,acme=https://www.acme.blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origins, _ := cfg.CORS.TenantOriginsByTenant()
+	if !cfg.CORS.Enabled() || len(origins["acme"]) != 2 {
+		t.Errorf("Expected two origins for acme, got %v", origins)
+	}
+}
+
+func TestSiteSettingsAreValidated(t *testing.T) {
+	_, err := load(t, nil,
+		"--site.tenant_themes", "acme",
+		"--site.page_size", "0",
+	)
+
+	for _, expected := range []string{"site.tenant_themes", "site.page_size"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to be reported, got %v", expected, err)
+		}
+	}
+
+	cfg, err := load(t, nil, "--site.tenant_themes", "acme=dark, globex = light")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	themes, _ := cfg.Site.ThemeByTenant()
+	if themes["acme"] != "dark" || themes["globex"] != "light" {
+		t.Errorf("Expected acme=dark and globex=light, got %v", themes)
+	}
+}
+
+func TestWriteRedactedMasksSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Storage.ConnectionString = "mongodb://user:hunter2@db:27017"
+	cfg.Auth.APIKeys = []string{"0123456789abcdef"}
+
+	var buf bytes.Buffer
+	if err := cfg.WriteRedacted(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "0123456789abcdef") {
+		t.Errorf("Expected secrets to be redacted:\n%s", out)
+	}
+
+	if !strings.Contains(out, "connection_string: "+redacted) || !strings.Contains(out, "read_timeout: 2s") {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+}
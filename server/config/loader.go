@@ -0,0 +1,391 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFileEnv names the environment variable read for the config file
+// path when --config is not given.
+const ConfigFileEnv = "GLOG_CONFIG"
+
+const redacted = "REDACTED"
+
+// Load builds the configuration from args, in increasing order of
+// precedence:
+//
+//  1. built-in defaults (see Default)
+//  2. the YAML or TOML file given by --config or $GLOG_CONFIG
+//  3. environment variables
+//  4. command line flags
+//
+// Every problem in every source is reported at once in a ValidationError.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("glog", flag.ContinueOnError)
+	l := NewLoader(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return l.Load()
+}
+
+// Loader registers one flag per setting on a FlagSet so that commands can
+// combine the configuration flags with their own.
+type Loader struct {
+	file      string
+	lookupEnv func(string) (string, bool)
+	flags     []flagValue
+}
+
+type flagValue struct {
+	path  string
+	value string
+}
+
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{lookupEnv: os.LookupEnv}
+
+	fs.StringVar(&l.file, "config", "", "path to a YAML or TOML configuration file (or $"+ConfigFileEnv+")")
+
+	for _, s := range settings() {
+		s := s
+		fs.Func(s.path, s.usage(), func(v string) error {
+			l.flags = append(l.flags, flagValue{path: s.path, value: v})
+			return nil
+		})
+	}
+
+	return l
+}
+
+// Load applies every source to the defaults and validates the result. It
+// must be called after the FlagSet given to NewLoader has been parsed.
+func (l *Loader) Load() (*Config, error) {
+	cfg := Default()
+	errs := &ValidationError{}
+	byPath := make(map[string]setting)
+	all := settings()
+
+	for _, s := range all {
+		byPath[s.path] = s
+	}
+
+	file := l.file
+	if file == "" {
+		file, _ = l.lookupEnv(ConfigFileEnv)
+	}
+
+	if file != "" {
+		values, err := readFile(file)
+		if err != nil {
+			errs.add("%s: %v", file, err)
+		}
+
+		for _, key := range sortedKeys(values) {
+			s, ok := byPath[key]
+			if !ok {
+				errs.add("%s: unknown setting %q", file, key)
+				continue
+			}
+
+			if err := s.setValue(cfg, values[key]); err != nil {
+				errs.add("%s (from %s): %v", key, file, err)
+			}
+		}
+	}
+
+	for _, s := range all {
+		if s.env == "" {
+			continue
+		}
+
+		if v, ok := l.lookupEnv(s.env); ok && v != "" {
+			if err := s.set(cfg, v); err != nil {
+				errs.add("%s (from $%s): %v", s.path, s.env, err)
+			}
+		}
+	}
+
+	for _, f := range l.flags {
+		if err := byPath[f.path].set(cfg, f.value); err != nil {
+			errs.add("%s (from --%s): %v", f.path, f.path, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		errs.Problems = append(errs.Problems, err.(*ValidationError).Problems...)
+	}
+
+	if err := errs.orNil(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// WriteRedacted prints the configuration as YAML with secrets masked.
+func (c *Config) WriteRedacted(w io.Writer) error {
+	root := yaml.MapSlice{}
+	v := reflect.ValueOf(c).Elem()
+
+	for _, s := range settings() {
+		value := v.FieldByIndex(s.index).Interface()
+
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+
+		if s.secret && !reflect.ValueOf(value).IsZero() {
+			value = redacted
+		}
+
+		root = insert(root, strings.Split(s.path, "."), value)
+	}
+
+	b, err := yaml.Marshal(root)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+func insert(m yaml.MapSlice, path []string, value interface{}) yaml.MapSlice {
+	if len(path) == 1 {
+		return append(m, yaml.MapItem{Key: path[0], Value: value})
+	}
+
+	for i, item := range m {
+		if item.Key == path[0] {
+			m[i].Value = insert(item.Value.(yaml.MapSlice), path[1:], value)
+			return m
+		}
+	}
+
+	return append(m, yaml.MapItem{Key: path[0], Value: insert(yaml.MapSlice{}, path[1:], value)})
+}
+
+// setting describes one leaf of Config.
+type setting struct {
+	path   string
+	env    string
+	secret bool
+	help   string
+	index  []int
+	kind   reflect.Type
+}
+
+func (s setting) usage() string {
+	var parts []string
+	if s.help != "" {
+		parts = append(parts, s.help)
+	}
+
+	if s.env != "" {
+		parts = append(parts, "$"+s.env)
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// settings walks Config and returns its leaves in declaration order.
+func settings() []setting {
+	var out []setting
+	walk(reflect.TypeOf(Config{}), nil, "", &out)
+	return out
+}
+
+func walk(t reflect.Type, index []int, prefix string, out *[]setting) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("yaml")
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		idx := append(append([]int{}, index...), i)
+
+		if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+			walk(f.Type, idx, path, out)
+			continue
+		}
+
+		*out = append(*out, setting{
+			path:   path,
+			env:    f.Tag.Get("env"),
+			secret: f.Tag.Get("secret") == "true",
+			help:   f.Tag.Get("usage"),
+			index:  idx,
+			kind:   f.Type,
+		})
+	}
+}
+
+// set parses raw, as found in an environment variable or flag, into the
+// setting's field.
+func (s setting) set(cfg *Config, raw string) error {
+	field := reflect.ValueOf(cfg).Elem().FieldByIndex(s.index)
+
+	switch {
+	case s.kind == durationType:
+		d, err := parseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case s.kind.Kind() == reflect.String:
+		field.SetString(raw)
+	case s.kind.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		field.SetBool(b)
+	case s.kind.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		field.SetInt(int64(n))
+	case s.kind.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		field.SetFloat(f)
+	case s.kind.Kind() == reflect.Slice && s.kind.Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.kind)
+	}
+
+	return nil
+}
+
+// setValue applies a value decoded from a config file. Lists are taken as
+// is; everything else goes through the same parsing as env and flags.
+func (s setting) setValue(cfg *Config, value interface{}) error {
+	if list, ok := value.([]interface{}); ok {
+		if s.kind.Kind() != reflect.Slice {
+			return fmt.Errorf("expected a single value, got a list")
+		}
+
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+
+		reflect.ValueOf(cfg).Elem().FieldByIndex(s.index).Set(reflect.ValueOf(items))
+		return nil
+	}
+
+	return s.set(cfg, fmt.Sprint(value))
+}
+
+// parseDuration accepts Go durations such as "1m30s" and, for compatibility
+// with the original environment variables, plain integers as seconds.
+func parseDuration(raw string) (time.Duration, error) {
+	if n, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+
+	return d, nil
+}
+
+// readFile decodes a YAML or TOML file into a flat map keyed by setting path.
+func readFile(path string) (map[string]interface{}, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := make(map[string]interface{})
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var raw map[interface{}]interface{}
+		if err := yaml.Unmarshal(b, &raw); err != nil {
+			return nil, err
+		}
+		tree = stringKeys(raw)
+	case ".toml":
+		if err := toml.Unmarshal(b, &tree); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q", filepath.Ext(path))
+	}
+
+	flat := make(map[string]interface{})
+	flatten(tree, "", flat)
+
+	return flat, nil
+}
+
+func stringKeys(m map[interface{}]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+
+	for k, v := range m {
+		if nested, ok := v.(map[interface{}]interface{}); ok {
+			v = stringKeys(nested)
+		}
+
+		out[fmt.Sprint(k)] = v
+	}
+
+	return out
+}
+
+func flatten(m map[string]interface{}, prefix string, out map[string]interface{}) {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		if nested, ok := v.(map[string]interface{}); ok {
+			flatten(nested, key, out)
+			continue
+		}
+
+		out[key] = v
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
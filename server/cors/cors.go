@@ -0,0 +1,205 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy says which browser origins may call the API. Origins are exact,
+// such as https://app.example.com, wildcard subdomains, such as
+// https://*.example.com, or "*" for any origin.
+type Policy struct {
+	Origins []string
+	// TenantOrigins are allowed, besides Origins, on the routes of their
+	// tenant only.
+	TenantOrigins    map[string][]string
+	Methods          []string
+	Headers          []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+	// Tenant returns the tenant a request is for, or "" if none.
+	Tenant func(r *http.Request) string
+}
+
+// CORS answers preflight requests and sets the CORS headers of responses to
+// allowed origins.
+type CORS struct {
+	policy  Policy
+	origins []pattern
+	tenants map[string][]pattern
+}
+
+func New(policy Policy) (*CORS, error) {
+	c := &CORS{policy: policy, tenants: make(map[string][]pattern)}
+
+	var err error
+	if c.origins, err = parsePatterns(policy.Origins); err != nil {
+		return nil, err
+	}
+
+	for tenant, origins := range policy.TenantOrigins {
+		if c.tenants[tenant], err = parsePatterns(origins); err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+	}
+
+	return c, nil
+}
+
+// Middleware must wrap the router, so preflight requests are answered
+// before routes, which do not accept OPTIONS, reject them with 405.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed := c.allowed(r, origin)
+
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+
+			if !allowed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			c.allowOrigin(h, origin)
+			h.Set("Access-Control-Allow-Methods", strings.Join(c.policy.Methods, ", "))
+
+			if len(c.policy.Headers) > 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(c.policy.Headers, ", "))
+			}
+
+			if c.policy.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.policy.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if allowed {
+			c.allowOrigin(h, origin)
+
+			if len(c.policy.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(c.policy.ExposedHeaders, ", "))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CORS) allowOrigin(h http.Header, origin string) {
+	h.Set("Access-Control-Allow-Origin", origin)
+
+	if c.policy.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *CORS) allowed(r *http.Request, origin string) bool {
+	if matchAny(c.origins, origin) {
+		return true
+	}
+
+	if c.policy.Tenant == nil {
+		return false
+	}
+
+	return matchAny(c.tenants[c.policy.Tenant(r)], origin)
+}
+
+// pattern matches origins with scheme, and a host that is either host or,
+// for wildcards, a subdomain of it. Any marks "*".
+type pattern struct {
+	any      bool
+	scheme   string
+	host     string
+	wildcard bool
+}
+
+func parsePatterns(origins []string) ([]pattern, error) {
+	patterns := make([]pattern, 0, len(origins))
+
+	for _, origin := range origins {
+		p, err := parsePattern(origin)
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, p)
+	}
+
+	return patterns, nil
+}
+
+func parsePattern(origin string) (pattern, error) {
+	origin = strings.TrimSpace(origin)
+	if origin == "*" {
+		return pattern{any: true}, nil
+	}
+
+	wildcard := strings.Contains(origin, "://*.")
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return pattern{}, fmt.Errorf("origin %q must be a scheme and host, such as https://app.example.com or https://*.example.com", origin)
+	}
+
+	return pattern{scheme: u.Scheme, host: strings.ToLower(u.Host), wildcard: wildcard}, nil
+}
+
+func (p pattern) match(origin string) bool {
+	if p.any {
+		return true
+	}
+
+	scheme, host, ok := strings.Cut(strings.ToLower(origin), "://")
+	if !ok || scheme != p.scheme {
+		return false
+	}
+
+	if p.wildcard {
+		return strings.HasSuffix(host, "."+p.host) && len(host) > len(p.host)+1
+	}
+
+	return host == p.host
+}
+
+func matchAny(patterns []pattern, origin string) bool {
+	for _, p := range patterns {
+		if p.match(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TenantFromPath returns the tenant of paths starting with prefix followed
+// by the tenant ID, such as /tenant/acme/posts for the prefix /tenant/.
+func TenantFromPath(prefix string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		rest := strings.TrimPrefix(r.URL.Path, prefix)
+		if rest == r.URL.Path {
+			return ""
+		}
+
+		tenant, _, _ := strings.Cut(rest, "/")
+		return tenant
+	}
+}
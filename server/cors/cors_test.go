@@ -0,0 +1,139 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func newHandler(t *testing.T, policy Policy) http.Handler {
+	policy.Methods = []string{"GET", "POST"}
+	policy.Headers = []string{"Content-Type"}
+	policy.ExposedHeaders = []string{"ETag"}
+	policy.MaxAge = 10 * time.Minute
+	policy.Tenant = TenantFromPath("/tenant/")
+
+	c, err := New(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/tenant/{tenantID}/posts", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods(http.MethodGet, http.MethodPost)
+
+	return c.Middleware(router)
+}
+
+func send(h http.Handler, method string, path string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestPreflight(t *testing.T) {
+	h := newHandler(t, Policy{Origins: []string{"https://app.example.com"}})
+
+	w := send(h, http.MethodOptions, "/tenant/acme/posts", map[string]string{
+		"Origin":                         "https://app.example.com",
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type",
+	})
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected preflight to be answered with 204 instead of reaching the router, got %d", w.Code)
+	}
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Content-Type",
+		"Access-Control-Max-Age":       "600",
+	}
+
+	for header, value := range expected {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("Expected %s: %s, got %q", header, value, got)
+		}
+	}
+
+	w = send(h, http.MethodOptions, "/tenant/acme/posts", map[string]string{
+		"Origin":                        "https://evil.example.org",
+		"Access-Control-Request-Method": "POST",
+	})
+
+	if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected preflight from an unknown origin to be refused, got %d", w.Code)
+	}
+}
+
+func TestActualRequest(t *testing.T) {
+	h := newHandler(t, Policy{Origins: []string{"https://app.example.com"}, AllowCredentials: true})
+
+	w := send(h, http.MethodGet, "/tenant/acme/posts", map[string]string{"Origin": "https://app.example.com"})
+
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("Expected the origin to be allowed, got %d %v", w.Code, w.Header())
+	}
+
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" || w.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Errorf("Expected credentials and exposed headers, got %v", w.Header())
+	}
+
+	if w.Header().Get("Vary") != "Origin" {
+		t.Errorf("Expected Vary: Origin, got %q", w.Header().Get("Vary"))
+	}
+
+	w = send(h, http.MethodGet, "/tenant/acme/posts", map[string]string{"Origin": "https://other.example.com"})
+
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no CORS headers for an unknown origin, got %v", w.Header())
+	}
+}
+
+func TestWildcardAndTenantOrigins(t *testing.T) {
+	h := newHandler(t, Policy{
+		Origins:       []string{"https://*.example.com"},
+		TenantOrigins: map[string][]string{"acme": {"https://acme.blog"}},
+	})
+
+	cases := []struct {
+		path    string
+		origin  string
+		allowed bool
+	}{
+		{"/tenant/acme/posts", "https://www.example.com", true},
+		{"/tenant/acme/posts", "https://a.b.example.com", true},
+		{"/tenant/acme/posts", "https://example.com", false},
+		{"/tenant/acme/posts", "http://www.example.com", false},
+		{"/tenant/acme/posts", "https://badexample.com", false},
+		{"/tenant/acme/posts", "https://acme.blog", true},
+		{"/tenant/other/posts", "https://acme.blog", false},
+	}
+
+	for _, c := range cases {
+		w := send(h, http.MethodGet, c.path, map[string]string{"Origin": c.origin})
+		allowed := w.Header().Get("Access-Control-Allow-Origin") == c.origin
+
+		if allowed != c.allowed {
+			t.Errorf("Expected %s on %s allowed=%v, got %v", c.origin, c.path, c.allowed, allowed)
+		}
+	}
+}
+
+func TestInvalidOrigins(t *testing.T) {
+	for _, origin := range []string{"app.example.com", "ftp://example.com", "https://example.com/path"} {
+		if _, err := New(Policy{Origins: []string{origin}}); err == nil {
+			t.Errorf("Expected %q to be rejected", origin)
+		}
+	}
+}
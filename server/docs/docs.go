@@ -21,7 +21,130 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/v2/tenant/{tenantID}/posts": {
+        "/admin/indexes": {
+            "get": {
+                "description": "Compares the indexes of every tenant with the ones the repository declares",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Report index drift",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/post.IndexReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/tenants/{tenantID}/export": {
+            "get": {
+                "description": "Streams every post of the tenant, drafts included, as a zip archive of JSON and Markdown files",
+                "produces": [
+                    "application/zip"
+                ],
+                "summary": "Export a tenant",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenantID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": ""
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/tenants/{tenantID}/import": {
+            "post": {
+                "description": "Stores the posts of an archive made by Export in the tenant. conflict decides what happens to posts whose ID or slug is taken: skip (the default) keeps the stored post, overwrite replaces it and rename stores the imported post under a new ID or slug.",
+                "consumes": [
+                    "application/zip"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Import a tenant",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Tenant ID",
+                        "name": "tenantID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "skip, overwrite or rename",
+                        "name": "conflict",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/backup.Report"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/tenant/{tenantID}/posts": {
             "post": {
                 "description": "Create a new post with an auto-generated ID",
                 "consumes": [
@@ -59,26 +182,52 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responsehandler.Error"
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responsehandler.Error"
+                            "$ref": "#/definitions/responsehandler.Problem"
                         }
                     }
                 }
             }
         },
-        "/v2/tenant/{tenantID}/posts/{slug}": {
+        "/tenant/{tenantID}/posts/{slug}": {
             "get": {
-                "description": "Retrieve an existing post",
+                "description": "Retrieve an existing post\nThe Accept header selects JSON, the raw markdown or the rendered HTML",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "text/markdown",
+                    "text/html"
                 ],
                 "summary": "Retrieve a Post",
                 "parameters": [
@@ -95,6 +244,24 @@ const docTemplate = `{
                         "name": "slug",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "application/json, text/markdown or text/html",
+                        "name": "Accept",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a cached copy",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified of a cached copy",
+                        "name": "If-Modified-Since",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -102,12 +269,37 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/post.Post"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Changes with every version of the post"
+                            },
+                            "Last-Modified": {
+                                "type": "string",
+                                "description": "When the post last changed"
+                            }
                         }
                     },
+                    "304": {
+                        "description": "The cached copy is current"
+                    },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/responsehandler.Error"
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "406": {
+                        "description": "Not Acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
                         }
                     }
                 }
@@ -153,13 +345,37 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/responsehandler.Error"
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responsehandler.Error"
+                            "$ref": "#/definitions/responsehandler.Problem"
                         }
                     }
                 }
@@ -196,19 +412,102 @@ const docTemplate = `{
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/responsehandler.Error"
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) to a post. Only Title, Abstract, ContentRaw and Tags may be changed.",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Partially update a Post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Tenant ID",
+                        "name": "tenantID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Unique slug of the post",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/post.Post"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
                         }
                     },
-                    "502": {
-                        "description": "Bad Gateway",
+                    "413": {
+                        "description": "Request Entity Too Large",
                         "schema": {
-                            "$ref": "#/definitions/responsehandler.Error"
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
                         }
                     }
                 }
             }
         },
-        "/v2/tenant/{tenantID}/posts/{slug}/publish": {
+        "/tenant/{tenantID}/posts/{slug}/publish": {
             "put": {
                 "description": "Publshes an existing Post, adding the proper timestamps",
                 "consumes": [
@@ -238,16 +537,22 @@ const docTemplate = `{
                     "200": {
                         "description": ""
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/responsehandler.Error"
+                            "$ref": "#/definitions/responsehandler.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/responsehandler.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/responsehandler.Error"
+                            "$ref": "#/definitions/responsehandler.Problem"
                         }
                     }
                 }
@@ -255,6 +560,66 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "backup.Failure": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "file": {
+                    "type": "string"
+                }
+            }
+        },
+        "backup.Rename": {
+            "type": "object",
+            "properties": {
+                "fromId": {
+                    "type": "string"
+                },
+                "fromSlug": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "slug": {
+                    "type": "string"
+                }
+            }
+        },
+        "backup.Report": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "failures": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/backup.Failure"
+                    }
+                },
+                "overwritten": {
+                    "type": "integer"
+                },
+                "renamed": {
+                    "type": "integer"
+                },
+                "renames": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/backup.Rename"
+                    }
+                },
+                "skipped": {
+                    "type": "integer"
+                },
+                "tenant": {
+                    "type": "string"
+                }
+            }
+        },
         "post.CreatePostRequest": {
             "type": "object",
             "properties": {
@@ -264,11 +629,59 @@ const docTemplate = `{
                 "ContentRaw": {
                     "type": "string"
                 },
+                "Tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "Title": {
                     "type": "string"
                 }
             }
         },
+        "post.IndexDrift": {
+            "description": "Differences between the declared and the actual indexes of a tenant",
+            "type": "object",
+            "properties": {
+                "changed": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "missing": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "tenant": {
+                    "type": "string"
+                },
+                "unexpected": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "post.IndexReport": {
+            "description": "Index drift of every tenant",
+            "type": "object",
+            "properties": {
+                "inSync": {
+                    "type": "boolean"
+                },
+                "tenants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/post.IndexDrift"
+                    }
+                }
+            }
+        },
         "post.Post": {
             "type": "object",
             "properties": {
@@ -299,6 +712,12 @@ const docTemplate = `{
                 "Slug": {
                     "type": "string"
                 },
+                "Tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "Title": {
                     "type": "string"
                 },
@@ -318,15 +737,54 @@ const docTemplate = `{
                 }
             }
         },
-        "responsehandler.Error": {
-            "description": "Error message with HTTP status code and error message",
+        "responsehandler.Problem": {
+            "description": "RFC 7807 problem details with a stable error code and the request ID",
             "type": "object",
             "properties": {
-                "Message": {
+                "code": {
                     "type": "string"
                 },
-                "StatusCode": {
+                "detail": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/validation.FieldError"
+                    }
+                },
+                "instance": {
+                    "type": "string"
+                },
+                "partial": {
+                    "description": "Partial is what a request that failed part way did before it\nstopped, such as the report of an import."
+                },
+                "requestId": {
+                    "type": "string"
+                },
+                "status": {
                     "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "validation.FieldError": {
+            "description": "A single failing field of a request",
+            "type": "object",
+            "properties": {
+                "Code": {
+                    "type": "string"
+                },
+                "Field": {
+                    "type": "string"
+                },
+                "Message": {
+                    "type": "string"
                 }
             }
         }
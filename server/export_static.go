@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"glog/config"
+	"glog/logging"
+	"glog/post"
+	"glog/site"
+)
+
+// exportStatic runs `glog export-static`, which writes the blog of a tenant
+// as static files, and returns the exit code.
+func exportStatic(args []string) int {
+	return runCommand("export-static", args, func(fs *flag.FlagSet) func(context.Context, *config.Config, *post.Repository) error {
+		tenant := fs.String("tenant", "", "tenant to export")
+		out := fs.String("out", "", "directory to write the files to")
+		baseURL := fs.String("base-url", "", "absolute URL the files will be served from, feeds.base_url by default; required for the feed and the sitemap")
+		relative := fs.Bool("relative", false, "make links relative to each page")
+		feedItems := fs.Int("feed-items", 0, "number of posts in the feed, feeds.max_items by default; 0 leaves the feed out")
+		full := fs.Bool("full", false, "rewrite every file instead of only what changed since the last export")
+
+		return func(ctx context.Context, cfg *config.Config, pm *post.Repository) error {
+			if err := required(flagValue{"tenant", tenant}, flagValue{"out", out}); err != nil {
+				return err
+			}
+
+			// The feeds settings are the defaults of the flags, so that a
+			// blog's public URL is configured once.
+			given := make(map[string]bool)
+			fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+			if !given["base-url"] {
+				*baseURL = cfg.Feeds.BaseURL
+			}
+
+			if !given["feed-items"] && cfg.Feeds.Enabled {
+				*feedItems = cfg.Feeds.MaxItems
+			}
+
+			// Validate already checked the tenant themes.
+			theme := cfg.Site.Theme
+			if themes, _ := cfg.Site.ThemeByTenant(); themes[*tenant] != "" {
+				theme = themes[*tenant]
+			}
+
+			exporter := &site.Exporter{
+				Posts:     pm,
+				Themes:    site.NewThemes(cfg.Site.ThemesDir, false),
+				Theme:     theme,
+				PageSize:  cfg.Site.PageSize,
+				BaseURL:   *baseURL,
+				Relative:  *relative,
+				FeedItems: *feedItems,
+				Full:      *full,
+			}
+
+			if err := os.MkdirAll(*out, 0o755); err != nil {
+				return err
+			}
+
+			stats, err := exporter.Export(ctx, *tenant, *out)
+			if err != nil {
+				return err
+			}
+
+			logging.FromContext(ctx).Info("exported", "tenant", *tenant, "out", *out,
+				"written", stats.Written, "unchanged", stats.Unchanged, "removed", stats.Removed)
+			return nil
+		}
+	})
+}
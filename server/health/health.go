@@ -0,0 +1,163 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"glog/responsehandler"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+const DefaultTimeout = 2 * time.Second
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// CheckFunc reports whether a dependency is usable. It must honor ctx's
+// deadline.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name    string
+	timeout time.Duration
+	fn      CheckFunc
+}
+
+// CheckResult model info
+// @Description Outcome of a single readiness check
+type CheckResult struct {
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Report model info
+// @Description Overall health status with the result of every check
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker serves liveness and readiness endpoints. Readiness runs every
+// registered check and fails once the server starts shutting down, so load
+// balancers stop routing new requests to it.
+type Checker struct {
+	mu           sync.RWMutex
+	checks       []check
+	shuttingDown int32
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add registers a readiness check. A timeout of 0 uses DefaultTimeout.
+func (c *Checker) Add(name string, timeout time.Duration, fn CheckFunc) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, timeout: timeout, fn: fn})
+}
+
+// SetShuttingDown makes readiness fail from now on.
+func (c *Checker) SetShuttingDown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+func (c *Checker) isShuttingDown() bool {
+	return atomic.LoadInt32(&c.shuttingDown) == 1
+}
+
+// Check runs every registered check concurrently and reports the results.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(checks)+1),
+	}
+
+	if c.isShuttingDown() {
+		report.Status = StatusUnavailable
+		report.Checks["shutdown"] = CheckResult{Status: StatusUnavailable, Error: errShuttingDown.Error()}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, chk := range checks {
+		wg.Add(1)
+
+		go func(chk check) {
+			defer wg.Done()
+			result := run(ctx, chk)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[chk.name] = result
+
+			if result.Status != StatusOK {
+				report.Status = StatusUnavailable
+			}
+		}(chk)
+	}
+
+	wg.Wait()
+
+	return report
+}
+
+func run(ctx context.Context, chk check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, chk.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := chk.fn(ctx)
+
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	result := CheckResult{
+		Status:     StatusOK,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// Liveness answers 200 as long as the process can serve HTTP at all.
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	responsehandler.EncodeJSONResponse(w, Report{Status: StatusOK}, http.StatusOK, noStore)
+}
+
+// Readiness answers 200 if every check passes and 503 otherwise.
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	responsehandler.EncodeJSONResponse(w, report, status, noStore)
+}
+
+var noStore = map[string]string{"Cache-Control": "no-store"}
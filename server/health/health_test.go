@@ -0,0 +1,73 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ready(t *testing.T, c *Checker) (int, Report) {
+	w := httptest.NewRecorder()
+	c.Readiness(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Expected a JSON report, got %v", err)
+	}
+
+	return w.Code, report
+}
+
+func TestReadinessReportsEveryCheck(t *testing.T) {
+	c := NewChecker()
+	c.Add("ok", 0, func(ctx context.Context) error { return nil })
+	c.Add("broken", 0, func(ctx context.Context) error { return errors.New("boom") })
+
+	status, report := ready(t, c)
+
+	if status != http.StatusServiceUnavailable || report.Status != StatusUnavailable {
+		t.Errorf("Expected readiness to fail, got %d %s", status, report.Status)
+	}
+
+	if report.Checks["ok"].Status != StatusOK || report.Checks["broken"].Error != "boom" {
+		t.Errorf("Unexpected checks %v", report.Checks)
+	}
+}
+
+func TestReadinessTimesOutSlowChecks(t *testing.T) {
+	c := NewChecker()
+	c.Add("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if status, _ := ready(t, c); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected a timed out check to fail readiness, got %d", status)
+	}
+}
+
+func TestReadinessFailsDuringShutdown(t *testing.T) {
+	c := NewChecker()
+	c.Add("ok", 0, func(ctx context.Context) error { return nil })
+
+	if status, _ := ready(t, c); status != http.StatusOK {
+		t.Fatalf("Expected ready before shutdown, got %d", status)
+	}
+
+	c.SetShuttingDown()
+
+	if status, _ := ready(t, c); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected not ready during shutdown, got %d", status)
+	}
+
+	w := httptest.NewRecorder()
+	c.Liveness(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected liveness to keep passing, got %d", w.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ETag returns a strong entity tag identifying parts, such as a post ID and
+// its version.
+func ETag(parts ...string) string {
+	h := sha256.New()
+
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// Validators identify the representation a response carries. A zero
+// LastModified is not sent.
+type Validators struct {
+	ETag         string
+	LastModified time.Time
+}
+
+// NotModified sets the validator headers on w and reports whether r already
+// holds the current representation, in which case it has answered 304 and
+// the caller must not write a body. As in RFC 7232, If-None-Match takes
+// precedence over If-Modified-Since.
+func NotModified(w http.ResponseWriter, r *http.Request, v Validators) bool {
+	if v.ETag != "" {
+		w.Header().Set("ETag", v.ETag)
+	}
+
+	if !v.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", v.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !matchesAny(inm, v.ETag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !v.LastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err != nil || v.LastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// matchesAny compares etag with an If-None-Match list using the weak
+// comparison RFC 7232 prescribes for it.
+func matchesAny(header string, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Policy sets the headers that tell browsers and CDNs how to cache a
+// response.
+type Policy struct {
+	// CacheControl is sent as is; empty sends nothing.
+	CacheControl string
+	// SurrogateKeyHeader names the header carrying purge keys, such as
+	// Surrogate-Key (Fastly) or Cache-Tag (Cloudflare). Empty disables it.
+	SurrogateKeyHeader string
+}
+
+// Apply sets Cache-Control and the surrogate keys of the response.
+func (p Policy) Apply(w http.ResponseWriter, keys ...string) {
+	if p.CacheControl != "" {
+		w.Header().Set("Cache-Control", p.CacheControl)
+	}
+
+	if p.SurrogateKeyHeader != "" && len(keys) > 0 {
+		w.Header().Set(p.SurrogateKeyHeader, strings.Join(keys, " "))
+	}
+}
+
+// TenantKey is the surrogate key of everything served for a tenant.
+func TenantKey(tenantID string) string {
+	return "tenant:" + url.PathEscape(tenantID)
+}
+
+// PostKey is the surrogate key of everything showing one post.
+func PostKey(tenantID string, slug string) string {
+	return "post:" + url.PathEscape(tenantID) + ":" + url.PathEscape(slug)
+}
@@ -0,0 +1,86 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var modified = time.Date(2022, 5, 6, 7, 8, 9, 0, time.UTC)
+
+func check(headers map[string]string) (*httptest.ResponseRecorder, bool) {
+	r := httptest.NewRequest(http.MethodGet, "/tenant/1/posts/hello", nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	notModified := NotModified(w, r, Validators{ETag: ETag("id", "2"), LastModified: modified})
+
+	return w, notModified
+}
+
+func TestETagChangesWithVersion(t *testing.T) {
+	if ETag("id", "1") == ETag("id", "2") {
+		t.Errorf("Expected versions to have different ETags")
+	}
+
+	if ETag("id", "1") != ETag("id", "1") {
+		t.Errorf("Expected ETags to be stable")
+	}
+}
+
+func TestNotModifiedByETag(t *testing.T) {
+	w, ok := check(map[string]string{"If-None-Match": `"other", ` + ETag("id", "2")})
+
+	if !ok || w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", w.Code)
+	}
+
+	if w.Header().Get("ETag") != ETag("id", "2") || w.Header().Get("Last-Modified") == "" {
+		t.Errorf("Expected validators on the 304, got %v", w.Header())
+	}
+}
+
+func TestETagTakesPrecedenceOverDate(t *testing.T) {
+	_, ok := check(map[string]string{
+		"If-None-Match":     ETag("id", "1"),
+		"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat),
+	})
+
+	if ok {
+		t.Errorf("Expected a stale ETag to win over a recent date")
+	}
+}
+
+func TestNotModifiedSince(t *testing.T) {
+	if _, ok := check(map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}); !ok {
+		t.Errorf("Expected 304 for an unchanged post")
+	}
+
+	if _, ok := check(map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}); ok {
+		t.Errorf("Expected 200 for a post changed since")
+	}
+}
+
+func TestUnconditionalRequestsAreServed(t *testing.T) {
+	w, ok := check(nil)
+
+	if ok || w.Header().Get("ETag") == "" {
+		t.Errorf("Expected a full response with an ETag, got %v", w.Header())
+	}
+}
+
+func TestPolicySetsSurrogateKeys(t *testing.T) {
+	w := httptest.NewRecorder()
+	Policy{CacheControl: "public, max-age=60", SurrogateKeyHeader: "Surrogate-Key"}.Apply(w, TenantKey("1"), PostKey("1", "hello world"))
+
+	if got := w.Header().Get("Surrogate-Key"); got != "tenant:1 post:1:hello%20world" {
+		t.Errorf("Unexpected surrogate keys %q", got)
+	}
+
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("Unexpected Cache-Control %q", got)
+	}
+}
@@ -0,0 +1,383 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"glog/apperror"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// maxSourceFile bounds the files read from a site, as posts cannot be larger
+// anyway.
+const maxSourceFile = 4 << 20
+
+// postExtensions are the files of a site that hold posts.
+var postExtensions = map[string]bool{".md": true, ".markdown": true, ".mdown": true, ".html": true, ".htm": true}
+
+var jekyllName = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+// ReadJekyll reads the posts of a Jekyll site: _posts, named
+// YYYY-MM-DD-slug.md, and _drafts. Posts with published: false become
+// drafts.
+func ReadJekyll(fsys fs.FS) (*Result, error) {
+	res := &Result{}
+
+	for _, dir := range []string{"_posts", "_drafts"} {
+		err := walkPosts(fsys, dir, func(name string, fm frontMatter, body string) {
+			base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+
+			var date time.Time
+			if m := jekyllName.FindStringSubmatch(base); m != nil {
+				date, _ = time.Parse("2006-01-02", m[1])
+				base = m[2]
+			} else if dir == "_posts" {
+				res.skip(name, fm.string("title"), "is not named YYYY-MM-DD-title")
+				return
+			}
+
+			e := fm.entry(name, base, body, path.Ext(name))
+			e.Published = dir == "_posts" && fm.bool("published", true)
+
+			if created := fm.time("date"); !created.IsZero() {
+				date = created
+			}
+
+			e.CreatedAt = date
+			e.UpdatedAt = fm.time("last_modified_at", "updated", "modified")
+			if e.Published {
+				e.PublishedAt = date
+			}
+
+			if strings.Contains(e.Content, "{%") {
+				e.Notes = append(e.Notes, "kept Liquid tags such as {% include %} as text")
+			}
+
+			res.Entries = append(res.Entries, e)
+		}, res)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(res.Entries) == 0 && len(res.Skipped) == 0 {
+		return nil, errNoPosts("Jekyll site", "_posts or _drafts")
+	}
+
+	return res, nil
+}
+
+// ReadHugo reads the pages of a Hugo site's content directory, or of the
+// directory itself if it has none, as posts. Pages with draft: true become
+// drafts; section indexes (_index.md) are left out.
+func ReadHugo(fsys fs.FS) (*Result, error) {
+	root := "content"
+	if info, err := fs.Stat(fsys, root); err != nil || !info.IsDir() {
+		root = "."
+	}
+
+	res := &Result{}
+
+	err := walkPosts(fsys, root, func(name string, fm frontMatter, body string) {
+		base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+		if strings.HasPrefix(base, "_index") {
+			return
+		}
+
+		// Page bundles keep their content in index.md.
+		if base == "index" {
+			base = path.Base(path.Dir(name))
+		}
+
+		e := fm.entry(name, base, body, path.Ext(name))
+		e.Published = !fm.bool("draft", false)
+
+		if fm.bool("headless", false) {
+			res.skip(name, e.Title, "is a headless bundle")
+			return
+		}
+
+		e.CreatedAt = fm.time("date", "publishDate", "pubdate", "published")
+		e.UpdatedAt = fm.time("lastmod", "modified")
+		if e.Published {
+			e.PublishedAt = fm.time("publishDate", "pubdate", "published", "date")
+		}
+
+		if strings.Contains(e.Content, "{{<") || strings.Contains(e.Content, "{{%") {
+			e.Notes = append(e.Notes, "kept shortcodes such as {{< figure >}} as text")
+		}
+
+		res.Entries = append(res.Entries, e)
+	}, res)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Entries) == 0 && len(res.Skipped) == 0 {
+		return nil, errNoPosts("Hugo site", "content")
+	}
+
+	return res, nil
+}
+
+// walkPosts calls fn with the front matter and body of every post file under
+// dir. Files that cannot be read are skipped in res.
+func walkPosts(fsys fs.FS, dir string, fn func(name string, fm frontMatter, body string), res *Result) error {
+	err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil && name == dir && errors.Is(err, fs.ErrNotExist):
+			return fs.SkipDir
+		case err != nil:
+			return err
+		case d.IsDir():
+			if name != dir && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")) {
+				return fs.SkipDir
+			}
+			return nil
+		case !postExtensions[strings.ToLower(path.Ext(name))]:
+			return nil
+		}
+
+		b, err := readSourceFile(fsys, name)
+		if err != nil {
+			res.skip(name, "", "could not be read: %v", err)
+			return nil
+		}
+
+		fm, body, err := splitFrontMatter(b)
+		if err != nil {
+			res.skip(name, "", "has invalid front matter: %v", err)
+			return nil
+		}
+
+		fn(name, fm, body)
+		return nil
+	})
+
+	return err
+}
+
+func readSourceFile(fsys fs.FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(io.LimitReader(f, maxSourceFile+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > maxSourceFile {
+		return nil, fmt.Errorf("larger than %d bytes", maxSourceFile)
+	}
+
+	return b, nil
+}
+
+// frontMatter holds the fields of a post's front matter.
+type frontMatter map[string]interface{}
+
+// splitFrontMatter reads the YAML (---), TOML (+++) or JSON ({) front
+// matter at the start of a file and returns it with the rest of the file.
+func splitFrontMatter(b []byte) (frontMatter, string, error) {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	text := strings.ReplaceAll(string(b), "\r\n", "\n")
+	fm := frontMatter{}
+
+	if strings.HasPrefix(text, "{") {
+		dec := json.NewDecoder(strings.NewReader(text))
+		if err := dec.Decode(&fm); err != nil {
+			return nil, "", err
+		}
+
+		return fm, text[dec.InputOffset():], nil
+	}
+
+	for _, delimiter := range []string{"---", "+++"} {
+		if !strings.HasPrefix(text, delimiter+"\n") {
+			continue
+		}
+
+		rest := text[len(delimiter)+1:]
+
+		var raw, body string
+		if strings.HasPrefix(rest, delimiter) {
+			body = rest[len(delimiter):]
+		} else {
+			end := strings.Index(rest, "\n"+delimiter)
+			if end < 0 {
+				return nil, "", fmt.Errorf("it does not end with %s", delimiter)
+			}
+
+			raw, body = rest[:end], rest[end+1+len(delimiter):]
+		}
+
+		var err error
+		if delimiter == "---" {
+			err = yaml.Unmarshal([]byte(raw), &fm)
+		} else {
+			_, err = toml.Decode(raw, &fm)
+		}
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		return fm, body, nil
+	}
+
+	return fm, text, nil
+}
+
+// entry makes the fields shared by Jekyll and Hugo into an entry. slug is
+// used when the front matter has none.
+func (fm frontMatter) entry(name, slug, body, ext string) Entry {
+	e := Entry{
+		Source:   name,
+		Title:    fm.string("title"),
+		Slug:     slug,
+		Author:   fm.author(),
+		Abstract: fm.string("description", "summary", "excerpt", "subtitle"),
+		Content:  strings.TrimSpace(body),
+	}
+
+	if s := fm.string("slug"); s != "" {
+		e.Slug = s
+	}
+
+	if e.Title == "" {
+		e.Title = strings.ReplaceAll(slug, "-", " ")
+		e.Notes = append(e.Notes, "has no title; named after its file")
+	}
+
+	e.Tags = append(fm.list("tags"), fm.list("categories", "category")...)
+
+	if ext := strings.ToLower(ext); ext == ".html" || ext == ".htm" {
+		md, notes, err := HTMLToMarkdown(e.Content)
+		if err == nil {
+			e.Content = md
+			e.Notes = append(e.Notes, notes...)
+		}
+	}
+
+	return e
+}
+
+// string returns the first of keys that holds text.
+func (fm frontMatter) string(keys ...string) string {
+	for _, key := range keys {
+		if s, ok := fm[key].(string); ok && strings.TrimSpace(s) != "" {
+			return strings.TrimSpace(s)
+		}
+	}
+
+	return ""
+}
+
+func (fm frontMatter) bool(key string, fallback bool) bool {
+	switch v := fm[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true" || v == "yes"
+	}
+
+	return fallback
+}
+
+// list returns the values of keys, which may hold lists or space separated
+// words, as Jekyll allows.
+func (fm frontMatter) list(keys ...string) []string {
+	var values []string
+
+	for _, key := range keys {
+		switch v := fm[key].(type) {
+		case string:
+			values = append(values, strings.Fields(v)...)
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					values = append(values, s)
+				} else if item != nil {
+					values = append(values, fmt.Sprint(item))
+				}
+			}
+		}
+	}
+
+	return values
+}
+
+// author reads author as text, a list or a map with a name, and authors as
+// a list, keeping the first.
+func (fm frontMatter) author() string {
+	for _, key := range []string{"author", "authors"} {
+		switch v := fm[key].(type) {
+		case string:
+			return strings.TrimSpace(v)
+		case []interface{}:
+			if len(v) > 0 {
+				if s, ok := v[0].(string); ok {
+					return strings.TrimSpace(s)
+				}
+			}
+		case map[interface{}]interface{}:
+			if s, ok := v["name"].(string); ok {
+				return strings.TrimSpace(s)
+			}
+		case map[string]interface{}:
+			if s, ok := v["name"].(string); ok {
+				return strings.TrimSpace(s)
+			}
+		}
+	}
+
+	return ""
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// time returns the first of keys that holds a date. Dates without a zone
+// are read as UTC.
+func (fm frontMatter) time(keys ...string) time.Time {
+	for _, key := range keys {
+		switch v := fm[key].(type) {
+		case time.Time:
+			return v.UTC()
+		case string:
+			for _, layout := range dateLayouts {
+				if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+					return t.UTC()
+				}
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+func errNoPosts(site, dirs string) error {
+	return apperror.BadRequest("no_posts", fmt.Sprintf("no posts found; is this a %s? posts are read from %s", site, dirs))
+}
@@ -0,0 +1,204 @@
+package importer
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"glog/apperror"
+)
+
+type ghostData struct {
+	Posts []struct {
+		ID            string    `json:"id"`
+		Title         string    `json:"title"`
+		Slug          string    `json:"slug"`
+		HTML          string    `json:"html"`
+		Plaintext     string    `json:"plaintext"`
+		Status        string    `json:"status"`
+		Type          string    `json:"type"`
+		Page          ghostBool `json:"page"`
+		CustomExcerpt string    `json:"custom_excerpt"`
+		AuthorID      string    `json:"author_id"`
+		CreatedAt     ghostTime `json:"created_at"`
+		UpdatedAt     ghostTime `json:"updated_at"`
+		PublishedAt   ghostTime `json:"published_at"`
+	} `json:"posts"`
+	Tags []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"tags"`
+	PostsTags []struct {
+		PostID    string `json:"post_id"`
+		TagID     string `json:"tag_id"`
+		SortOrder int    `json:"sort_order"`
+	} `json:"posts_tags"`
+	Users []struct {
+		ID   string `json:"id"`
+		Slug string `json:"slug"`
+		Name string `json:"name"`
+	} `json:"users"`
+	PostsAuthors []struct {
+		PostID    string `json:"post_id"`
+		AuthorID  string `json:"author_id"`
+		SortOrder int    `json:"sort_order"`
+	} `json:"posts_authors"`
+}
+
+// ghostTime reads the dates of Ghost exports: ISO 8601 text in current
+// versions, milliseconds since the epoch in old ones.
+type ghostTime struct {
+	time.Time
+}
+
+func (t *ghostTime) UnmarshalJSON(b []byte) error {
+	if s, err := strconv.Unquote(string(b)); err == nil {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+			if parsed, err := time.Parse(layout, s); err == nil {
+				t.Time = parsed.UTC()
+				return nil
+			}
+		}
+
+		return nil
+	}
+
+	if ms, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+		t.Time = time.Unix(0, ms*int64(time.Millisecond)).UTC()
+	}
+
+	return nil
+}
+
+// ghostBool reads booleans that old exports write as 0 and 1.
+type ghostBool bool
+
+func (g *ghostBool) UnmarshalJSON(b []byte) error {
+	*g = ghostBool(string(b) == "true" || string(b) == "1")
+	return nil
+}
+
+// ReadGhost reads a Ghost JSON export. Published posts stay published;
+// drafts, scheduled posts and newsletters that were only emailed become
+// drafts. Pages are skipped.
+func ReadGhost(r io.Reader) (*Result, error) {
+	var export struct {
+		DB []struct {
+			Data *ghostData `json:"data"`
+		} `json:"db"`
+		Data *ghostData `json:"data"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, apperror.Wrap(apperror.KindBadRequest, "invalid_export", "the Ghost export is not valid JSON", err)
+	}
+
+	data := export.Data
+	if len(export.DB) > 0 {
+		data = export.DB[0].Data
+	}
+
+	if data == nil {
+		return nil, apperror.BadRequest("invalid_export", "the file is not a Ghost export: it has no data")
+	}
+
+	tags := make(map[string]string, len(data.Tags))
+	for _, tag := range data.Tags {
+		tags[tag.ID] = tag.Name
+	}
+
+	users := make(map[string]string, len(data.Users))
+	for _, user := range data.Users {
+		users[user.ID] = user.Slug
+		if user.Slug == "" {
+			users[user.ID] = user.Name
+		}
+	}
+
+	sort.SliceStable(data.PostsTags, func(i, j int) bool { return data.PostsTags[i].SortOrder < data.PostsTags[j].SortOrder })
+	sort.SliceStable(data.PostsAuthors, func(i, j int) bool { return data.PostsAuthors[i].SortOrder < data.PostsAuthors[j].SortOrder })
+
+	postTags := make(map[string][]string)
+	for _, pt := range data.PostsTags {
+		// Tags starting with # are internal to Ghost themes.
+		if name := tags[pt.TagID]; name != "" && !strings.HasPrefix(name, "#") {
+			postTags[pt.PostID] = append(postTags[pt.PostID], name)
+		}
+	}
+
+	postAuthors := make(map[string]string)
+	for _, pa := range data.PostsAuthors {
+		if _, ok := postAuthors[pa.PostID]; !ok {
+			postAuthors[pa.PostID] = users[pa.AuthorID]
+		}
+	}
+
+	res := &Result{}
+
+	for _, p := range data.Posts {
+		source := "post " + p.ID
+		title := strings.TrimSpace(p.Title)
+
+		if p.Type == "page" || bool(p.Page) {
+			res.skip(source, title, "is a page, not a post")
+			continue
+		}
+
+		e := Entry{
+			Source:      source,
+			Title:       title,
+			Slug:        p.Slug,
+			Tags:        postTags[p.ID],
+			Abstract:    p.CustomExcerpt,
+			CreatedAt:   p.CreatedAt.Time,
+			UpdatedAt:   p.UpdatedAt.Time,
+			PublishedAt: p.PublishedAt.Time,
+		}
+
+		e.Author = postAuthors[p.ID]
+		if e.Author == "" {
+			e.Author = users[p.AuthorID]
+		}
+
+		switch p.Status {
+		case "published":
+			e.Published = true
+		case "draft":
+		case "scheduled":
+			e.Notes = append(e.Notes, "was scheduled; imported as a draft")
+		case "sent":
+			e.Notes = append(e.Notes, "was only sent by email; imported as a draft")
+		default:
+			e.Notes = append(e.Notes, "has status "+strconv.Quote(p.Status)+"; imported as a draft")
+		}
+
+		if !e.Published {
+			e.PublishedAt = time.Time{}
+		}
+
+		switch {
+		case strings.TrimSpace(p.HTML) != "":
+			md, notes, err := HTMLToMarkdown(p.HTML)
+			if err != nil {
+				res.skip(source, title, "content could not be read: %v", err)
+				continue
+			}
+
+			e.Content = md
+			e.Notes = append(e.Notes, notes...)
+		case strings.TrimSpace(p.Plaintext) != "":
+			e.Content = escape(p.Plaintext)
+			e.Notes = append(e.Notes, "has no HTML in the export; imported its plain text")
+		default:
+			res.skip(source, title, "has no content in the export")
+			continue
+		}
+
+		res.Entries = append(res.Entries, e)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,485 @@
+// Package importer moves blogs from other platforms into a glog tenant.
+//
+// Each platform has a reader that turns its export into Entries: WordPress
+// WXR files, Jekyll and Hugo sites, and Ghost JSON exports. Run then turns
+// the entries into posts and stores them, or, on a dry run, only reports
+// what it would store. Whatever cannot be imported is skipped with a reason
+// rather than failing the whole import.
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"glog/apperror"
+	"glog/logging"
+	"glog/post"
+
+	"github.com/google/uuid"
+)
+
+// Entry is a post read from another platform, before it is checked against
+// the rules of glog posts.
+type Entry struct {
+	// Source tells where the entry came from, such as a file name or a
+	// WordPress item ID, for reports.
+	Source   string
+	Title    string
+	Slug     string
+	Author   string
+	Tags     []string
+	Abstract string
+	// Content is Markdown; readers convert HTML.
+	Content     string
+	Published   bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PublishedAt time.Time
+	// Notes are what the reader changed or left out.
+	Notes []string
+}
+
+// Skip is a post that is not imported, and why.
+type Skip struct {
+	Source string `json:"source"`
+	Title  string `json:"title,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Result is what a reader found in an export.
+type Result struct {
+	Entries []Entry
+	Skipped []Skip
+}
+
+func (res *Result) skip(source, title, format string, args ...interface{}) {
+	res.Skipped = append(res.Skipped, Skip{Source: source, Title: title, Reason: fmt.Sprintf(format, args...)})
+}
+
+// Formats are the formats Open reads.
+var Formats = []string{"wordpress", "jekyll", "hugo", "ghost"}
+
+// Open reads the export at path: a WXR file for wordpress, a site
+// directory for jekyll and hugo, and a JSON file for ghost.
+func Open(format, path string) (*Result, error) {
+	switch format {
+	case "jekyll":
+		return ReadJekyll(os.DirFS(path))
+	case "hugo":
+		return ReadHugo(os.DirFS(path))
+	case "wordpress", "ghost":
+	default:
+		return nil, apperror.BadRequest("invalid_format",
+			fmt.Sprintf("format must be one of %s, got %q", strings.Join(Formats, ", "), format))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == "wordpress" {
+		return ReadWordPress(f)
+	}
+
+	return ReadGhost(f)
+}
+
+// Target is where Run stores posts; *post.Repository is one. GetBySlug lets
+// dry runs tell which slugs are taken.
+type Target interface {
+	Import(ctx context.Context, tenantID string, p *post.Post, conflict post.Conflict) (post.ImportOutcome, error)
+	GetBySlug(ctx context.Context, tenantID string, slug string) (*post.Post, error)
+}
+
+// Options tune Run.
+type Options struct {
+	// DryRun reports what would be imported without storing anything.
+	DryRun bool
+	// Conflict decides what happens to posts whose slug is taken.
+	Conflict post.Conflict
+}
+
+// Report tells what Run did, or would do on a dry run.
+type Report struct {
+	Tenant      string `json:"tenant"`
+	DryRun      bool   `json:"dryRun"`
+	Created     int    `json:"created"`
+	Overwritten int    `json:"overwritten"`
+	Renamed     int    `json:"renamed"`
+	// Skipped counts the entries of Skips.
+	Skipped int    `json:"skipped"`
+	Posts   []Item `json:"posts"`
+	Skips   []Skip `json:"skips,omitempty"`
+}
+
+// Item is a post that was, or would be, stored.
+type Item struct {
+	Source    string             `json:"source"`
+	Title     string             `json:"title"`
+	Slug      string             `json:"slug"`
+	Published bool               `json:"published"`
+	Outcome   post.ImportOutcome `json:"outcome"`
+	Notes     []string           `json:"notes,omitempty"`
+}
+
+// Run stores the entries of res in a tenant. Entries that break the rules
+// of posts are skipped and reported; storage errors stop the run.
+func Run(ctx context.Context, target Target, tenantID string, res *Result, opts Options) (*Report, error) {
+	if opts.Conflict == "" {
+		opts.Conflict = post.ConflictSkip
+	}
+
+	report := &Report{Tenant: tenantID, DryRun: opts.DryRun, Skips: append([]Skip(nil), res.Skipped...)}
+
+	// The report is returned even when a storage error stops the run.
+	defer func() { report.Skipped = len(report.Skips) }()
+
+	// A dry run stores nothing, so it remembers the slugs its earlier
+	// entries would have taken.
+	claimed := make(map[string]bool)
+
+	for _, e := range res.Entries {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		p, notes, err := e.post()
+		if err != nil {
+			report.Skips = append(report.Skips, Skip{Source: e.Source, Title: e.Title, Reason: err.Error()})
+			continue
+		}
+
+		slug := p.Slug
+
+		var outcome post.ImportOutcome
+		if opts.DryRun {
+			outcome, err = predict(ctx, target, tenantID, p, opts.Conflict, claimed)
+		} else {
+			outcome, err = target.Import(ctx, tenantID, p, opts.Conflict)
+		}
+
+		switch apperror.KindOf(err) {
+		case apperror.KindValidation, apperror.KindConflict, apperror.KindBadRequest:
+			report.Skips = append(report.Skips, Skip{Source: e.Source, Title: p.Title, Reason: err.Error()})
+			continue
+		}
+
+		if err != nil {
+			return report, err
+		}
+
+		switch outcome {
+		case post.ImportSkipped:
+			report.Skips = append(report.Skips, Skip{Source: e.Source, Title: p.Title, Reason: fmt.Sprintf("slug %q is taken", slug)})
+			continue
+		case post.ImportCreated:
+			report.Created++
+		case post.ImportOverwritten:
+			report.Overwritten++
+		case post.ImportRenamed:
+			report.Renamed++
+			if p.Slug != slug {
+				notes = append(notes, fmt.Sprintf("slug %q is taken; stored as %q", slug, p.Slug))
+			}
+		}
+
+		report.Posts = append(report.Posts, Item{
+			Source:    e.Source,
+			Title:     p.Title,
+			Slug:      p.Slug,
+			Published: p.IsPublished,
+			Outcome:   outcome,
+			Notes:     notes,
+		})
+	}
+
+	logging.FromContext(ctx).Info("imported blog", "tenant", tenantID, "dryRun", opts.DryRun,
+		"created", report.Created, "overwritten", report.Overwritten, "renamed", report.Renamed, "skipped", len(report.Skips))
+
+	return report, nil
+}
+
+// predict tells what Import would do with p, given the slugs claimed by
+// the entries before it, and claims the slug p would be stored under.
+// Imported posts get new IDs, so only their slugs can conflict.
+func predict(ctx context.Context, target Target, tenantID string, p *post.Post, conflict post.Conflict, claimed map[string]bool) (post.ImportOutcome, error) {
+	taken, err := slugTaken(ctx, target, tenantID, p.Slug, claimed)
+	if err != nil {
+		return "", err
+	}
+
+	if !taken {
+		claimed[p.Slug] = true
+		return post.ImportCreated, nil
+	}
+
+	switch conflict {
+	case post.ConflictOverwrite:
+		return post.ImportOverwritten, nil
+	case post.ConflictRename:
+		// Import takes the smallest free suffix, from -2.
+		for n := 2; ; n++ {
+			candidate := p.Slug + "-" + strconv.Itoa(n)
+
+			taken, err := slugTaken(ctx, target, tenantID, candidate, claimed)
+			if err != nil {
+				return "", err
+			}
+
+			if !taken {
+				p.Slug = candidate
+				claimed[candidate] = true
+				return post.ImportRenamed, nil
+			}
+		}
+	}
+
+	return post.ImportSkipped, nil
+}
+
+func slugTaken(ctx context.Context, target Target, tenantID string, slug string, claimed map[string]bool) (bool, error) {
+	if claimed[slug] {
+		return true, nil
+	}
+
+	_, err := target.GetBySlug(ctx, tenantID, slug)
+	switch {
+	case apperror.Is(err, apperror.KindNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return true, nil
+}
+
+// post turns the entry into a post that follows the rules of new ones,
+// fixing what can be fixed and noting it.
+func (e Entry) post() (*post.Post, []string, error) {
+	notes := append([]string(nil), e.Notes...)
+
+	title := singleLine(e.Title)
+	if stripped := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\?#%`, r) {
+			return -1
+		}
+		return r
+	}, title); stripped != title {
+		// Titles cannot hold these characters, as they once made slugs.
+		notes = append(notes, fmt.Sprintf("removed / \\ ? # %% from the title %q", title))
+		title = strings.Join(strings.Fields(stripped), " ")
+	}
+
+	if utf8.RuneCountInString(title) > post.MaxTitleLength {
+		title = truncate(title, post.MaxTitleLength)
+		notes = append(notes, "shortened the title")
+	}
+
+	if title == "" {
+		return nil, nil, fmt.Errorf("has no title")
+	}
+
+	slug := e.Slug
+	if !validSlug(slug) {
+		if slug != "" {
+			notes = append(notes, fmt.Sprintf("slug %q cannot be part of a URL; made one from the title", slug))
+		}
+		slug = post.BuildSlug(title)
+	}
+
+	tags, tagNotes := cleanTags(e.Tags)
+	notes = append(notes, tagNotes...)
+
+	abstract := singleLine(e.Abstract)
+	if utf8.RuneCountInString(abstract) > post.MaxAbstractLength {
+		abstract = truncate(abstract, post.MaxAbstractLength)
+		notes = append(notes, "shortened the abstract")
+	}
+
+	p := &post.Post{
+		ID:          uuid.New().String(),
+		Slug:        slug,
+		Title:       title,
+		Abstract:    abstract,
+		ContentRaw:  multiLine(e.Content),
+		Tags:        tags,
+		AuthorID:    e.Author,
+		IsPublished: e.Published,
+		Version:     1,
+		CreatedAt:   e.CreatedAt,
+	}
+
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = e.PublishedAt
+	}
+
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now().UTC()
+		notes = append(notes, "has no date; dated now")
+	}
+
+	if e.UpdatedAt.After(p.CreatedAt) {
+		p.UpdatedAt = e.UpdatedAt
+	}
+
+	if p.IsPublished {
+		p.PublishedAt = e.PublishedAt
+		if p.PublishedAt.IsZero() {
+			p.PublishedAt = p.CreatedAt
+		}
+	}
+
+	err := post.CreatePostRequest{
+		Title:      p.Title,
+		Abstract:   p.Abstract,
+		ContentRaw: p.ContentRaw,
+		Tags:       p.Tags,
+	}.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return p, notes, nil
+}
+
+func validSlug(slug string) bool {
+	return slug != "" && !strings.ContainsAny(slug, `/\?#% `) && strings.IndexFunc(slug, func(r rune) bool {
+		return !unicode.IsPrint(r)
+	}) < 0
+}
+
+// cleanTags keeps what tags can hold and caps their number.
+func cleanTags(raw []string) ([]string, []string) {
+	var notes []string
+	var kept []string
+
+	for _, tag := range raw {
+		cleaned := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+				return r
+			}
+			return ' '
+		}, tag)
+
+		if utf8.RuneCountInString(strings.TrimSpace(cleaned)) > post.MaxTagLength {
+			notes = append(notes, fmt.Sprintf("dropped the tag %q, which is too long", tag))
+			continue
+		}
+
+		kept = append(kept, cleaned)
+	}
+
+	tags := post.NormalizeTags(kept)
+	if len(tags) > post.MaxTags {
+		notes = append(notes, fmt.Sprintf("kept the first %d of %d tags", post.MaxTags, len(tags)))
+		tags = tags[:post.MaxTags]
+	}
+
+	return tags, notes
+}
+
+// singleLine collapses all whitespace and drops what is not printable.
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(printable(s, false)), " ")
+}
+
+// multiLine drops what is not printable, keeping line breaks and tabs.
+func multiLine(s string) string {
+	return strings.TrimSpace(printable(strings.ReplaceAll(s, "\r\n", "\n"), true))
+}
+
+func printable(s string, multiLine bool) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case multiLine && (r == '\n' || r == '\t'):
+			return r
+		case unicode.IsSpace(r):
+			return ' '
+		case !unicode.IsPrint(r):
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+// WriteSummary writes what the import did, then what it skipped grouped by
+// reason, then what it changed in the posts it kept.
+func (r *Report) WriteSummary(w io.Writer) error {
+	var b strings.Builder
+
+	verb := "imported"
+	if r.DryRun {
+		verb = "would import"
+		fmt.Fprintln(&b, "dry run: nothing was stored")
+	}
+
+	fmt.Fprintf(&b, "%s %d posts into %s: %d created, %d overwritten, %d renamed; %d skipped\n",
+		verb, len(r.Posts), r.Tenant, r.Created, r.Overwritten, r.Renamed, r.Skipped)
+
+	if len(r.Skips) > 0 {
+		byReason := make(map[string][]Skip)
+		var reasons []string
+
+		for _, s := range r.Skips {
+			if byReason[s.Reason] == nil {
+				reasons = append(reasons, s.Reason)
+			}
+			byReason[s.Reason] = append(byReason[s.Reason], s)
+		}
+
+		sort.SliceStable(reasons, func(i, j int) bool {
+			return len(byReason[reasons[i]]) > len(byReason[reasons[j]])
+		})
+
+		fmt.Fprintln(&b, "\nskipped:")
+		for _, reason := range reasons {
+			fmt.Fprintf(&b, "  %s (%d)\n", reason, len(byReason[reason]))
+			for _, s := range byReason[reason] {
+				fmt.Fprintf(&b, "    %s%s\n", s.Source, quoted(s.Title))
+			}
+		}
+	}
+
+	noted := false
+	for _, item := range r.Posts {
+		if len(item.Notes) == 0 {
+			continue
+		}
+
+		if !noted {
+			fmt.Fprintln(&b, "\nchanged:")
+			noted = true
+		}
+
+		fmt.Fprintf(&b, "  %s%s\n", item.Source, quoted(item.Title))
+		for _, n := range item.Notes {
+			fmt.Fprintf(&b, "    %s\n", n)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func quoted(title string) string {
+	if title == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" %q", title)
+}
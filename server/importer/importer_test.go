@@ -0,0 +1,423 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"glog/apperror"
+	"glog/post"
+)
+
+const wxr = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"
+	xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<title>Blog</title>
+	<item>
+		<title>Hello World</title>
+		<dc:creator><![CDATA[ana]]></dc:creator>
+		<content:encoded><![CDATA[First paragraph
+with a break.
+
+<h2>Section</h2>
+[gallery ids="1,2"]]]></content:encoded>
+		<excerpt:encoded><![CDATA[<p>A <b>short</b> one.</p>]]></excerpt:encoded>
+		<wp:post_id>7</wp:post_id>
+		<wp:post_date><![CDATA[2020-01-02 12:00:00]]></wp:post_date>
+		<wp:post_date_gmt><![CDATA[2020-01-02 10:00:00]]></wp:post_date_gmt>
+		<wp:post_modified_gmt><![CDATA[2020-02-01 08:00:00]]></wp:post_modified_gmt>
+		<wp:post_name><![CDATA[hello-w%c3%b6rld]]></wp:post_name>
+		<wp:status><![CDATA[publish]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+		<category domain="category" nicename="uncategorized"><![CDATA[Uncategorized]]></category>
+		<category domain="post_tag" nicename="go"><![CDATA[Go]]></category>
+		<category domain="post_tag" nicename="web-dev"><![CDATA[Web Dev]]></category>
+	</item>
+	<item>
+		<title>Someday</title>
+		<content:encoded><![CDATA[<p>Soon.</p>]]></content:encoded>
+		<wp:post_id>8</wp:post_id>
+		<wp:post_date_gmt><![CDATA[0000-00-00 00:00:00]]></wp:post_date_gmt>
+		<wp:post_date><![CDATA[2021-05-06 07:08:09]]></wp:post_date>
+		<wp:status><![CDATA[future]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+	</item>
+	<item>
+		<title>Gone</title>
+		<wp:post_id>9</wp:post_id>
+		<wp:status><![CDATA[trash]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+	</item>
+	<item>
+		<title>About</title>
+		<wp:post_id>10</wp:post_id>
+		<wp:status><![CDATA[publish]]></wp:status>
+		<wp:post_type><![CDATA[page]]></wp:post_type>
+	</item>
+	<item>
+		<title>cat.png</title>
+		<wp:post_id>11</wp:post_id>
+		<wp:post_type><![CDATA[attachment]]></wp:post_type>
+	</item>
+</channel>
+</rss>`
+
+func TestReadWordPress(t *testing.T) {
+	res, err := ReadWordPress(strings.NewReader(wxr))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Entries) != 2 {
+		t.Fatalf("Expected 2 posts, got %+v", res.Entries)
+	}
+
+	e := res.Entries[0]
+	if e.Slug != "hello-wörld" || e.Author != "ana" || !e.Published || e.Abstract != "A short one." {
+		t.Errorf("Expected the fields of the first post, got %+v", e)
+	}
+
+	if !e.CreatedAt.Equal(time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)) || !e.UpdatedAt.Equal(time.Date(2020, 2, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the GMT dates, got %v and %v", e.CreatedAt, e.UpdatedAt)
+	}
+
+	if !reflect.DeepEqual(e.Tags, []string{"Go", "Web Dev"}) {
+		t.Errorf("Expected the tags without Uncategorized, got %v", e.Tags)
+	}
+
+	expected := "First paragraph\\\nwith a break.\n\n## Section\n\n\\[gallery ids=\"1,2\"\\]"
+	if e.Content != expected {
+		t.Errorf("Expected content %q, got %q", expected, e.Content)
+	}
+
+	if len(e.Notes) != 1 || !strings.Contains(e.Notes[0], "[gallery]") {
+		t.Errorf("Expected a note about the shortcode, got %v", e.Notes)
+	}
+
+	scheduled := res.Entries[1]
+	if scheduled.Published || !scheduled.CreatedAt.Equal(time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)) {
+		t.Errorf("Expected the scheduled post to be a dated draft, got %+v", scheduled)
+	}
+
+	expectedSkips := []Skip{
+		{Source: "item 9", Title: "Gone", Reason: "is in the trash"},
+		{Source: "item 10", Title: "About", Reason: "is a page, not a post"},
+	}
+	if !reflect.DeepEqual(res.Skipped, expectedSkips) {
+		t.Errorf("Expected skips %+v, got %+v", expectedSkips, res.Skipped)
+	}
+}
+
+func TestReadWordPressRejectsOtherFiles(t *testing.T) {
+	for _, input := range []string{"not xml <", `<feed xmlns="http://www.w3.org/2005/Atom"></feed>`} {
+		if _, err := ReadWordPress(strings.NewReader(input)); !apperror.Is(err, apperror.KindBadRequest) {
+			t.Errorf("Expected %q to be rejected, got %v", input, err)
+		}
+	}
+}
+
+func TestReadJekyll(t *testing.T) {
+	fsys := fstest.MapFS{
+		"_posts/2019-03-04-first-post.md": {Data: []byte("---\ntitle: First post\ntags: go web\ncategories: [notes]\nauthor:\n  name: Ana\n---\nHello {% include note.html %}\n")},
+		"_posts/2019-05-01-hidden.md":     {Data: []byte("---\ntitle: Hidden\npublished: false\ndate: 2019-05-01 10:30:00 +0200\n---\nNot yet.")},
+		"_posts/notes.txt":                {Data: []byte("ignored")},
+		"_posts/undated.md":               {Data: []byte("---\ntitle: Undated\n---\nNo date.")},
+		"_posts/2019-06-01-broken.md":     {Data: []byte("---\ntitle: [\n---\nBroken.")},
+		"_drafts/idea.html":               {Data: []byte("---\ntitle: Idea\n---\n<p>An <em>idea</em></p>")},
+	}
+
+	res, err := ReadJekyll(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Entries) != 3 || len(res.Skipped) != 2 {
+		t.Fatalf("Expected 3 posts and 2 skips, got %+v and %+v", res.Entries, res.Skipped)
+	}
+
+	first := res.Entries[0]
+	if first.Slug != "first-post" || first.Author != "Ana" || !first.Published || !first.CreatedAt.Equal(time.Date(2019, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the fields of the first post, got %+v", first)
+	}
+
+	if !reflect.DeepEqual(first.Tags, []string{"go", "web", "notes"}) || len(first.Notes) != 1 {
+		t.Errorf("Expected tags and a note about Liquid, got %v and %v", first.Tags, first.Notes)
+	}
+
+	hidden := res.Entries[1]
+	if hidden.Published || !hidden.CreatedAt.Equal(time.Date(2019, 5, 1, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected an unpublished post dated by its front matter, got %+v", hidden)
+	}
+
+	draft := res.Entries[2]
+	if draft.Published || draft.Slug != "idea" || draft.Content != "An *idea*" {
+		t.Errorf("Expected the draft to be converted from HTML, got %+v", draft)
+	}
+}
+
+func TestReadHugo(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.toml":                     {Data: []byte("title = 'site'")},
+		"content/_index.md":               {Data: []byte("---\ntitle: Home\n---\n")},
+		"content/posts/toml.md":           {Data: []byte("+++\ntitle = \"From TOML\"\ndate = 2022-07-08T09:10:11Z\nlastmod = 2022-08-01T00:00:00Z\ntags = [\"Hugo\"]\nslug = \"custom\"\n+++\nBody {{< figure src=\"a.png\" >}}\n")},
+		"content/posts/bundle/index.md":   {Data: []byte("---\ntitle: Bundled\ndraft: true\nauthors: [bo]\ndescription: About bundles\n---\nText")},
+		"content/posts/json.md":           {Data: []byte("{\"title\": \"From JSON\", \"date\": \"2022-01-02\"}\nJSON body")},
+		"content/posts/headless/index.md": {Data: []byte("---\ntitle: Parts\nheadless: true\n---\n")},
+		"content/posts/bundle/image.png":  {Data: []byte("png")},
+		"content/posts/unterminated.md":   {Data: []byte("---\ntitle: Oops\n")},
+	}
+
+	res, err := ReadHugo(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bySource := make(map[string]Entry)
+	for _, e := range res.Entries {
+		bySource[e.Source] = e
+	}
+
+	if len(res.Entries) != 3 || len(res.Skipped) != 2 {
+		t.Fatalf("Expected 3 posts and 2 skips, got %+v and %+v", res.Entries, res.Skipped)
+	}
+
+	toml := bySource["content/posts/toml.md"]
+	if toml.Slug != "custom" || !toml.Published || !toml.CreatedAt.Equal(time.Date(2022, 7, 8, 9, 10, 11, 0, time.UTC)) || !toml.UpdatedAt.Equal(time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the TOML front matter, got %+v", toml)
+	}
+
+	if len(toml.Notes) != 1 {
+		t.Errorf("Expected a note about the shortcode, got %v", toml.Notes)
+	}
+
+	bundle := bySource["content/posts/bundle/index.md"]
+	if bundle.Slug != "bundle" || bundle.Published || bundle.Author != "bo" || bundle.Abstract != "About bundles" {
+		t.Errorf("Expected the bundle to be a draft named after its directory, got %+v", bundle)
+	}
+
+	if json := bySource["content/posts/json.md"]; json.Title != "From JSON" || json.Content != "JSON body" {
+		t.Errorf("Expected the JSON front matter, got %+v", json)
+	}
+}
+
+func TestReadGhost(t *testing.T) {
+	export := `{"db": [{"meta": {"version": "5.0.0"}, "data": {
+		"posts": [
+			{"id": "p1", "title": "Ghostly", "slug": "ghostly", "html": "<p>Boo <a href=\"/x\">x</a></p>", "status": "published", "type": "post",
+			 "custom_excerpt": "Scary", "created_at": "2023-01-01T10:00:00.000Z", "updated_at": "2023-01-03T10:00:00.000Z", "published_at": "2023-01-02T10:00:00.000Z"},
+			{"id": "p2", "title": "Later", "slug": "later", "html": "<p>Soon</p>", "status": "scheduled", "type": "post", "published_at": "2030-01-01T00:00:00.000Z"},
+			{"id": "p3", "title": "About", "slug": "about", "html": "<p>Me</p>", "status": "published", "type": "page"},
+			{"id": "p4", "title": "Empty", "slug": "empty", "status": "draft", "type": "post", "mobiledoc": "{}"}
+		],
+		"tags": [{"id": "t1", "name": "Spooky"}, {"id": "t2", "name": "#hidden"}, {"id": "t3", "name": "Tales"}],
+		"posts_tags": [{"post_id": "p1", "tag_id": "t3", "sort_order": 1}, {"post_id": "p1", "tag_id": "t2", "sort_order": 2}, {"post_id": "p1", "tag_id": "t1", "sort_order": 0}],
+		"users": [{"id": "u1", "slug": "casper", "name": "Casper"}],
+		"posts_authors": [{"post_id": "p1", "author_id": "u1", "sort_order": 0}]
+	}}]}`
+
+	res, err := ReadGhost(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Entries) != 2 || len(res.Skipped) != 2 {
+		t.Fatalf("Expected 2 posts and 2 skips, got %+v and %+v", res.Entries, res.Skipped)
+	}
+
+	e := res.Entries[0]
+	if e.Content != "Boo [x](/x)" || e.Author != "casper" || e.Abstract != "Scary" || !e.Published {
+		t.Errorf("Expected the fields of the post, got %+v", e)
+	}
+
+	if !reflect.DeepEqual(e.Tags, []string{"Spooky", "Tales"}) {
+		t.Errorf("Expected the public tags in order, got %v", e.Tags)
+	}
+
+	if !e.PublishedAt.Equal(time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the publication date, got %v", e.PublishedAt)
+	}
+
+	if later := res.Entries[1]; later.Published || !later.PublishedAt.IsZero() || len(later.Notes) != 1 {
+		t.Errorf("Expected the scheduled post to be a draft, got %+v", later)
+	}
+}
+
+// fakeTarget stores posts by slug.
+type fakeTarget struct {
+	stored map[string]*post.Post
+}
+
+func (t *fakeTarget) Import(ctx context.Context, tenantID string, p *post.Post, conflict post.Conflict) (post.ImportOutcome, error) {
+	if _, ok := t.stored[p.Slug]; ok {
+		switch conflict {
+		case post.ConflictSkip:
+			return post.ImportSkipped, nil
+		case post.ConflictRename:
+			p.Slug += "-2"
+			t.stored[p.Slug] = p
+			return post.ImportRenamed, nil
+		}
+
+		t.stored[p.Slug] = p
+		return post.ImportOverwritten, nil
+	}
+
+	t.stored[p.Slug] = p
+	return post.ImportCreated, nil
+}
+
+func (t *fakeTarget) GetBySlug(ctx context.Context, tenantID string, slug string) (*post.Post, error) {
+	if p, ok := t.stored[slug]; ok {
+		return p, nil
+	}
+
+	return nil, apperror.NotFound("post_not_found", "no such post")
+}
+
+func entries() *Result {
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	return &Result{
+		Entries: []Entry{
+			{Source: "a.md", Title: "Taken", Slug: "taken", Content: "A", Published: true, CreatedAt: at},
+			{Source: "b.md", Title: "50% off: why?", Slug: "bad/slug", Content: "B", Tags: []string{"C++", "Go", "go"}, CreatedAt: at, UpdatedAt: at.Add(-time.Hour)},
+			{Source: "c.md", Title: "", Content: "No title"},
+			{Source: "d.md", Title: "Huge", Content: strings.Repeat("x", post.MaxContentLength+1)},
+		},
+		Skipped: []Skip{{Source: "e.md", Reason: "is in the trash"}},
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	target := &fakeTarget{stored: map[string]*post.Post{"taken": {Slug: "taken"}}}
+
+	report, err := Run(context.Background(), target, "acme", entries(), Options{DryRun: true, Conflict: post.ConflictRename})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(target.stored) != 1 {
+		t.Errorf("Expected a dry run to store nothing, got %v", target.stored)
+	}
+
+	if report.Created != 1 || report.Renamed != 1 || report.Skipped != 3 || len(report.Posts) != 2 {
+		t.Errorf("Expected 1 post created, 1 renamed and 3 skipped, got %+v", report)
+	}
+
+	item := report.Posts[1]
+	if item.Slug != "50-off:-why" || item.Title != "50 off: why" || item.Published {
+		t.Errorf("Expected a slug made from the cleaned title, got %+v", item)
+	}
+
+	if len(item.Notes) != 2 {
+		t.Errorf("Expected notes about the title and the slug, got %v", item.Notes)
+	}
+
+	var summary bytes.Buffer
+	if err := report.WriteSummary(&summary); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"dry run: nothing was stored",
+		"would import 2 posts into acme: 1 created, 0 overwritten, 1 renamed; 3 skipped",
+		"  is in the trash (1)\n    e.md\n",
+		"  has no title (1)\n    c.md\n",
+		"changed:\n  a.md \"Taken\"\n    slug \"taken\" is taken; stored as \"taken-2\"\n  b.md \"50 off: why\"\n",
+	} {
+		if !strings.Contains(summary.String(), expected) {
+			t.Errorf("Expected the summary to contain %q, got\n%s", expected, summary.String())
+		}
+	}
+}
+
+func TestRunStoresPosts(t *testing.T) {
+	target := &fakeTarget{stored: map[string]*post.Post{"taken": {Slug: "taken"}}}
+
+	report, err := Run(context.Background(), target, "acme", entries(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Created != 1 || report.Skipped != 4 {
+		t.Errorf("Expected 1 post created and the taken slug skipped, got %+v", report)
+	}
+
+	p := target.stored["50-off:-why"]
+	if p == nil {
+		t.Fatalf("Expected the post to be stored, got %v", target.stored)
+	}
+
+	if p.ID == "" || p.Version != 1 || !p.UpdatedAt.IsZero() || !p.PublishedAt.IsZero() {
+		t.Errorf("Expected a new draft, got %+v", p)
+	}
+
+	if !reflect.DeepEqual(p.Tags, []string{"c", "go"}) {
+		t.Errorf("Expected cleaned tags, got %v", p.Tags)
+	}
+}
+
+func TestDryRunCountsSlugsTakenEarlierInTheRun(t *testing.T) {
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := &Result{Entries: []Entry{
+		{Source: "_posts/2020-01-01-hello.md", Title: "Hello", Slug: "hello", Content: "A", Published: true, CreatedAt: at},
+		{Source: "_drafts/hello.md", Title: "Hello", Slug: "hello", Content: "B", CreatedAt: at},
+		{Source: "_drafts/hello-again.md", Title: "Hello", Slug: "hello", Content: "C", CreatedAt: at},
+	}}
+
+	for conflict, expected := range map[post.Conflict][]string{
+		post.ConflictSkip:   {"hello"},
+		post.ConflictRename: {"hello", "hello-3", "hello-4"},
+	} {
+		target := &fakeTarget{stored: map[string]*post.Post{"hello-2": {Slug: "hello-2"}}}
+
+		report, err := Run(context.Background(), target, "acme", res, Options{DryRun: true, Conflict: conflict})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var slugs []string
+		for _, item := range report.Posts {
+			slugs = append(slugs, item.Slug)
+		}
+
+		if !reflect.DeepEqual(slugs, expected) || report.Created != 1 {
+			t.Errorf("Expected a %s dry run to store %v with 1 created, got %v and %+v", conflict, expected, slugs, report)
+		}
+	}
+}
+
+// failingTarget fails to store anything after the first post.
+type failingTarget struct {
+	fakeTarget
+}
+
+func (t *failingTarget) Import(ctx context.Context, tenantID string, p *post.Post, conflict post.Conflict) (post.ImportOutcome, error) {
+	if len(t.stored) > 0 {
+		return "", apperror.Unavailable("storage_unavailable", "the post storage is unavailable", nil)
+	}
+
+	return t.fakeTarget.Import(ctx, tenantID, p, conflict)
+}
+
+func TestStoppedRunCountsItsSkips(t *testing.T) {
+	res := entries()
+	res.Entries = append(res.Entries[2:], res.Entries[:2]...)
+
+	report, err := Run(context.Background(), &failingTarget{fakeTarget{stored: map[string]*post.Post{}}}, "acme", res, Options{})
+	if apperror.KindOf(err) != apperror.KindUnavailable {
+		t.Fatalf("Expected the storage error, got %v", err)
+	}
+
+	if report.Created != 1 || report.Skipped != 3 || report.Skipped != len(report.Skips) {
+		t.Errorf("Expected 1 post created and 3 skipped before the failure, got %+v", report)
+	}
+}
@@ -0,0 +1,465 @@
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToMarkdown converts the HTML of a post to the Markdown glog stores.
+// It covers what blog posts use: paragraphs, headings, emphasis, links,
+// images, lists, quotes, code and tables. Scripts, styles and embedded
+// players are dropped, and the returned notes say so, since posts cannot
+// carry raw HTML.
+func HTMLToMarkdown(src string) (string, []string, error) {
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return "", nil, err
+	}
+
+	c := &converter{}
+	md := strings.Join(c.children(doc), "\n\n")
+
+	return md, c.notes, nil
+}
+
+type converter struct {
+	notes []string
+}
+
+func (c *converter) note(format string, args ...interface{}) {
+	n := fmt.Sprintf(format, args...)
+	for _, existing := range c.notes {
+		if existing == n {
+			return
+		}
+	}
+
+	c.notes = append(c.notes, n)
+}
+
+// blockElements start blocks of their own; everything else flows into the
+// surrounding paragraph.
+var blockElements = map[atom.Atom]bool{
+	atom.Html: true, atom.Body: true, atom.Head: true,
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Header: true, atom.Footer: true, atom.Main: true, atom.Aside: true, atom.Nav: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Details: true, atom.Summary: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Hr: true, atom.Table: true, atom.Address: true,
+}
+
+// dropped elements are left out with their content.
+var dropped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Form: true, atom.Input: true, atom.Button: true, atom.Select: true, atom.Textarea: true,
+	atom.Svg: true, atom.Title: true, atom.Meta: true, atom.Link: true,
+}
+
+// embeds are players and frames, which Markdown cannot hold.
+var embeds = map[atom.Atom]bool{
+	atom.Iframe: true, atom.Video: true, atom.Audio: true, atom.Object: true, atom.Embed: true,
+}
+
+func isBlock(n *html.Node) bool {
+	return n.Type == html.ElementNode && (blockElements[n.DataAtom] || dropped[n.DataAtom] || embeds[n.DataAtom])
+}
+
+// children renders the children of n as blocks, gathering inline content
+// into paragraphs.
+func (c *converter) children(n *html.Node) []string {
+	var blocks []string
+	var para strings.Builder
+
+	flush := func() {
+		if p := paragraph(para.String()); p != "" {
+			blocks = append(blocks, p)
+		}
+		para.Reset()
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if isBlock(child) {
+			flush()
+			blocks = append(blocks, c.block(child)...)
+			continue
+		}
+
+		para.WriteString(c.inline(child))
+	}
+
+	flush()
+	return blocks
+}
+
+var headings = map[atom.Atom]int{atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6}
+
+func (c *converter) block(n *html.Node) []string {
+	switch {
+	case dropped[n.DataAtom]:
+		return nil
+	case embeds[n.DataAtom]:
+		c.note("dropped embedded %s elements", n.Data)
+		if src := attr(n, "src"); src != "" {
+			return []string{fmt.Sprintf("[%s](%s)", src, destination(src))}
+		}
+		return nil
+	case headings[n.DataAtom] > 0:
+		if text := paragraph(c.inlineChildren(n)); text != "" {
+			return []string{strings.Repeat("#", headings[n.DataAtom]) + " " + strings.ReplaceAll(text, "\\\n", " ")}
+		}
+		return nil
+	case n.DataAtom == atom.Figcaption:
+		if text := paragraph(c.inlineChildren(n)); text != "" {
+			return []string{"*" + text + "*"}
+		}
+		return nil
+	case n.DataAtom == atom.Hr:
+		return []string{"---"}
+	case n.DataAtom == atom.Pre:
+		return []string{c.pre(n)}
+	case n.DataAtom == atom.Blockquote:
+		return []string{prefixLines(strings.Join(c.children(n), "\n\n"), "> ", ">")}
+	case n.DataAtom == atom.Ul || n.DataAtom == atom.Ol:
+		if list := c.list(n); list != "" {
+			return []string{list}
+		}
+		return nil
+	case n.DataAtom == atom.Table:
+		if table := c.table(n); table != "" {
+			return []string{table}
+		}
+		return nil
+	}
+
+	return c.children(n)
+}
+
+func (c *converter) list(n *html.Node) string {
+	var items []string
+	number := 1
+
+	if n.DataAtom == atom.Ol {
+		fmt.Sscanf(attr(n, "start"), "%d", &number)
+	}
+
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+
+		body := strings.Join(c.children(li), "\n\n")
+		indent := strings.Repeat(" ", len(marker))
+		items = append(items, marker+strings.TrimPrefix(prefixLines(body, indent, ""), indent))
+	}
+
+	return strings.Join(items, "\n")
+}
+
+func (c *converter) pre(n *html.Node) string {
+	code := n
+	if child := firstElement(n); child != nil && child.DataAtom == atom.Code {
+		code = child
+	}
+
+	language := ""
+	for _, class := range strings.Fields(attr(code, "class") + " " + attr(n, "class")) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if strings.HasPrefix(class, prefix) && language == "" {
+				language = strings.TrimPrefix(class, prefix)
+			}
+		}
+	}
+
+	text := strings.TrimRight(textContent(code), "\n")
+
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+
+	return fence + language + "\n" + text + "\n" + fence
+}
+
+func (c *converter) table(n *html.Node) string {
+	var rows [][]string
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+
+			switch child.DataAtom {
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(child)
+			case atom.Tr:
+				var row []string
+				for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+						text := paragraph(c.inlineChildren(cell))
+						text = strings.ReplaceAll(strings.ReplaceAll(text, "\\\n", " "), "|", "\\|")
+						row = append(row, text)
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	walk(n)
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	if columns == 0 {
+		return ""
+	}
+
+	line := func(cells []string) string {
+		for len(cells) < columns {
+			cells = append(cells, "")
+		}
+		return "| " + strings.Join(cells, " | ") + " |"
+	}
+
+	separator := make([]string, columns)
+	for i := range separator {
+		separator[i] = "---"
+	}
+
+	// GFM tables need a header row; the first row serves as one.
+	lines := []string{line(rows[0]), line(separator)}
+
+	for _, row := range rows[1:] {
+		lines = append(lines, line(row))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (c *converter) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(c.inline(child))
+	}
+
+	return b.String()
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+func (c *converter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return escape(whitespace.ReplaceAllString(n.Data, " "))
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch {
+	case dropped[n.DataAtom]:
+		return ""
+	case embeds[n.DataAtom]:
+		c.note("dropped embedded %s elements", n.Data)
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return "\\\n"
+	case atom.Strong, atom.B:
+		return wrap(c.inlineChildren(n), "**")
+	case atom.Em, atom.I, atom.Cite:
+		return wrap(c.inlineChildren(n), "*")
+	case atom.Del, atom.S, atom.Strike:
+		return wrap(c.inlineChildren(n), "~~")
+	case atom.Code, atom.Kbd, atom.Tt, atom.Samp:
+		return code(textContent(n))
+	case atom.Img:
+		src := attr(n, "src")
+		if src == "" {
+			return ""
+		}
+		return "![" + escape(attr(n, "alt")) + "](" + destination(src) + title(attr(n, "title")) + ")"
+	case atom.A:
+		text := c.inlineChildren(n)
+		href := attr(n, "href")
+		if href == "" || strings.TrimSpace(text) == "" {
+			return text
+		}
+		return "[" + text + "](" + destination(href) + title(attr(n, "title")) + ")"
+	}
+
+	// Blocks nested in inline elements, e.g. a div in a link, flow inline.
+	return c.inlineChildren(n) + blockSpace(n)
+}
+
+// blockSpace keeps the words of neighbouring blocks apart when they are
+// rendered inline.
+func blockSpace(n *html.Node) string {
+	if blockElements[n.DataAtom] {
+		return " "
+	}
+
+	return ""
+}
+
+// wrap puts markers around s, keeping its outer spaces outside, as
+// Markdown requires.
+func wrap(s, marker string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+
+	start := s[:strings.Index(s, trimmed)]
+	end := s[len(start)+len(trimmed):]
+
+	return start + marker + trimmed + marker + end
+}
+
+func code(s string) string {
+	s = whitespace.ReplaceAllString(s, " ")
+	if s == "" {
+		return ""
+	}
+
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		return fence + " " + s + " " + fence
+	}
+
+	return fence + s + fence
+}
+
+var escaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`,
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+var (
+	blockStart    = regexp.MustCompile(`^(#|>|[-+] |\d+[.)] )`)
+	leadingNumber = regexp.MustCompile(`^\d+`)
+)
+
+// paragraph trims inline content and escapes what would otherwise start a
+// heading, quote or list.
+func paragraph(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, line := range lines {
+		line = strings.TrimLeft(line, " ")
+		if blockStart.MatchString(line) {
+			if loc := leadingNumber.FindStringIndex(line); loc != nil {
+				line = line[:loc[1]] + `\` + line[loc[1]:]
+			} else {
+				line = `\` + line
+			}
+		}
+		lines[i] = line
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func prefixLines(s, prefix, emptyPrefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = emptyPrefix
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// destination writes a link destination, in angle brackets if it has
+// spaces or parentheses.
+func destination(url string) string {
+	url = strings.TrimSpace(url)
+	if strings.ContainsAny(url, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(url) + ">"
+	}
+
+	return url
+}
+
+func title(t string) string {
+	if t == "" {
+		return ""
+	}
+
+	return ` "` + strings.ReplaceAll(t, `"`, `\"`) + `"`
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+func firstElement(n *html.Node) *html.Node {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode {
+			return child
+		}
+	}
+
+	return nil
+}
+
+// plainText reads the text of an HTML fragment, on one line.
+func plainText(fragment string) string {
+	doc, err := html.Parse(strings.NewReader(fragment))
+	if err != nil {
+		return ""
+	}
+
+	return singleLine(textContent(doc))
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.DataAtom == atom.Br {
+			b.WriteString("\n")
+			continue
+		}
+
+		b.WriteString(textContent(child))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	for _, tc := range []struct {
+		html     string
+		expected string
+	}{
+		{"<p>Hello <strong>big</strong> <em>world</em></p><p>Second</p>", "Hello **big** *world*\n\nSecond"},
+		{"<h2>Title <code>x</code></h2>", "## Title `x`"},
+		{`<p><a href="https://example.com/a b">link</a> and <img src="/cat.png" alt="a cat"></p>`, "[link](<https://example.com/a b>) and ![a cat](/cat.png)"},
+		{"<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>", "- one\n- two\n\n  1. nested"},
+		{`<ol start="3"><li>three</li></ol>`, "3. three"},
+		{"<blockquote><p>quoted</p><p>twice</p></blockquote>", "> quoted\n>\n> twice"},
+		{`<pre><code class="language-go">if a &lt; b {
+}</code></pre>`, "```go\nif a < b {\n}\n```"},
+		{"<p>line<br>break</p><hr>", "line\\\nbreak\n\n---"},
+		{"<table><tr><th>a</th><th>b</th></tr><tr><td>1|2</td></tr></table>", "| a | b |\n| --- | --- |\n| 1\\|2 |  |"},
+		{"<p>2019. A year</p><p>*stars* and [brackets]</p>", "2019\\. A year\n\n\\*stars\\* and \\[brackets\\]"},
+		{"<script>alert(1)</script><p>kept</p>", "kept"},
+		{"<figure><img src=\"a.png\"><figcaption>Caption</figcaption></figure>", "![](a.png)\n\n*Caption*"},
+	} {
+		md, _, err := HTMLToMarkdown(tc.html)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if md != tc.expected {
+			t.Errorf("Expected %q to convert to\n%q, got\n%q", tc.html, tc.expected, md)
+		}
+	}
+}
+
+func TestHTMLToMarkdownNotesEmbeds(t *testing.T) {
+	md, notes, err := HTMLToMarkdown(`<p>Watch:</p><iframe src="https://video.example/1"></iframe><iframe src="https://video.example/2"></iframe>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if md != "Watch:\n\n[https://video.example/1](https://video.example/1)\n\n[https://video.example/2](https://video.example/2)" {
+		t.Errorf("Expected embeds to become links, got %q", md)
+	}
+
+	if !reflect.DeepEqual(notes, []string{"dropped embedded iframe elements"}) {
+		t.Errorf("Expected one note about the embeds, got %v", notes)
+	}
+}
@@ -0,0 +1,234 @@
+package importer
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"glog/apperror"
+)
+
+// wxrItem is an item of a WordPress export. Elements are matched by local
+// name only, as the wp namespace changes with the WXR version.
+type wxrItem struct {
+	Title       string `xml:"title"`
+	PubDate     string `xml:"pubDate"`
+	Creator     string `xml:"creator"`
+	PostID      string `xml:"post_id"`
+	PostDate    string `xml:"post_date"`
+	PostDateGMT string `xml:"post_date_gmt"`
+	ModifiedGMT string `xml:"post_modified_gmt"`
+	PostName    string `xml:"post_name"`
+	Status      string `xml:"status"`
+	PostType    string `xml:"post_type"`
+	// Encoded holds both content:encoded and excerpt:encoded.
+	Encoded []struct {
+		XMLName xml.Name
+		Text    string `xml:",chardata"`
+	} `xml:"encoded"`
+	Categories []struct {
+		Domain string `xml:"domain,attr"`
+		Name   string `xml:",chardata"`
+	} `xml:"category"`
+}
+
+// wxrIgnored are the item types WordPress uses for its own bookkeeping; they
+// are left out of reports.
+var wxrIgnored = map[string]bool{
+	"attachment": true, "nav_menu_item": true, "revision": true, "custom_css": true,
+	"customize_changeset": true, "oembed_cache": true, "user_request": true,
+}
+
+// ReadWordPress reads a WordPress export (WXR) file. Published posts stay
+// published; drafts, pending, private and scheduled posts become drafts.
+// Trashed posts, pages and other item types are skipped.
+func ReadWordPress(r io.Reader) (*Result, error) {
+	dec := xml.NewDecoder(r)
+	// WXR files are UTF-8, but some declare another charset out of habit.
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	res := &Result{}
+	channel := false
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, apperror.Wrap(apperror.KindBadRequest, "invalid_export", "the WordPress export is not valid XML", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "channel":
+			channel = true
+		case "item":
+			var item wxrItem
+			if err := dec.DecodeElement(&item, &start); err != nil {
+				return nil, apperror.Wrap(apperror.KindBadRequest, "invalid_export", "the WordPress export is not valid XML", err)
+			}
+
+			item.read(res)
+		}
+	}
+
+	if !channel {
+		return nil, apperror.BadRequest("invalid_export", "the file is not a WordPress export: it has no RSS channel")
+	}
+
+	return res, nil
+}
+
+func (item wxrItem) read(res *Result) {
+	source := "item " + strings.TrimSpace(item.PostID)
+	title := strings.TrimSpace(item.Title)
+
+	if postType := strings.TrimSpace(item.PostType); postType != "post" && postType != "" {
+		if !wxrIgnored[postType] && !strings.HasPrefix(postType, "wp_") {
+			res.skip(source, title, "is a %s, not a post", postType)
+		}
+		return
+	}
+
+	e := Entry{
+		Source: source,
+		Title:  title,
+		Author: strings.TrimSpace(item.Creator),
+	}
+
+	switch status := strings.TrimSpace(item.Status); status {
+	case "publish":
+		e.Published = true
+	case "draft", "pending":
+	case "private":
+		e.Notes = append(e.Notes, "was private; imported as a draft")
+	case "future":
+		e.Notes = append(e.Notes, "was scheduled; imported as a draft")
+	case "trash":
+		res.skip(source, title, "is in the trash")
+		return
+	case "auto-draft", "inherit":
+		res.skip(source, title, "is an autosave")
+		return
+	default:
+		e.Notes = append(e.Notes, fmt.Sprintf("has status %q; imported as a draft", status))
+	}
+
+	if slug, err := url.PathUnescape(strings.TrimSpace(item.PostName)); err == nil {
+		e.Slug = slug
+	}
+
+	e.CreatedAt = wxrDate(item.PostDateGMT, item.PostDate, item.PubDate)
+	e.UpdatedAt = wxrDate(item.ModifiedGMT)
+	if e.Published {
+		e.PublishedAt = e.CreatedAt
+	}
+
+	for _, c := range item.Categories {
+		if c.Domain == "post_tag" || c.Domain == "category" {
+			if name := strings.TrimSpace(c.Name); name != "" && name != "Uncategorized" {
+				e.Tags = append(e.Tags, name)
+			}
+		}
+	}
+
+	var content string
+	for _, enc := range item.Encoded {
+		if strings.Contains(enc.XMLName.Space, "excerpt") {
+			e.Abstract = plainText(enc.Text)
+		} else {
+			content = enc.Text
+		}
+	}
+
+	if strings.TrimSpace(content) == "" {
+		res.skip(source, title, "has no content")
+		return
+	}
+
+	content = wxrCaptions.ReplaceAllString(content, "")
+	if shortcodes := wxrShortcode.FindAllStringSubmatch(content, 3); len(shortcodes) > 0 {
+		var names []string
+		for _, s := range shortcodes {
+			names = append(names, "["+s[1]+"]")
+		}
+		e.Notes = append(e.Notes, "kept shortcodes such as "+strings.Join(names, " ")+" as text")
+	}
+
+	md, notes, err := HTMLToMarkdown(autop(content))
+	if err != nil {
+		res.skip(source, title, "content could not be read: %v", err)
+		return
+	}
+
+	e.Content = md
+	e.Notes = append(e.Notes, notes...)
+	res.Entries = append(res.Entries, e)
+}
+
+var (
+	wxrCaptions  = regexp.MustCompile(`\[/?caption[^\]]*\]`)
+	wxrShortcode = regexp.MustCompile(`\[([a-z][a-z0-9_-]*)(?:\s[^\]]*)?\]`)
+)
+
+// wxrDate parses the first of values that holds a date. WordPress writes
+// zeros for posts that were never published.
+func wxrDate(values ...string) time.Time {
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || strings.HasPrefix(v, "0000-00-00") {
+			continue
+		}
+
+		for _, layout := range []string{"2006-01-02 15:04:05", time.RFC1123Z, time.RFC1123} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.UTC()
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+var (
+	blankLines = regexp.MustCompile(`\n\s*\n`)
+	blockTag   = regexp.MustCompile(`(?i)^<(!--|/?(p|div|h[1-6]|ul|ol|li|pre|blockquote|table|figure|hr|dl|section|iframe|script|style|address)\b)`)
+)
+
+// autop wraps the paragraphs of classic WordPress content, which are only
+// separated by blank lines, in p elements, and turns its line breaks into
+// br elements, as WordPress does when it shows a post.
+func autop(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	var b strings.Builder
+	inPre := 0
+
+	for _, chunk := range blankLines.Split(content, -1) {
+		trimmed := strings.TrimSpace(chunk)
+
+		if inPre > 0 || trimmed == "" || blockTag.MatchString(trimmed) {
+			b.WriteString(chunk)
+		} else {
+			b.WriteString("<p>" + strings.ReplaceAll(trimmed, "\n", "<br>\n") + "</p>")
+		}
+
+		b.WriteString("\n\n")
+		inPre += strings.Count(strings.ToLower(chunk), "<pre") - strings.Count(strings.ToLower(chunk), "</pre")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,193 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"glog/logging"
+)
+
+// Hook is a named step of the application's startup and shutdown. Start
+// runs during startup in registration order, Stop during shutdown in reverse
+// order. Either may be nil.
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+}
+
+// App runs hooks and background workers, waits for a termination signal or
+// a fatal error, and then shuts everything down within ShutdownTimeout.
+type App struct {
+	ShutdownTimeout time.Duration
+	// OnShutdown runs as soon as shutdown begins, before any hook is
+	// stopped. It is used to fail readiness while requests still drain.
+	OnShutdown func()
+	// DrainDelay is how long shutdown waits after OnShutdown before it
+	// stops anything, so load balancers see the failing readiness probe
+	// and stop sending requests before the listeners close. It does not
+	// count against ShutdownTimeout.
+	DrainDelay time.Duration
+
+	logger  *logging.Logger
+	hooks   []Hook
+	started []Hook
+
+	workers      sync.WaitGroup
+	workerCtx    context.Context
+	stopWorkers  context.CancelFunc
+	failures     chan error
+	shutdownOnce sync.Once
+}
+
+func New(logger *logging.Logger, shutdownTimeout time.Duration) *App {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &App{
+		ShutdownTimeout: shutdownTimeout,
+		logger:          logger,
+		workerCtx:       ctx,
+		stopWorkers:     cancel,
+		failures:        make(chan error, 1),
+	}
+}
+
+// Append registers a hook. Hooks start in the order they are appended.
+func (a *App) Append(h Hook) {
+	a.hooks = append(a.hooks, h)
+}
+
+// Go runs a background worker. Its context is cancelled when shutdown
+// begins and shutdown waits for it to return. A worker returning an error
+// other than context.Canceled stops the application.
+func (a *App) Go(name string, worker func(ctx context.Context) error) {
+	a.workers.Add(1)
+
+	go func() {
+		defer a.workers.Done()
+
+		if err := worker(a.workerCtx); err != nil && !errors.Is(err, context.Canceled) {
+			a.Fail(fmt.Errorf("worker %s: %w", name, err))
+		}
+	}()
+}
+
+// Fail reports a fatal error from a running component, which makes Run shut
+// the application down.
+func (a *App) Fail(err error) {
+	select {
+	case a.failures <- err:
+	default:
+	}
+}
+
+// Run starts every hook and blocks until ctx is done, SIGINT or SIGTERM is
+// received, or a component fails. It then shuts down and returns the first
+// fatal error, if any.
+func (a *App) Run(ctx context.Context) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := a.start(ctx); err != nil {
+		// Nothing was ready yet, so there is nothing to drain.
+		a.shutdown(false)
+		return err
+	}
+
+	var runErr error
+
+	select {
+	case <-ctx.Done():
+		a.logger.Info("context cancelled, shutting down")
+	case sig := <-signals:
+		a.logger.Info("received signal, shutting down", "signal", sig.String())
+	case runErr = <-a.failures:
+		a.logger.Error("component failed, shutting down", "error", runErr)
+	}
+
+	if err := a.shutdown(true); err != nil && runErr == nil {
+		runErr = err
+	}
+
+	return runErr
+}
+
+func (a *App) start(ctx context.Context) error {
+	for _, h := range a.hooks {
+		if h.Start != nil {
+			a.logger.Info("starting", "component", h.Name)
+
+			if err := h.Start(ctx); err != nil {
+				return fmt.Errorf("starting %s: %w", h.Name, err)
+			}
+		}
+
+		a.started = append(a.started, h)
+	}
+
+	return nil
+}
+
+// shutdown stops background workers first, while the dependencies they may
+// use are still up, and then the started hooks in reverse order. Every hook
+// gets to run even if an earlier one fails or the deadline passes. With
+// drain, it waits DrainDelay after OnShutdown before stopping anything.
+func (a *App) shutdown(drain bool) error {
+	var firstErr error
+
+	a.shutdownOnce.Do(func() {
+		if a.OnShutdown != nil {
+			a.OnShutdown()
+		}
+
+		if drain && a.DrainDelay > 0 {
+			a.logger.Info("draining before shutdown", "delay", a.DrainDelay.String())
+			time.Sleep(a.DrainDelay)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), a.ShutdownTimeout)
+		defer cancel()
+
+		stopped := make(chan struct{})
+		a.stopWorkers()
+
+		go func() {
+			a.workers.Wait()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			a.logger.Warn("background workers did not stop before the shutdown deadline")
+		}
+
+		for i := len(a.started) - 1; i >= 0; i-- {
+			h := a.started[i]
+			if h.Stop == nil {
+				continue
+			}
+
+			a.logger.Info("stopping", "component", h.Name)
+
+			if err := h.Stop(ctx); err != nil {
+				a.logger.Error("could not stop component", "component", h.Name, "error", err)
+
+				if firstErr == nil {
+					firstErr = fmt.Errorf("stopping %s: %w", h.Name, err)
+				}
+			}
+		}
+
+		a.logger.Info("shutdown complete")
+	})
+
+	return firstErr
+}
@@ -0,0 +1,133 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"glog/logging"
+)
+
+var quiet = logging.New(io.Discard, logging.LevelError, logging.FormatText)
+
+func TestRunStartsInOrderAndStopsInReverse(t *testing.T) {
+	var calls []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	app := New(quiet, time.Second)
+	app.OnShutdown = func() { calls = append(calls, "shutdown") }
+	app.Append(Hook{Name: "db", Start: record("start db"), Stop: record("stop db")})
+	app.Append(Hook{Name: "http", Start: record("start http"), Stop: record("stop http")})
+
+	workerStopped := false
+	app.Go("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		workerStopped = true
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := app.Run(ctx); err != nil {
+		t.Fatalf("Expected a clean shutdown, got %v", err)
+	}
+
+	expected := []string{"start db", "start http", "shutdown", "stop http", "stop db"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected %v, got %v", expected, calls)
+	}
+
+	if !workerStopped {
+		t.Errorf("Expected the worker to be stopped")
+	}
+}
+
+func TestShutdownDrainsBeforeStoppingHooks(t *testing.T) {
+	var shuttingDown, httpStopped time.Time
+
+	app := New(quiet, time.Second)
+	app.DrainDelay = 50 * time.Millisecond
+	app.OnShutdown = func() { shuttingDown = time.Now() }
+	app.Append(Hook{Name: "http", Stop: func(context.Context) error { httpStopped = time.Now(); return nil }})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := app.Run(ctx); err != nil {
+		t.Fatalf("Expected a clean shutdown, got %v", err)
+	}
+
+	if shuttingDown.IsZero() || httpStopped.IsZero() {
+		t.Fatalf("Expected readiness to fail and http to stop")
+	}
+
+	if waited := httpStopped.Sub(shuttingDown); waited < app.DrainDelay {
+		t.Errorf("Expected http to stop at least %s after readiness failed, got %s", app.DrainDelay, waited)
+	}
+}
+
+func TestRunStopsOnlyStartedHooksWhenStartupFails(t *testing.T) {
+	stopped := false
+
+	app := New(quiet, time.Second)
+	// Startup failed before anything was ready, so there is nothing to drain.
+	app.DrainDelay = time.Hour
+	app.Append(Hook{Name: "db", Stop: func(context.Context) error { stopped = true; return nil }})
+	app.Append(Hook{Name: "http", Start: func(context.Context) error { return errors.New("port in use") }})
+	app.Append(Hook{Name: "never", Stop: func(context.Context) error { t.Error("Expected never to be stopped"); return nil }})
+
+	if err := app.Run(context.Background()); err == nil {
+		t.Fatalf("Expected the startup error")
+	}
+
+	if !stopped {
+		t.Errorf("Expected started hooks to be stopped")
+	}
+}
+
+func TestFailingWorkerShutsDown(t *testing.T) {
+	app := New(quiet, time.Second)
+	app.Go("worker", func(ctx context.Context) error { return errors.New("boom") })
+
+	if err := app.Run(context.Background()); err == nil {
+		t.Errorf("Expected the worker error")
+	}
+}
+
+func TestRetryBacksOffUntilSuccess(t *testing.T) {
+	attempts := 0
+	b := Backoff{Initial: time.Millisecond, Max: 2 * time.Millisecond, Multiplier: 2, MaxElapsed: time.Second}
+
+	err := Retry(context.Background(), "test", b, func(context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success on the third attempt, got %v after %d", err, attempts)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	b := Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1, MaxElapsed: 10 * time.Millisecond}
+
+	err := Retry(context.Background(), "test", b, func(context.Context) error {
+		return errors.New("down")
+	})
+
+	if err == nil || err.Error() != "down" {
+		t.Errorf("Expected the last error, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package lifecycle
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"glog/logging"
+)
+
+// Backoff configures Retry. Delays grow from Initial by Multiplier up to
+// Max, with up to 20% random jitter. Retry gives up after MaxElapsed.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	MaxElapsed time.Duration
+}
+
+var DefaultBackoff = Backoff{
+	Initial:    500 * time.Millisecond,
+	Max:        10 * time.Second,
+	Multiplier: 2,
+	MaxElapsed: time.Minute,
+}
+
+// Retry calls fn until it succeeds, ctx is done or b.MaxElapsed has passed,
+// sleeping between attempts. It returns the last error from fn.
+func Retry(ctx context.Context, name string, b Backoff, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	delay := b.Initial
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if time.Since(start)+delay > b.MaxElapsed {
+			return err
+		}
+
+		wait := delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+		logging.FromContext(ctx).Warn("retrying", "operation", name, "attempt", attempt, "wait_ms", wait.Milliseconds(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		delay = time.Duration(float64(delay) * b.Multiplier)
+		if delay > b.Max {
+			delay = b.Max
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package logging
+
+import "context"
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the logger stored in ctx, or the default logger.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey).(*Logger); ok {
+		return l
+	}
+
+	return Default()
+}
+
+// WithFields returns a copy of ctx whose logger adds kv to every line.
+func WithFields(ctx context.Context, kv ...interface{}) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(kv...))
+}
+
+// RequestID returns the ID of the request ctx belongs to, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
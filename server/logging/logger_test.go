@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggerHonorsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, LevelWarn, FormatJSON)
+
+	l.Info("hidden")
+	l.Warn("shown", "tenant", "t1")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected one line, got %d", len(lines))
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Expected a JSON line, got %s", lines[0])
+	}
+
+	if entry["msg"] != "shown" || entry["level"] != "warn" || entry["tenant"] != "t1" {
+		t.Errorf("Unexpected entry %v", entry)
+	}
+}
+
+func TestTextFormatQuotesValues(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, LevelDebug, FormatText).With("slug", "a-post").Debug("two words")
+
+	if !strings.Contains(buf.String(), `msg="two words" slug=a-post`) {
+		t.Errorf("Unexpected line %s", buf.String())
+	}
+}
+
+func TestRequestIDIsPropagatedOrGenerated(t *testing.T) {
+	var seen string
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if seen != "abc-123" || w.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("Expected request ID to be propagated, got %s", seen)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "has spaces")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if seen == "" || seen == "has spaces" {
+		t.Errorf("Expected a generated request ID, got %q", seen)
+	}
+}
@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"unicode"
+
+	"glog/middleware"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware propagates the X-Request-ID header of the request, or
+// generates a new ID when it is missing or unusable. The ID is echoed in the
+// response and attached to the request's logger.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+
+		r.Header.Set(RequestIDHeader, id)
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		ctx = WithFields(ctx, "request_id", id)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) || r == ' ' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AccessLog writes one line per request once the response is finished.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := middleware.NewRecorder(w)
+
+		next.ServeHTTP(rec, r)
+
+		FromContext(r.Context()).Info("request completed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.Status,
+			"bytes", rec.Bytes,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// RouteFields attaches the tenant and slug of the matched route to the
+// request's logger. It must run as a mux middleware so the route variables
+// are known.
+func RouteFields(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		var kv []interface{}
+		if tenant, ok := vars["tenantID"]; ok {
+			kv = append(kv, "tenant", tenant)
+		}
+
+		if slug, ok := vars["slug"]; ok {
+			kv = append(kv, "slug", slug)
+		}
+
+		if len(kv) > 0 {
+			r = r.WithContext(WithFields(r.Context(), kv...))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,25 +1,43 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"glog/auth"
+	"glog/backup"
+	"glog/cache"
 	"glog/config"
+	"glog/cors"
+	"glog/health"
+	"glog/lifecycle"
+	"glog/logging"
+	"glog/metrics"
+	"glog/middleware"
 	"glog/post"
-	"log"
+	"glog/ratelimit"
+	"glog/request"
+	"glog/responsehandler"
+	"glog/site"
+	"glog/tlsconfig"
+	"glog/tracing"
+	"glog/web"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 
 	_ "glog/docs"
 
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
-func testHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-}
-
 // @title Glog - A Go Blogging backend using Mongo
 // @version 1.0
 // @description Very simple implementation of a bloggin platform using Mongo as a data store and Go with gorilla/mux.
@@ -31,38 +49,430 @@ func testHandler(w http.ResponseWriter, r *http.Request) {
 // @host blog.abaltra.me/api
 // @BasePath /v1
 func main() {
-	fmt.Println("Starting glog")
-	config := config.NewConfig()
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
+	fs := flag.NewFlagSet("glog", flag.ExitOnError)
+	printConfig := fs.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	loader := config.NewLoader(fs)
+	fs.Parse(os.Args[1:])
+
+	cfg, err := loader.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *printConfig {
+		cfg.WriteRedacted(os.Stdout)
+		return
+	}
+
+	// Both were validated when the configuration was loaded.
+	logLevel, _ := logging.ParseLevel(cfg.Log.Level)
+	logFormat, _ := logging.ParseFormat(cfg.Log.Format)
+
+	logger := logging.New(os.Stdout, logLevel, logFormat)
+	logging.SetDefault(logger)
+	logger.Info("starting glog", "env", cfg.Env)
+
+	app := lifecycle.New(logger, cfg.Server.ShutdownTimeout)
+
+	var shutdownTracing func(context.Context) error
+	app.Append(lifecycle.Hook{
+		Name: "tracing",
+		Start: func(ctx context.Context) error {
+			var err error
+			shutdownTracing, err = tracing.Setup(ctx, tracing.Options{
+				Endpoint:    cfg.Tracing.OTLPEndpoint,
+				Insecure:    cfg.Tracing.OTLPInsecure,
+				SampleRatio: cfg.Tracing.SampleRatio,
+			})
+			return err
+		},
+		Stop: func(ctx context.Context) error {
+			return shutdownTracing(ctx)
+		},
+	})
+
+	m := metrics.New()
+
 	pm := &post.Repository{
-		Config: config,
+		Config:  cfg,
+		Metrics: m,
 	}
 
-	pm.Init()
-	pm.Ping()
+	backoff := lifecycle.DefaultBackoff
+	backoff.MaxElapsed = cfg.Storage.ConnectTimeout
+
+	app.Append(lifecycle.Hook{
+		Name: "mongo",
+		Start: func(ctx context.Context) error {
+			return lifecycle.Retry(ctx, "mongo connect", backoff, pm.Connect)
+		},
+		Stop: pm.Disconnect,
+	})
+
+	app.Append(lifecycle.Hook{
+		Name: "mongo indexes",
+		Start: func(ctx context.Context) error {
+			// A tenant whose indexes cannot be built, e.g. because of
+			// duplicate slugs, must not keep the others from being served.
+			if err := pm.ReconcileIndexes(ctx); err != nil {
+				logger.Error("could not reconcile indexes, see /admin/indexes", "error", err)
+			}
+
+			return nil
+		},
+	})
+
+	migrator := &post.Migrator{Repository: pm}
+
+	app.Append(lifecycle.Hook{
+		Name: "mongo schema",
+		Start: func(ctx context.Context) error {
+			pending, err := migrator.Plan(ctx)
+			if err != nil || pending == 0 {
+				return err
+			}
+
+			app.Go("schema-migration", func(ctx context.Context) error {
+				return migrator.Run(logging.NewContext(ctx, logger))
+			})
+
+			return nil
+		},
+	})
 
 	ph := &post.Handler{
 		Repository: pm,
+		Metrics:    m,
+		HTTPCache:  cfg.HTTPCache,
+	}
+
+	checker := health.NewChecker()
+	checker.Add("mongo", 2*time.Second, pm.Ping)
+
+	var store cache.Store
+	switch cfg.Cache.Driver {
+	case "memory":
+		store = cache.NewLRU(cfg.Cache.MaxEntries)
+	case "redis":
+		rdb := cache.NewRedis(redis.NewClient(&redis.Options{
+			Addr:     cfg.Cache.RedisAddr,
+			Password: cfg.Cache.RedisPassword,
+			DB:       cfg.Cache.RedisDB,
+		}), cfg.Cache.RedisPrefix)
+		checker.Add("redis", 0, rdb.Ping)
+		store = rdb
+	}
+
+	if store != nil {
+		pm.Cache = cache.New(store, cfg.Cache.TTL)
+		// Storage timeouts of requests are shorter than the write timeout.
+		pm.Cache.Timeout = cfg.Server.WriteTimeout
+		m.RegisterCache(pm.Cache)
+
+		app.Append(lifecycle.Hook{
+			Name: "cache",
+			Stop: func(ctx context.Context) error {
+				return pm.Cache.Close()
+			},
+		})
+	}
+	app.OnShutdown = checker.SetShuttingDown
+	app.DrainDelay = cfg.Server.DrainDelay
+
+	// limit wraps a route handler with the limits of its class.
+	limit := func(class ratelimit.Class, h http.Handler) http.Handler {
+		return h
+	}
+
+	if rl := cfg.RateLimit; rl.Enabled {
+		var store ratelimit.Store = ratelimit.NewMemory()
+		if rl.Store == "redis" {
+			rdb := ratelimit.NewRedis(redis.NewClient(&redis.Options{
+				Addr:     cfg.Cache.RedisAddr,
+				Password: cfg.Cache.RedisPassword,
+				DB:       cfg.Cache.RedisDB,
+			}), cfg.Cache.RedisPrefix+"ratelimit:")
+			checker.Add("redis-ratelimit", 0, rdb.Ping)
+			store = rdb
+		}
+
+		rule := func(limits config.RateLimits) ratelimit.Rule {
+			return ratelimit.Rule{
+				Client: ratelimit.Limit{Requests: limits.Client, Period: rl.Period},
+				Tenant: ratelimit.Limit{Requests: limits.Tenant, Period: rl.Period},
+			}
+		}
+
+		limiter, err := ratelimit.NewLimiter(store, map[ratelimit.Class]ratelimit.Rule{
+			ratelimit.Read:   rule(rl.Read),
+			ratelimit.Write:  rule(rl.Write),
+			ratelimit.Search: rule(rl.Search),
+		}, cfg.Auth.APIKeys, rl.TrustedProxies)
+		if err != nil {
+			logger.Error("invalid rate limit settings", "error", err)
+			os.Exit(1)
+		}
+		limiter.Metrics = m
+
+		limit = func(class ratelimit.Class, h http.Handler) http.Handler {
+			return limiter.Middleware(class)(h)
+		}
+
+		app.Append(lifecycle.Hook{
+			Name: "rate limit",
+			Stop: func(ctx context.Context) error {
+				return store.Close()
+			},
+		})
 	}
 
 	router := mux.NewRouter()
+	router.Use(
+		otelmux.Middleware(tracing.ServiceName),
+		tracing.RouteAttributes,
+		logging.RouteFields,
+	)
 
 	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
-	router.HandleFunc("/test", testHandler)
-	router.HandleFunc("/tenant/{tenantID}/posts", ph.List).Methods(http.MethodGet)
-	router.HandleFunc("/tenant/{tenantID/posts", ph.Create).Methods(http.MethodPost)
-	router.HandleFunc("/tenant/{tenantID}/posts/{slug}", ph.Get).Methods(http.MethodGet)
-	router.HandleFunc("/tenant/{tenantID}/posts/{slug}", ph.Delete).Methods(http.MethodDelete)
-	router.HandleFunc("/tenant/{tenantID}/posts/{slug}", ph.Update).Methods(http.MethodPost)
-	router.HandleFunc("/tenant/{tenantID}/posts/{slug}/publish", ph.Publish).Methods(http.MethodPut)
+	router.Handle("/metrics", m.Handler()).Methods(http.MethodGet)
+	router.HandleFunc("/healthz", checker.Liveness).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", checker.Readiness).Methods(http.MethodGet)
+	// body caps the request body of a route.
+	body := func(route string, h http.HandlerFunc) http.Handler {
+		return request.LimitBody(cfg.Server.BodyLimits.For(route))(h)
+	}
+
+	router.Handle("/tenant/{tenantID}/posts", limit(ratelimit.Read, http.HandlerFunc(ph.List))).Methods(http.MethodGet)
+	router.Handle("/tenant/{tenantID}/posts", limit(ratelimit.Write, body("create", ph.Create))).Methods(http.MethodPost)
+	router.Handle("/tenant/{tenantID}/posts/{slug}", limit(ratelimit.Read, http.HandlerFunc(ph.Get))).Methods(http.MethodGet)
+	router.Handle("/tenant/{tenantID}/posts/{slug}", limit(ratelimit.Write, http.HandlerFunc(ph.Delete))).Methods(http.MethodDelete)
+	router.Handle("/tenant/{tenantID}/posts/{slug}", limit(ratelimit.Write, body("update", ph.Update))).Methods(http.MethodPost)
+	router.Handle("/tenant/{tenantID}/posts/{slug}", limit(ratelimit.Write, body("patch", ph.Patch))).Methods(http.MethodPatch)
+	router.Handle("/tenant/{tenantID}/posts/{slug}/publish", limit(ratelimit.Write, http.HandlerFunc(ph.Publish))).Methods(http.MethodPut)
+
+	if cfg.Site.Enabled {
+		// Validate already checked the tenant themes.
+		tenantThemes, _ := cfg.Site.ThemeByTenant()
+
+		themes := site.NewThemes(cfg.Site.ThemesDir, cfg.Site.Reload)
+		for _, name := range append([]string{cfg.Site.Theme}, values(tenantThemes)...) {
+			if _, err := themes.Get(name); err != nil {
+				logger.Error("invalid theme", "theme", name, "error", err)
+				os.Exit(1)
+			}
+		}
+
+		blog := &site.Site{
+			Repository: pm,
+			Themes:     themes,
+			HTTPCache:  cfg.HTTPCache,
+			PageSize:   cfg.Site.PageSize,
+			Theme: func(tenantID string) string {
+				if theme, ok := tenantThemes[tenantID]; ok {
+					return theme
+				}
+
+				return cfg.Site.Theme
+			},
+		}
+
+		router.Handle("/blog/{tenantID}/", limit(ratelimit.Read, http.HandlerFunc(blog.Index))).Methods(http.MethodGet)
+		router.Handle("/blog/{tenantID}/posts/{slug}", limit(ratelimit.Read, http.HandlerFunc(blog.Post))).Methods(http.MethodGet)
+		router.Handle("/blog/{tenantID}/tags/{tag}", limit(ratelimit.Read, http.HandlerFunc(blog.Tag))).Methods(http.MethodGet)
+		router.Handle("/blog/{tenantID}/archive", limit(ratelimit.Read, http.HandlerFunc(blog.Archive))).Methods(http.MethodGet)
+		router.Handle("/blog/{tenantID}/archive/{year:[0-9]{4}}/{month:[0-9]{1,2}}", limit(ratelimit.Read, http.HandlerFunc(blog.Archive))).Methods(http.MethodGet)
+		router.HandleFunc("/themes/{theme}/static/{path:.+}", blog.Static).Methods(http.MethodGet)
+	}
+
+	// The admin routes show the configuration, export every post of a tenant,
+	// drafts included, and import over posts, so they are never served
+	// unauthenticated.
+	if cfg.Server.TLS.ClientCAFile != "" || len(cfg.Auth.APIKeys) > 0 {
+		admin := router.PathPrefix("/admin").Subrouter()
+		if cfg.Server.TLS.ClientCAFile != "" {
+			admin.Use(tlsconfig.RequireClientCert)
+		}
+		if len(cfg.Auth.APIKeys) > 0 {
+			admin.Use(auth.RequireAPIKey(cfg.Auth.APIKeys))
+		}
+
+		admin.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/yaml")
+			cfg.WriteRedacted(w)
+		}).Methods(http.MethodGet)
+		admin.HandleFunc("/indexes", ph.IndexDrift).Methods(http.MethodGet)
+
+		bh := &backup.Handler{Source: pm, Target: pm}
+		transfer := request.ExtendDeadlines(cfg.Server.TransferTimeout)
+		admin.Handle("/tenants/{tenantID}/export", transfer(http.HandlerFunc(bh.Export))).Methods(http.MethodGet)
+		admin.Handle("/tenants/{tenantID}/import", transfer(body("import", bh.Import))).Methods(http.MethodPost)
+		admin.HandleFunc("/cache", func(w http.ResponseWriter, r *http.Request) {
+			responsehandler.EncodeJSONResponse(w, pm.Cache.Stats(), http.StatusOK, nil)
+		}).Methods(http.MethodGet)
+	} else {
+		logger.Warn("not serving /admin: set auth.api_keys or server.tls.client_ca_file to enable it")
+	}
+
+	if cfg.Frontend.Enabled {
+		// Validate already checked the tenant hosts.
+		tenantHosts, _ := cfg.Frontend.TenantByHost()
+
+		frontend, err := web.New(func(r *http.Request) web.RuntimeConfig {
+			tenant, ok := tenantHosts[strings.ToLower(hostname(r.Host))]
+			if !ok {
+				tenant = cfg.Frontend.Tenant
+			}
+
+			return web.RuntimeConfig{APIBaseURL: cfg.Frontend.APIBaseURL, Tenant: tenant}
+		})
+
+		switch {
+		case errors.Is(err, web.ErrNotBuilt):
+			logger.Warn("not serving the frontend: build it with `make frontend` before building the server")
+		case err != nil:
+			logger.Error("could not load the frontend", "error", err)
+			os.Exit(1)
+		default:
+			frontend.Reserved = []string{"/tenant", "/admin", "/blog", "/themes", "/metrics", "/swagger", "/healthz", "/readyz"}
+
+			// Registered last, so API routes take precedence.
+			router.PathPrefix("/").MatcherFunc(frontend.Serves).Methods(http.MethodGet, http.MethodHead).Handler(frontend)
+		}
+	}
+
+	router.NotFoundHandler = http.HandlerFunc(responsehandler.RouteNotFound)
+	router.MethodNotAllowedHandler = responsehandler.MethodNotAllowed(router)
+
+	// Metrics wrap the router, not its middleware, so requests no route
+	// matches are recorded too.
+	var handler http.Handler = m.Middleware(router)
+	if cfg.Server.Compression.Enabled {
+		handler = middleware.Compress(cfg.Server.Compression.MinSize)(handler)
+	}
+
+	if cfg.CORS.Enabled() {
+		// Validate already checked the tenant origins.
+		tenantOrigins, _ := cfg.CORS.TenantOriginsByTenant()
+
+		policy, err := cors.New(cors.Policy{
+			Origins:          cfg.CORS.AllowedOrigins,
+			TenantOrigins:    tenantOrigins,
+			Methods:          cfg.CORS.AllowedMethods,
+			Headers:          cfg.CORS.AllowedHeaders,
+			ExposedHeaders:   cfg.CORS.ExposedHeaders,
+			AllowCredentials: cfg.CORS.AllowCredentials,
+			MaxAge:           cfg.CORS.MaxAge,
+			Tenant:           cors.TenantFromPath("/tenant/"),
+		})
+		if err != nil {
+			logger.Error("invalid CORS settings", "error", err)
+			os.Exit(1)
+		}
+
+		handler = policy.Middleware(handler)
+	}
 
 	srv := &http.Server{
-		Handler:      router,
-		WriteTimeout: time.Duration(config.WriteTimeout) * time.Second,
-		ReadTimeout:  time.Duration(config.ReadTimeout) * time.Second,
-		Addr:         fmt.Sprintf("127.0.0.1:%s", config.Port),
+		Handler:      logging.RequestIDMiddleware(logging.AccessLog(handler)),
+		WriteTimeout: cfg.Server.WriteTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		ConnContext:  request.ConnContext,
+		Addr:         net.JoinHostPort(cfg.Server.Host, cfg.Server.Port),
+	}
+
+	if cfg.Server.TLS.Enabled() {
+		reloader, err := tlsconfig.NewReloader(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+		if err != nil {
+			logger.Error("could not load TLS certificate", "error", err)
+			os.Exit(1)
+		}
+
+		srv.TLSConfig, err = tlsconfig.ServerConfig(reloader, cfg.Server.TLS.ClientCAFile)
+		if err != nil {
+			logger.Error("could not configure TLS", "error", err)
+			os.Exit(1)
+		}
+
+		app.Go("tls-reload", func(ctx context.Context) error {
+			return reloader.Watch(logging.NewContext(ctx, logger), cfg.Server.TLS.ReloadInterval)
+		})
+	}
+
+	app.Append(serve(app, logger, "http", srv))
+
+	if port := cfg.Server.TLS.RedirectPort; port != "" {
+		redirect := &http.Server{
+			Handler:      tlsconfig.RedirectHandler(cfg.Server.Port),
+			WriteTimeout: cfg.Server.WriteTimeout,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			Addr:         net.JoinHostPort(cfg.Server.Host, port),
+		}
+
+		app.Append(serve(app, logger, "http-redirect", redirect))
 	}
 
-	fmt.Printf("Serving on 127.0.0.1:%s\n", config.Port)
-	log.Fatal(srv.ListenAndServe())
+	if err := app.Run(context.Background()); err != nil {
+		logger.Error("glog stopped with an error", "error", err)
+		os.Exit(1)
+	}
+}
+
+// values returns the values of m.
+func values(m map[string]string) []string {
+	vs := make([]string, 0, len(m))
+	for _, v := range m {
+		vs = append(vs, v)
+	}
+
+	return vs
+}
+
+// hostname strips the port from a Host header.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+
+	return host
+}
+
+// serve returns a hook that binds srv's address on start, so a busy port
+// fails startup, and drains srv on stop. srv is served over TLS when it has
+// a TLS configuration.
+func serve(app *lifecycle.App, logger *logging.Logger, name string, srv *http.Server) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: name,
+		Start: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", srv.Addr)
+			if err != nil {
+				return err
+			}
+
+			logger.Info("serving", "server", name, "addr", srv.Addr, "tls", srv.TLSConfig != nil)
+
+			go func() {
+				var err error
+				if srv.TLSConfig != nil {
+					err = srv.ServeTLS(listener, "", "")
+				} else {
+					err = srv.Serve(listener)
+				}
+
+				if err != nil && !errors.Is(err, http.ErrServerClosed) {
+					app.Fail(fmt.Errorf("%s: %w", name, err))
+				}
+			}()
+
+			return nil
+		},
+		Stop: srv.Shutdown,
+	}
 }
@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"glog/apperror"
+	"glog/cache"
+	"glog/middleware"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "glog"
+
+// Metrics holds every collector exposed on /metrics. All methods are safe to
+// call on a nil *Metrics, so instrumented code doesn't need to check whether
+// metrics are enabled.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequests   *prometheus.CounterVec
+	httpDuration   *prometheus.HistogramVec
+	repoDuration   *prometheus.HistogramVec
+	repoErrors     *prometheus.CounterVec
+	postsCreated   *prometheus.CounterVec
+	postsPublished *prometheus.CounterVec
+	rateLimited    *prometheus.CounterVec
+	pool           *poolCollector
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by route template, method and status.",
+		}, []string{"route", "method", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by route template, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		repoDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "repository",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of repository operations.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"operation"}),
+		repoErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "repository",
+			Name:      "errors_total",
+			Help:      "Failed repository operations by error kind.",
+		}, []string{"operation", "kind"}),
+		postsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "posts_created_total",
+			Help:      "Posts created per tenant.",
+		}, []string{"tenant"}),
+		postsPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "posts_published_total",
+			Help:      "Posts published per tenant.",
+		}, []string{"tenant"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_total",
+			Help:      "Requests rejected by the rate limiter by route class and whether the client or the tenant ran out.",
+		}, []string{"class", "scope"}),
+		pool: newPoolCollector(),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.repoDuration,
+		m.repoErrors,
+		m.postsCreated,
+		m.postsPublished,
+		m.rateLimited,
+		m.pool,
+	)
+
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// router finds the route of a request; *mux.Router is one.
+type router interface {
+	Match(r *http.Request, match *mux.RouteMatch) bool
+}
+
+// Middleware records request counts and latency. Requests are labeled by
+// route template instead of the raw path, which would give one series per
+// post. It must wrap the router itself, which it asks for the route, rather
+// than be added with router.Use, as mux runs its middleware only on matched
+// routes; requests no route matches, including those with the wrong method,
+// are labeled "unmatched".
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := middleware.NewRecorder(w)
+
+		route := "unmatched"
+		if rt, ok := next.(router); ok {
+			var match mux.RouteMatch
+			if rt.Match(r, &match) && match.MatchErr == nil && match.Route != nil {
+				if tpl, err := match.Route.GetPathTemplate(); err == nil {
+					route = tpl
+				}
+			}
+		}
+
+		next.ServeHTTP(rec, r)
+
+		status := strconv.Itoa(rec.Status)
+		m.httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		m.httpDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveRepository records the latency of a repository operation that
+// started at start, and counts it as failed if err is set.
+func (m *Metrics) ObserveRepository(operation string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	m.repoDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		m.repoErrors.WithLabelValues(operation, string(apperror.KindOf(err))).Inc()
+	}
+}
+
+func (m *Metrics) PostCreated(tenantID string) {
+	if m == nil {
+		return
+	}
+
+	m.postsCreated.WithLabelValues(tenantID).Inc()
+}
+
+func (m *Metrics) PostPublished(tenantID string) {
+	if m == nil {
+		return
+	}
+
+	m.postsPublished.WithLabelValues(tenantID).Inc()
+}
+
+func (m *Metrics) RateLimited(class string, scope string) {
+	if m == nil {
+		return
+	}
+
+	m.rateLimited.WithLabelValues(class, scope).Inc()
+}
+
+// RegisterCache exposes the counters of the read-through cache.
+func (m *Metrics) RegisterCache(c *cache.Cache) {
+	if m == nil || c == nil {
+		return
+	}
+
+	counter := func(name string, help string, value func(cache.Stats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			return float64(value(c.Stats()))
+		})
+	}
+
+	m.Registry.MustRegister(
+		counter("hits_total", "Reads served from the cache.", func(s cache.Stats) int64 { return s.Hits }),
+		counter("misses_total", "Reads that had to load the value.", func(s cache.Stats) int64 { return s.Misses }),
+		counter("shared_loads_total", "Misses served by a load started by another request.", func(s cache.Stats) int64 { return s.Shared }),
+		counter("errors_total", "Failed reads and writes of the cache store.", func(s cache.Stats) int64 { return s.Errors }),
+	)
+}
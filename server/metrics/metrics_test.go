@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"glog/apperror"
+
+	"github.com/gorilla/mux"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	return w.Body.String()
+}
+
+func TestMiddlewareLabelsByRouteTemplate(t *testing.T) {
+	m := New()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/tenant/{tenantID}/posts/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	m.Middleware(router).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/tenant/1/posts/hello", nil))
+
+	expected := `glog_http_requests_total{method="GET",route="/tenant/{tenantID}/posts/{slug}",status="404"} 1`
+	if body := scrape(t, m); !strings.Contains(body, expected) {
+		t.Errorf("Expected %s in\n%s", expected, body)
+	}
+}
+
+func TestMiddlewareRecordsUnmatchedRequests(t *testing.T) {
+	m := New()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/tenant/{tenantID}/posts", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet)
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet)
+
+	handler := m.Middleware(router)
+	for _, r := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/tenant/1/postz", nil),
+		httptest.NewRequest(http.MethodDelete, "/tenant/1/posts", nil),
+		httptest.NewRequest(http.MethodGet, "/admin/config", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	body := scrape(t, m)
+	for _, expected := range []string{
+		`glog_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`glog_http_requests_total{method="DELETE",route="unmatched",status="405"} 1`,
+		`glog_http_requests_total{method="GET",route="/admin/config",status="200"} 1`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %s in\n%s", expected, body)
+		}
+	}
+}
+
+func TestObserveRepositoryCountsErrorsByKind(t *testing.T) {
+	m := New()
+
+	m.ObserveRepository("get_by_slug", time.Now(), nil)
+	m.ObserveRepository("get_by_slug", time.Now(), apperror.NotFound("post_not_found", "missing"))
+	m.PostCreated("tenant-a")
+
+	body := scrape(t, m)
+
+	for _, expected := range []string{
+		`glog_repository_operation_duration_seconds_count{operation="get_by_slug"} 2`,
+		`glog_repository_errors_total{kind="not-found",operation="get_by_slug"} 1`,
+		`glog_posts_created_total{tenant="tenant-a"} 1`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %s in\n%s", expected, body)
+		}
+	}
+}
+
+func TestNilMetricsIsANoop(t *testing.T) {
+	var m *Metrics
+
+	m.ObserveRepository("list", time.Now(), nil)
+	m.PostPublished("tenant-a")
+
+	if m.PoolMonitor() != nil {
+		t.Errorf("Expected no pool monitor when metrics are disabled")
+	}
+}
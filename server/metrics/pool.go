@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// poolCollector turns Mongo connection pool events into gauges and counters
+// per server address.
+type poolCollector struct {
+	open      *prometheus.GaugeVec
+	inUse     *prometheus.GaugeVec
+	checkouts *prometheus.CounterVec
+	failures  *prometheus.CounterVec
+	cleared   *prometheus.CounterVec
+}
+
+func newPoolCollector() *poolCollector {
+	return &poolCollector{
+		open: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "mongo_pool",
+			Name:      "connections_open",
+			Help:      "Open connections in the Mongo pool.",
+		}, []string{"address"}),
+		inUse: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "mongo_pool",
+			Name:      "connections_in_use",
+			Help:      "Connections currently checked out of the Mongo pool.",
+		}, []string{"address"}),
+		checkouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "mongo_pool",
+			Name:      "checkouts_total",
+			Help:      "Successful connection checkouts from the Mongo pool.",
+		}, []string{"address"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "mongo_pool",
+			Name:      "checkout_failures_total",
+			Help:      "Failed connection checkouts from the Mongo pool by reason.",
+		}, []string{"address", "reason"}),
+		cleared: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "mongo_pool",
+			Name:      "cleared_total",
+			Help:      "Times the Mongo pool was cleared after errors.",
+		}, []string{"address"}),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.open.Describe(ch)
+	c.inUse.Describe(ch)
+	c.checkouts.Describe(ch)
+	c.failures.Describe(ch)
+	c.cleared.Describe(ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.open.Collect(ch)
+	c.inUse.Collect(ch)
+	c.checkouts.Collect(ch)
+	c.failures.Collect(ch)
+	c.cleared.Collect(ch)
+}
+
+func (c *poolCollector) handle(e *event.PoolEvent) {
+	switch e.Type {
+	case event.ConnectionCreated:
+		c.open.WithLabelValues(e.Address).Inc()
+	case event.ConnectionClosed:
+		c.open.WithLabelValues(e.Address).Dec()
+	case event.GetSucceeded:
+		c.inUse.WithLabelValues(e.Address).Inc()
+		c.checkouts.WithLabelValues(e.Address).Inc()
+	case event.ConnectionReturned:
+		c.inUse.WithLabelValues(e.Address).Dec()
+	case event.GetFailed:
+		c.failures.WithLabelValues(e.Address, e.Reason).Inc()
+	case event.PoolCleared:
+		c.cleared.WithLabelValues(e.Address).Inc()
+	}
+}
+
+// PoolMonitor returns a Mongo pool monitor feeding the pool metrics, or nil
+// if metrics are disabled.
+func (m *Metrics) PoolMonitor() *event.PoolMonitor {
+	if m == nil {
+		return nil
+	}
+
+	return &event.PoolMonitor{Event: m.pool.handle}
+}
@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"glog/negotiation"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Encodings supported by Compress, in order of preference when the client
+// accepts several with the same quality.
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}}
+	brotliWriters = sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, 5)
+	}}
+)
+
+// Compress encodes responses with brotli or gzip, as negotiated through
+// Accept-Encoding, when their media type compresses well and their body is
+// at least minSize bytes. Smaller bodies are buffered and sent as is.
+//
+// A compressed response has a different body than the identity one, so its
+// strong ETag is turned into a weak one, which If-None-Match still matches.
+func Compress(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       negotiation.Encoding(r.Header.Get("Accept-Encoding"), EncodingBrotli, EncodingGzip),
+				minSize:        minSize,
+				status:         http.StatusOK,
+				head:           r.Method == http.MethodHead,
+			}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	head     bool
+
+	status      int
+	decided     bool
+	passthrough bool
+	wroteHeader bool
+	buf         []byte
+	encoder     io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader || cw.decided {
+		return
+	}
+
+	cw.status = status
+
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified || cw.head {
+		cw.decided, cw.passthrough = true, true
+		cw.sendHeader()
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.decide()
+	}
+
+	if cw.passthrough {
+		cw.sendHeader()
+		return cw.ResponseWriter.Write(b)
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.startEncoding(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush sends what is buffered, compressing it if the response can be.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide()
+	}
+
+	if !cw.passthrough && cw.encoder == nil {
+		cw.startEncoding()
+	}
+
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+
+	if cw.encoder == nil {
+		cw.flushBuffer()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide looks at the headers the handler set before its first write.
+func (cw *compressWriter) decide() {
+	cw.decided = true
+	h := cw.Header()
+
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" || !compressible(h.Get("Content-Type")) {
+		cw.passthrough = true
+		return
+	}
+
+	h.Add("Vary", "Accept-Encoding")
+
+	// Without an encoding the client accepts, there is nothing to wait
+	// for, so the response streams as it is written.
+	cw.passthrough = cw.encoding == ""
+}
+
+func (cw *compressWriter) startEncoding() error {
+	h := cw.Header()
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		h.Set("ETag", "W/"+etag)
+	}
+
+	cw.sendHeader()
+
+	switch cw.encoding {
+	case EncodingBrotli:
+		bw := brotliWriters.Get().(*brotli.Writer)
+		bw.Reset(cw.ResponseWriter)
+		cw.encoder = bw
+	default:
+		gw := gzipWriters.Get().(*gzip.Writer)
+		gw.Reset(cw.ResponseWriter)
+		cw.encoder = gw
+	}
+
+	buf := cw.buf
+	cw.buf = nil
+	_, err := cw.encoder.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) sendHeader() {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+}
+
+func (cw *compressWriter) flushBuffer() {
+	cw.sendHeader()
+
+	if len(cw.buf) > 0 {
+		cw.ResponseWriter.Write(cw.buf)
+		cw.buf = nil
+	}
+}
+
+// close finishes the response once the handler returned.
+func (cw *compressWriter) close() {
+	if cw.encoder == nil {
+		cw.flushBuffer()
+		return
+	}
+
+	cw.encoder.Close()
+
+	switch e := cw.encoder.(type) {
+	case *brotli.Writer:
+		brotliWriters.Put(e)
+	case *gzip.Writer:
+		gzipWriters.Put(e)
+	}
+}
+
+// compressible reports whether a media type is text-like. Images, archives
+// and other already compressed types are left alone.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "application/yaml", "image/svg+xml":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+var body = strings.Repeat("glog compresses text responses. ", 100)
+
+func serve(contentType string, payload string, acceptEncoding string) *httptest.ResponseRecorder {
+	h := Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", `"abc"`)
+		io.WriteString(w, payload)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", acceptEncoding)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestCompressGzip(t *testing.T) {
+	w := serve("application/json", body, "gzip")
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", got)
+	}
+
+	if got := w.Header().Get("ETag"); got != `W/"abc"` {
+		t.Errorf("Expected weak ETag, got %q", got)
+	}
+
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", got)
+	}
+
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := io.ReadAll(zr); string(b) != body {
+		t.Errorf("Expected body to round trip")
+	}
+}
+
+func TestCompressBrotli(t *testing.T) {
+	w := serve("text/html; charset=utf-8", body, "gzip, br")
+
+	if got := w.Header().Get("Content-Encoding"); got != "br" {
+		t.Fatalf("Expected br encoding, got %q", got)
+	}
+
+	if b, _ := io.ReadAll(brotli.NewReader(w.Body)); string(b) != body {
+		t.Errorf("Expected body to round trip")
+	}
+}
+
+func TestCompressSkipsSmallAndBinaryBodies(t *testing.T) {
+	w := serve("application/json", `{"ok":true}`, "gzip")
+
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Expected small body to be sent as is, got %q", got)
+	}
+
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Expected Vary on a compressible type, got %q", got)
+	}
+
+	if w.Body.String() != `{"ok":true}` {
+		t.Errorf("Expected body to be unchanged, got %q", w.Body.String())
+	}
+
+	w = serve("image/png", body, "gzip")
+
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Expected image to be sent as is, got %q", got)
+	}
+
+	if got := w.Header().Get("ETag"); got != `"abc"` {
+		t.Errorf("Expected strong ETag, got %q", got)
+	}
+}
+
+func TestCompressStreamsWhenNoEncodingIsAccepted(t *testing.T) {
+	w := httptest.NewRecorder()
+	sent := make(chan int, 1)
+
+	h := Compress(1024)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain")
+		io.WriteString(rw, "first chunk")
+		sent <- w.Body.Len()
+		io.WriteString(rw, body)
+	}))
+
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if n := <-sent; n != len("first chunk") {
+		t.Errorf("Expected the first chunk to be sent before the handler returned, got %d bytes", n)
+	}
+
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "first chunk"+body {
+		t.Errorf("Expected the body as is, got %q", w.Header().Get("Content-Encoding"))
+	}
+
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", got)
+	}
+}
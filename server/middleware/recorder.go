@@ -0,0 +1,34 @@
+package middleware
+
+import "net/http"
+
+// Recorder wraps a ResponseWriter and remembers the status code and number
+// of bytes written, for middlewares that report on finished responses.
+type Recorder struct {
+	http.ResponseWriter
+	Status int
+	Bytes  int
+}
+
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{
+		ResponseWriter: w,
+		Status:         http.StatusOK,
+	}
+}
+
+func (r *Recorder) WriteHeader(status int) {
+	r.Status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
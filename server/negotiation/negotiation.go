@@ -0,0 +1,118 @@
+package negotiation
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MediaType picks the offer the Accept header prefers. An empty header
+// accepts anything, so the first offer wins; ties also go to the earlier
+// offer. It returns "" if no offer is acceptable.
+func MediaType(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return first(offers)
+	}
+
+	ranges := parse(accept)
+	best, bestQ := "", 0.0
+
+	for _, offer := range offers {
+		if q := mediaQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// Encoding picks the content coding the Accept-Encoding header prefers among
+// offers. It returns "" when none is acceptable, in which case the response
+// is sent unencoded.
+func Encoding(acceptEncoding string, offers ...string) string {
+	ranges := parse(acceptEncoding)
+	best, bestQ := "", 0.0
+
+	for _, offer := range offers {
+		q, specific := 0.0, false
+
+		for _, r := range ranges {
+			switch {
+			case strings.EqualFold(r.value, offer):
+				q, specific = r.q, true
+			case r.value == "*" && !specific:
+				q = r.q
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+type accepted struct {
+	value string
+	q     float64
+}
+
+func parse(header string) []accepted {
+	var out []accepted
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(fields[0]))
+		if value == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			name, raw, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		out = append(out, accepted{value: value, q: q})
+	}
+
+	return out
+}
+
+// mediaQuality returns the quality the most specific matching range gives
+// offer.
+func mediaQuality(ranges []accepted, offer string) float64 {
+	offerType, _, _ := strings.Cut(offer, "/")
+	q, specificity := 0.0, -1
+
+	for _, r := range ranges {
+		s := -1
+
+		switch {
+		case r.value == offer:
+			s = 2
+		case r.value == offerType+"/*":
+			s = 1
+		case r.value == "*/*":
+			s = 0
+		}
+
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+
+	return q
+}
+
+func first(offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+
+	return offers[0]
+}
@@ -0,0 +1,48 @@
+package negotiation
+
+import "testing"
+
+func TestMediaType(t *testing.T) {
+	offers := []string{"application/json", "text/markdown", "text/html"}
+
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"text/html", "text/html"},
+		{"text/*", "text/markdown"},
+		{"text/html;q=0.8, text/markdown", "text/markdown"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html"},
+		{"text/*;q=0.5, text/html;q=0", "text/markdown"},
+		{"image/png", ""},
+	}
+
+	for _, c := range cases {
+		if got := MediaType(c.accept, offers...); got != c.want {
+			t.Errorf("Expected %q for Accept %q, got %q", c.want, c.accept, got)
+		}
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip, deflate, br", "br"},
+		{"gzip", "gzip"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"*", "br"},
+		{"*, br;q=0", "gzip"},
+		{"identity", ""},
+	}
+
+	for _, c := range cases {
+		if got := Encoding(c.accept, "br", "gzip"); got != c.want {
+			t.Errorf("Expected %q for Accept-Encoding %q, got %q", c.want, c.accept, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package post
+
+import (
+	"context"
+	"fmt"
+
+	"glog/cache"
+	"glog/logging"
+)
+
+// GetBySlug returns the post with the given slug. Published posts are read
+// through the cache; drafts always come from Mongo.
+func (m *Repository) GetBySlug(ctx context.Context, tenantID string, slug string) (*Post, error) {
+	var p *Post
+
+	err := m.Cache.Load(ctx, tenantID, "post:"+slug, &p, func(ctx context.Context) (interface{}, error) {
+		p, err := m.getBySlug(ctx, tenantID, slug)
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.IsPublished {
+			return cache.Uncached(p), nil
+		}
+
+		return p, nil
+	})
+
+	return p, err
+}
+
+// GetForWrite returns the post with the given slug from Mongo, bypassing the
+// cache. Handlers that save or delete a post must read it with GetForWrite:
+// another instance may have changed it since it was cached, and saving the
+// cached copy would revert that change.
+func (m *Repository) GetForWrite(ctx context.Context, tenantID string, slug string) (*Post, error) {
+	return m.getBySlug(ctx, tenantID, slug)
+}
+
+// List returns a page of posts matching filters. Pages of published posts
+// are read through the cache.
+func (m *Repository) List(ctx context.Context, tenantID string, from int, size int, filters map[string]interface{}) ([]*Post, error) {
+	if !publishedOnly(filters) {
+		return m.list(ctx, tenantID, from, size, filters)
+	}
+
+	var posts []*Post
+
+	err := m.Cache.Load(ctx, tenantID, fmt.Sprintf("published:%d:%d", from, size), &posts, func(ctx context.Context) (interface{}, error) {
+		return m.list(ctx, tenantID, from, size, filters)
+	})
+
+	return posts, err
+}
+
+func publishedOnly(filters map[string]interface{}) bool {
+	return len(filters) == 1 && filters[fieldIsPublished] == true
+}
+
+// invalidate drops the cached posts of a tenant after a write. It runs even
+// if the request was cancelled, since the write may still have happened.
+func (m *Repository) invalidate(ctx context.Context, tenantID string) {
+	if m.Cache == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(logging.NewContext(context.Background(), logging.FromContext(ctx)), m.Config.Storage.Timeouts.Default)
+	defer cancel()
+
+	m.Cache.Invalidate(ctx, tenantID)
+}
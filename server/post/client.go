@@ -0,0 +1,177 @@
+package post
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"glog/config"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// clientOptions builds the driver options for one cluster from the storage
+// settings shared by every cluster.
+func clientOptions(uri string, storage config.StorageConfig, monitor *event.PoolMonitor) (*options.ClientOptions, error) {
+	opts := options.Client().
+		ApplyURI(uri).
+		SetRetryWrites(storage.RetryWrites).
+		SetRetryReads(storage.RetryReads)
+
+	if storage.MaxPoolSize > 0 {
+		opts.SetMaxPoolSize(uint64(storage.MaxPoolSize))
+	}
+
+	if storage.MinPoolSize > 0 {
+		opts.SetMinPoolSize(uint64(storage.MinPoolSize))
+	}
+
+	if storage.ReadConcern != "" {
+		opts.SetReadConcern(readconcern.New(readconcern.Level(storage.ReadConcern)))
+	}
+
+	switch storage.WriteConcern {
+	case "":
+	case "majority":
+		opts.SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
+	default:
+		n, err := strconv.Atoi(storage.WriteConcern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid write concern %q", storage.WriteConcern)
+		}
+		opts.SetWriteConcern(writeconcern.New(writeconcern.W(n)))
+	}
+
+	mode, err := readpref.ModeFromString(storage.ReadPreference)
+	if err != nil {
+		return nil, err
+	}
+
+	pref, err := readpref.New(mode)
+	if err != nil {
+		return nil, err
+	}
+	opts.SetReadPreference(pref)
+
+	if monitor != nil {
+		opts.SetPoolMonitor(monitor)
+	}
+
+	return opts, opts.Validate()
+}
+
+// connect opens a client to uri and checks that the cluster answers.
+func connect(ctx context.Context, uri string, storage config.StorageConfig, monitor *event.PoolMonitor) (*mongo.Client, error) {
+	opts, err := clientOptions(uri, storage, monitor)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// cluster is one connected client, named after the tenants it serves.
+type cluster struct {
+	name   string
+	client *mongo.Client
+}
+
+// clients routes each tenant to the cluster holding its database. Tenants
+// without a route of their own live on the default cluster. Tenants sharing
+// a connection string share a client.
+type clients struct {
+	fallback *mongo.Client
+	tenants  map[string]*mongo.Client
+	clusters []cluster
+}
+
+// connectAll connects to the default cluster and to every cluster named in
+// storage.tenant_clusters. If any of them fails, the ones already opened are
+// closed again.
+func connectAll(ctx context.Context, storage config.StorageConfig, monitor *event.PoolMonitor) (*clients, error) {
+	routes, err := storage.TenantRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &clients{tenants: make(map[string]*mongo.Client, len(routes))}
+
+	c.fallback, err = connect(ctx, storage.ConnectionString, storage, monitor)
+	if err != nil {
+		return nil, err
+	}
+	c.clusters = append(c.clusters, cluster{name: "default", client: c.fallback})
+
+	byURI := map[string]*mongo.Client{storage.ConnectionString: c.fallback}
+	tenants := make([]string, 0, len(routes))
+	for tenant := range routes {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	for _, tenant := range tenants {
+		uri := routes[tenant]
+
+		client, ok := byURI[uri]
+		if !ok {
+			client, err = connect(ctx, uri, storage, monitor)
+			if err != nil {
+				c.disconnect(ctx)
+				return nil, fmt.Errorf("cluster of tenant %s: %w", tenant, err)
+			}
+
+			byURI[uri] = client
+			c.clusters = append(c.clusters, cluster{name: "tenant " + tenant, client: client})
+		}
+
+		c.tenants[tenant] = client
+	}
+
+	return c, nil
+}
+
+func (c *clients) forTenant(tenantID string) *mongo.Client {
+	if client, ok := c.tenants[tenantID]; ok {
+		return client
+	}
+
+	return c.fallback
+}
+
+func (c *clients) ping(ctx context.Context) error {
+	for _, cl := range c.clusters {
+		if err := cl.client.Ping(ctx, readpref.Primary()); err != nil {
+			return fmt.Errorf("%s cluster: %w", cl.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *clients) disconnect(ctx context.Context) error {
+	var firstErr error
+
+	for _, cl := range c.clusters {
+		if err := cl.client.Disconnect(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,52 @@
+package post
+
+import (
+	"testing"
+
+	"glog/config"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestClientOptionsApplyStorageSettings(t *testing.T) {
+	storage := config.Default().Storage
+	storage.MaxPoolSize = 50
+	storage.ReadConcern = "majority"
+	storage.WriteConcern = "majority"
+	storage.ReadPreference = "secondaryPreferred"
+	storage.RetryWrites = false
+
+	opts, err := clientOptions(storage.ConnectionString, storage, nil)
+	if err != nil {
+		t.Fatalf("Expected valid options, got %v", err)
+	}
+
+	if *opts.MaxPoolSize != 50 || *opts.RetryWrites {
+		t.Errorf("Unexpected pool size %d or retry writes %v", *opts.MaxPoolSize, *opts.RetryWrites)
+	}
+
+	if opts.ReadConcern.GetLevel() != "majority" || opts.WriteConcern.GetW() != "majority" {
+		t.Errorf("Unexpected concerns %v and %v", opts.ReadConcern.GetLevel(), opts.WriteConcern.GetW())
+	}
+
+	if opts.ReadPreference.Mode() != readpref.SecondaryPreferredMode {
+		t.Errorf("Expected secondaryPreferred, got %v", opts.ReadPreference.Mode())
+	}
+}
+
+func TestClientsRouteTenantsToTheirCluster(t *testing.T) {
+	fallback, dedicated := &mongo.Client{}, &mongo.Client{}
+	c := &clients{
+		fallback: fallback,
+		tenants:  map[string]*mongo.Client{"big-customer": dedicated},
+	}
+
+	if c.forTenant("big-customer") != dedicated {
+		t.Errorf("Expected big-customer to use its own cluster")
+	}
+
+	if c.forTenant("someone-else") != fallback {
+		t.Errorf("Expected other tenants to use the default cluster")
+	}
+}
@@ -1,26 +1,46 @@
 package post
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"time"
 
+	"glog/apperror"
+	"glog/config"
+	"glog/httpcache"
+	"glog/logging"
+	"glog/metrics"
+	"glog/negotiation"
+	"glog/request"
 	"glog/responsehandler"
+	"glog/validation"
 
 	"github.com/gorilla/mux"
 )
 
 type Handler struct {
 	Repository *Repository
+	Metrics    *metrics.Metrics
+	HTTPCache  config.HTTPCacheConfig
 }
 
 type UpdateRequest struct {
 	Body string `json:"Body"`
 }
 
+func (r UpdateRequest) Validate() error {
+	v := validation.New()
+
+	if v.Required("Body", r.Body) && v.Length("Body", r.Body, 1, MaxContentLength) {
+		v.Charset("Body", r.Body, validation.MultiLine)
+	}
+
+	return v.Err()
+}
+
 // Create godoc
 // @Summary      Create a new Post
 // @Description  Create a new post with an auto-generated ID
@@ -29,29 +49,32 @@ type UpdateRequest struct {
 // @Param        tenantID   path      int  true  "Tenant ID"
 // @Param        {object} body post.CreatePostRequest true "Post to create"
 // @Success      200  {object}  post.Post
-// @Failure      400  {object}  responsehandler.Error
-// @Failure      500  {object}  responsehandler.Error
-// @Router       /v2/tenant/{tenantID}/posts [post]
+// @Failure      400  {object}  responsehandler.Problem
+// @Failure      413  {object}  responsehandler.Problem
+// @Failure      415  {object}  responsehandler.Problem
+// @Failure      422  {object}  responsehandler.Problem
+// @Failure      500  {object}  responsehandler.Problem
+// @Failure      429  {object}  responsehandler.Problem
+// @Router       /tenant/{tenantID}/posts [post]
 func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
-	b, err := io.ReadAll(r.Body)
 	vars := mux.Vars(r)
 
-	if err != nil {
-		responsehandler.EncodeJSONError(w, err, http.StatusBadRequest)
-		return
-	}
-
 	var createRequest CreatePostRequest
 
-	json.Unmarshal(b, &createRequest)
+	if err := request.DecodeJSON(r, &createRequest); err != nil {
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
 
 	post := NewPost("abaltra", createRequest)
 
-	p, err := h.Repository.Create(vars["tenantID"], *post)
+	p, err := h.Repository.Create(r.Context(), vars["tenantID"], *post)
 
 	if err != nil {
-		responsehandler.EncodeJSONError(w, err, http.StatusBadRequest)
+		responsehandler.EncodeError(w, r, err)
 	} else {
+		logging.FromContext(r.Context()).Info("post created", "slug", p.Slug, "post_id", p.ID)
+		h.Metrics.PostCreated(vars["tenantID"])
 		responsehandler.EncodeJSONResponse(w, p, http.StatusOK, nil)
 	}
 }
@@ -64,20 +87,16 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 // @Param        tenantID   path      int  true  "Tenant ID"
 // @Param        slug   path      string  true  "Unique slug of the post"
 // @Success      200
-// @Failure      400  {object}  responsehandler.Error
-// @Failure      500  {object}  responsehandler.Error
-// @Router       /v2/tenant/{tenantID}/posts/{slug}/publish [put]
+// @Failure      404  {object}  responsehandler.Problem
+// @Failure      500  {object}  responsehandler.Problem
+// @Failure      429  {object}  responsehandler.Problem
+// @Router       /tenant/{tenantID}/posts/{slug}/publish [put]
 func (h *Handler) Publish(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	p, err := h.Repository.GetBySlug(vars["tenantID"], vars["slug"])
+	p, err := h.Repository.GetForWrite(r.Context(), vars["tenantID"], vars["slug"])
 
 	if err != nil {
-		responsehandler.EncodeJSONError(w, err, http.StatusBadRequest)
-		return
-	}
-
-	if p == nil {
-		responsehandler.EncodeJSONError(w, nil, http.StatusNotFound)
+		responsehandler.EncodeError(w, r, err)
 		return
 	}
 
@@ -86,9 +105,17 @@ func (h *Handler) Publish(w http.ResponseWriter, r *http.Request) {
 	}
 
 	p.PublishedAt = time.Now()
+	p.UpdatedAt = p.PublishedAt
 	p.IsPublished = true
+	p.Version++
 
-	h.Repository.Save(vars["tenantID"], *p)
+	if err := h.Repository.Save(r.Context(), vars["tenantID"], *p); err != nil {
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("post published", "post_id", p.ID)
+	h.Metrics.PostPublished(vars["tenantID"])
 }
 
 // Create godoc
@@ -100,42 +127,110 @@ func (h *Handler) Publish(w http.ResponseWriter, r *http.Request) {
 // @Param        slug   path      string  true  "Unique slug of the post"
 // @Param        {object} body UpdateRequest true "Post to create"
 // @Success      200
-// @Failure      400  {object}  responsehandler.Error
-// @Failure      500  {object}  responsehandler.Error
-// @Router       /v2/tenant/{tenantID}/posts/{slug} [post]
+// @Failure      400  {object}  responsehandler.Problem
+// @Failure      413  {object}  responsehandler.Problem
+// @Failure      415  {object}  responsehandler.Problem
+// @Failure      422  {object}  responsehandler.Problem
+// @Failure      500  {object}  responsehandler.Problem
+// @Failure      429  {object}  responsehandler.Problem
+// @Router       /tenant/{tenantID}/posts/{slug} [post]
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	p, err := h.Repository.GetBySlug(vars["tenantID"], vars["slug"])
+	p, err := h.Repository.GetForWrite(r.Context(), vars["tenantID"], vars["slug"])
+
+	if err != nil {
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
+
+	var ur UpdateRequest
+
+	if err := request.DecodeJSON(r, &ur); err != nil {
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
+
+	p.UpdatedAt = time.Now()
+	p.ContentRaw = ur.Body
+	p.Version++
+
+	if err := h.Repository.Save(r.Context(), vars["tenantID"], *p); err != nil {
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
+
+	responsehandler.EncodeJSONResponse(w, p, http.StatusOK, nil)
+}
+
+// Patch godoc
+// @Summary      Partially update a Post
+// @Description  Applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) to a post. Only Title, Abstract, ContentRaw and Tags may be changed.
+// @Accept       application/merge-patch+json,application/json-patch+json
+// @Produce      json
+// @Param        tenantID   path      int  true  "Tenant ID"
+// @Param        slug   path      string  true  "Unique slug of the post"
+// @Success      200  {object}  post.Post
+// @Failure      400  {object}  responsehandler.Problem
+// @Failure      413  {object}  responsehandler.Problem
+// @Failure      404  {object}  responsehandler.Problem
+// @Failure      415  {object}  responsehandler.Problem
+// @Failure      422  {object}  responsehandler.Problem
+// @Failure      500  {object}  responsehandler.Problem
+// @Failure      429  {object}  responsehandler.Problem
+// @Router       /tenant/{tenantID}/posts/{slug} [patch]
+func (h *Handler) Patch(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != MergePatchContentType && contentType != JSONPatchContentType) {
+		responsehandler.EncodeError(w, r, ErrUnsupportedPatchType)
+		return
+	}
+
+	p, err := h.Repository.GetForWrite(r.Context(), vars["tenantID"], vars["slug"])
 
 	if err != nil {
-		responsehandler.EncodeJSONError(w, err, http.StatusBadRequest)
+		responsehandler.EncodeError(w, r, err)
 		return
 	}
 
-	if p == nil {
-		responsehandler.EncodeJSONError(w, nil, http.StatusNotFound)
+	patch, err := request.ReadBody(r)
+
+	if err != nil {
+		responsehandler.EncodeError(w, r, err)
 		return
 	}
 
-	requestContents, err := io.ReadAll(r.Body)
+	patched, err := ApplyPatch(*p, contentType, patch)
 
 	if err != nil {
-		responsehandler.EncodeJSONError(w, err, http.StatusBadRequest)
+		responsehandler.EncodeError(w, r, err)
 		return
 	}
 
-	var ur UpdateRequest
-	json.Unmarshal(requestContents, &ur)
+	validated := CreatePostRequest{
+		Title:      patched.Title,
+		Abstract:   patched.Abstract,
+		ContentRaw: patched.ContentRaw,
+		Tags:       patched.Tags,
+	}
 
-	p.UpdatedAt = time.Now()
-	p.ContentRaw = ur.Body
+	if err := validated.Validate(); err != nil {
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
 
-	if err := h.Repository.Save(vars["tenantID"], *p); err != nil {
-		responsehandler.EncodeJSONError(w, err, http.StatusInternalServerError)
+	patched.Tags = NormalizeTags(patched.Tags)
+	patched.UpdatedAt = time.Now()
+	patched.Version++
+	patched.LastEditedBy = "abaltra"
+
+	if err := h.Repository.Save(r.Context(), vars["tenantID"], *patched); err != nil {
+		responsehandler.EncodeError(w, r, err)
 		return
 	}
 
-	responsehandler.EncodeJSONResponse(w, p, http.StatusOK, nil)
+	responsehandler.EncodeJSONResponse(w, patched, http.StatusOK, nil)
 }
 
 // Create godoc
@@ -146,24 +241,26 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 // @Param        tenantID   path      int  true  "Tenant ID"
 // @Param        slug path string true "Unique slug of the post to delete"
 // @Success      200
-// @Failure      404  {object}  responsehandler.Error
-// @Failure      502  {object}  responsehandler.Error
-// @Router       /v2/tenant/{tenantID}/posts/{slug} [delete]
+// @Failure      404  {object}  responsehandler.Problem
+// @Failure      503  {object}  responsehandler.Problem
+// @Failure      429  {object}  responsehandler.Problem
+// @Router       /tenant/{tenantID}/posts/{slug} [delete]
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	p, err := h.Repository.GetBySlug(vars["tenantID"], vars["slug"])
+	p, err := h.Repository.GetForWrite(r.Context(), vars["tenantID"], vars["slug"])
 
 	if err != nil {
-		responsehandler.EncodeJSONError(w, err, http.StatusBadGateway)
+		responsehandler.EncodeError(w, r, err)
 		return
 	}
 
-	if p == nil {
-		responsehandler.EncodeJSONError(w, nil, http.StatusNotFound)
+	if err := h.Repository.DeleteByID(r.Context(), vars["tenantID"], p.ID); err != nil {
+		responsehandler.EncodeError(w, r, err)
 		return
 	}
 
-	h.Repository.DeleteByID(vars["tenantID"], p.ID)
+	logging.FromContext(r.Context()).Info("post deleted", "post_id", p.ID)
+
 	responsehandler.EncodeJSONResponse(w, nil, http.StatusOK, nil)
 }
 
@@ -179,7 +276,7 @@ func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 		from_int, err = strconv.Atoi(from)
 
 		if err != nil {
-			responsehandler.EncodeJSONError(w, err, http.StatusBadRequest)
+			responsehandler.EncodeError(w, r, apperror.BadRequest("invalid_from", "from must be an integer"))
 			return
 		}
 	}
@@ -193,51 +290,176 @@ func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 		size_int, err = strconv.Atoi(size)
 
 		if err != nil {
-			responsehandler.EncodeJSONError(w, err, http.StatusBadRequest)
+			responsehandler.EncodeError(w, r, apperror.BadRequest("invalid_size", "size must be an integer"))
 			return
 		}
 	}
 
 	if from_int < 0 || size_int > 200 {
-		responsehandler.EncodeJSONError(w, fmt.Errorf("invalid FROM %d smaller than 0 or SIZE %d larger than 100", from_int, size_int), http.StatusBadRequest)
+		responsehandler.EncodeError(w, r, apperror.BadRequest("invalid_page", fmt.Sprintf("invalid FROM %d smaller than 0 or SIZE %d larger than 200", from_int, size_int)))
+		return
 	}
 
 	showDrafts, _ := strconv.ParseBool(vars["showDrafts"])
 
 	filters := make(map[string]interface{})
-	filters["IsPublished"] = true
+	filters[fieldIsPublished] = true
 
 	if showDrafts {
-		filters["AuthorID"] = "abaltra"
-		filters["IsPublished"] = nil
+		filters[fieldAuthorID] = "abaltra"
+		delete(filters, fieldIsPublished)
 	}
 
-	p, err := h.Repository.List(vars["tenantID"], from_int, size_int, filters)
+	p, err := h.Repository.List(r.Context(), vars["tenantID"], from_int, size_int, filters)
 
 	if err != nil {
-		responsehandler.EncodeJSONError(w, err, http.StatusBadRequest)
-	} else {
-		responsehandler.EncodeJSONResponse(w, p, http.StatusOK, nil)
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
+
+	h.cachePolicy(!showDrafts).Apply(w, httpcache.TenantKey(vars["tenantID"]))
+
+	if httpcache.NotModified(w, r, listValidators(p, from_int, size_int, showDrafts)) {
+		return
 	}
+
+	responsehandler.EncodeJSONResponse(w, p, http.StatusOK, nil)
 }
 
 // Create godoc
 // @Summary      Retrieve a Post
 // @Description  Retrieve an existing post
+// @Description  The Accept header selects JSON, the raw markdown or the rendered HTML
 // @Accept       json
 // @Produce      json
+// @Produce      text/markdown
+// @Produce      html
 // @Param        tenantID   path      int  true  "Tenant ID"
 // @Param        slug path string true "Unique slug of post to retrieve"
+// @Param        Accept  header  string  false  "application/json, text/markdown or text/html"
+// @Param        If-None-Match  header  string  false  "ETag of a cached copy"
+// @Param        If-Modified-Since  header  string  false  "Last-Modified of a cached copy"
 // @Success      200  {object}  post.Post
-// @Failure      404  {object}  responsehandler.Error
-// @Router       /v2/tenant/{tenantID}/posts/{slug} [get]
+// @Header       200  {string}  ETag  "Changes with every version of the post"
+// @Header       200  {string}  Last-Modified  "When the post last changed"
+// @Success      304  "The cached copy is current"
+// @Failure      404  {object}  responsehandler.Problem
+// @Failure      406  {object}  responsehandler.Problem
+// @Failure      429  {object}  responsehandler.Problem
+// @Router       /tenant/{tenantID}/posts/{slug} [get]
 func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	p, err := h.Repository.GetBySlug(vars["tenantID"], vars["slug"])
+	w.Header().Add("Vary", "Accept")
+
+	mediaType := negotiation.MediaType(r.Header.Get("Accept"), MediaTypeJSON, MediaTypeMarkdown, MediaTypeHTML)
+	if mediaType == "" {
+		responsehandler.EncodeError(w, r, apperror.New(apperror.KindNotAcceptable, "not_acceptable",
+			fmt.Sprintf("posts are available as %s, %s or %s", MediaTypeJSON, MediaTypeMarkdown, MediaTypeHTML)))
+		return
+	}
+
+	p, err := h.Repository.GetBySlug(r.Context(), vars["tenantID"], vars["slug"])
 	if err != nil {
-		responsehandler.EncodeJSONError(w, err, http.StatusNotFound)
-	} else {
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
+
+	h.cachePolicy(p.IsPublished).Apply(w, httpcache.TenantKey(vars["tenantID"]), httpcache.PostKey(vars["tenantID"], p.Slug))
+
+	if httpcache.NotModified(w, r, postValidators(p, mediaType)) {
+		return
+	}
+
+	switch mediaType {
+	case MediaTypeMarkdown:
+		w.Header().Set("Content-Type", MediaTypeMarkdown+"; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, p.ContentRaw)
+	case MediaTypeHTML:
+		page, err := RenderHTML(p)
+		if err != nil {
+			responsehandler.EncodeError(w, r, apperror.Internal(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", MediaTypeHTML+"; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(page)
+	default:
 		responsehandler.EncodeJSONResponse(w, p, http.StatusOK, nil)
 	}
 }
+
+// IndexReport model info
+// @Description Index drift of every tenant
+type IndexReport struct {
+	InSync  bool         `json:"inSync"`
+	Tenants []IndexDrift `json:"tenants"`
+}
+
+// Create godoc
+// @Summary      Report index drift
+// @Description  Compares the indexes of every tenant with the ones the repository declares
+// @Produce      json
+// @Success      200  {object}  post.IndexReport
+// @Failure      503  {object}  responsehandler.Problem
+// @Router       /admin/indexes [get]
+func (h *Handler) IndexDrift(w http.ResponseWriter, r *http.Request) {
+	drift, err := h.Repository.IndexDrift(r.Context())
+	if err != nil {
+		responsehandler.EncodeError(w, r, err)
+		return
+	}
+
+	report := IndexReport{InSync: true, Tenants: drift}
+	for _, d := range drift {
+		if !d.InSync() {
+			report.InSync = false
+		}
+	}
+
+	responsehandler.EncodeJSONResponse(w, report, http.StatusOK, nil)
+}
+
+func (h *Handler) cachePolicy(published bool) httpcache.Policy {
+	policy := httpcache.Policy{
+		CacheControl:       h.HTTPCache.Drafts,
+		SurrogateKeyHeader: h.HTTPCache.SurrogateKeyHeader,
+	}
+
+	if published {
+		policy.CacheControl = h.HTTPCache.Published
+	}
+
+	return policy
+}
+
+// postValidators identify a representation of a post by its ID, Version and
+// media type, so every change to a post must bump Version.
+func postValidators(p *Post, mediaType string) httpcache.Validators {
+	return httpcache.Validators{
+		ETag:         httpcache.ETag(p.ID, strconv.Itoa(p.Version), mediaType),
+		LastModified: p.lastModified(),
+	}
+}
+
+// listValidators identify a page by the posts on it and how it was asked
+// for.
+func listValidators(posts []*Post, from int, size int, drafts bool) httpcache.Validators {
+	parts := []string{strconv.Itoa(from), strconv.Itoa(size), strconv.FormatBool(drafts)}
+	var lastModified time.Time
+
+	for _, p := range posts {
+		parts = append(parts, p.ID, strconv.Itoa(p.Version))
+
+		if t := p.lastModified(); t.After(lastModified) {
+			lastModified = t
+		}
+	}
+
+	return httpcache.Validators{
+		ETag:         httpcache.ETag(parts...),
+		LastModified: lastModified,
+	}
+}
@@ -0,0 +1,285 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"glog/logging"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares an index the posts collection of every tenant must
+// have.
+type IndexSpec struct {
+	Name   string
+	Keys   bson.D
+	Unique bool
+}
+
+// Indexes are the indexes the repository's queries rely on.
+var Indexes = []IndexSpec{
+	{Name: "slug_unique", Keys: bson.D{{Key: fieldSlug, Value: 1}}, Unique: true},
+	{Name: "id_unique", Keys: bson.D{{Key: fieldID, Value: 1}}, Unique: true},
+	{Name: "published", Keys: bson.D{{Key: fieldIsPublished, Value: 1}, {Key: fieldPublishedAt, Value: -1}}},
+	{Name: "author", Keys: bson.D{{Key: fieldAuthorID, Value: 1}}},
+	{Name: "tags", Keys: bson.D{{Key: fieldIsPublished, Value: 1}, {Key: fieldTags, Value: 1}, {Key: fieldPublishedAt, Value: -1}}},
+}
+
+// IndexDrift model info
+// @Description Differences between the declared and the actual indexes of a tenant
+type IndexDrift struct {
+	Tenant     string   `json:"tenant"`
+	Missing    []string `json:"missing,omitempty"`
+	Changed    []string `json:"changed,omitempty"`
+	Unexpected []string `json:"unexpected,omitempty"`
+}
+
+// InSync reports whether the tenant has exactly the declared indexes.
+func (d IndexDrift) InSync() bool {
+	return len(d.Missing) == 0 && len(d.Changed) == 0 && len(d.Unexpected) == 0
+}
+
+// systemDatabases are never tenants.
+var systemDatabases = []string{"admin", "config", "local"}
+
+// Tenants lists the tenants with a posts collection on the cluster they are
+// routed to. Other databases may belong to other applications sharing the
+// cluster, so they are left alone.
+func (m *Repository) Tenants(ctx context.Context) ([]string, error) {
+	var tenants []string
+	filter := bson.D{{Key: "name", Value: bson.D{{Key: "$nin", Value: systemDatabases}}}}
+	posts := bson.D{{Key: "name", Value: postsCollection}}
+
+	for _, cl := range m.clients.clusters {
+		names, err := cl.client.ListDatabaseNames(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("%s cluster: %w", cl.name, err)
+		}
+
+		for _, name := range names {
+			if m.clients.forTenant(name) != cl.client {
+				continue
+			}
+
+			collections, err := cl.client.Database(name).ListCollectionNames(ctx, posts)
+			if err != nil {
+				return nil, fmt.Errorf("%s cluster, database %s: %w", cl.name, name, err)
+			}
+
+			if len(collections) > 0 {
+				tenants = append(tenants, name)
+			}
+		}
+	}
+
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// ReconcileIndexes makes every known tenant's indexes match Indexes. It is
+// idempotent: missing indexes are created, changed ones are rebuilt and
+// indexes nobody declared are left alone but reported by IndexDrift. Only
+// tenants that already have posts are reconciled, so it never creates a
+// collection. Every tenant is attempted; the first failure is returned.
+func (m *Repository) ReconcileIndexes(ctx context.Context) error {
+	tenants, err := m.Tenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+
+	for _, tenant := range tenants {
+		if err := m.EnsureIndexes(ctx, tenant); err != nil {
+			logging.FromContext(ctx).Error("could not reconcile indexes", "tenant", tenant, "error", err)
+
+			if firstErr == nil {
+				firstErr = fmt.Errorf("tenant %s: %w", tenant, err)
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// EnsureIndexes reconciles the indexes of one tenant.
+func (m *Repository) EnsureIndexes(ctx context.Context, tenantID string) error {
+	drift, err := m.indexDrift(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+
+	indexes := m.collection(tenantID).Indexes()
+
+	for _, name := range drift.Changed {
+		logging.FromContext(ctx).Warn("rebuilding changed index", "tenant", tenantID, "index", name)
+
+		if _, err := indexes.DropOne(ctx, name); err != nil {
+			return fmt.Errorf("dropping index %s: %w", name, err)
+		}
+	}
+
+	var models []mongo.IndexModel
+	for _, spec := range Indexes {
+		if contains(drift.Missing, spec.Name) || contains(drift.Changed, spec.Name) {
+			models = append(models, mongo.IndexModel{
+				Keys:    spec.Keys,
+				Options: options.Index().SetName(spec.Name).SetUnique(spec.Unique),
+			})
+		}
+	}
+
+	if len(models) > 0 {
+		if _, err := indexes.CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("creating indexes: %w", err)
+		}
+
+		logging.FromContext(ctx).Info("created indexes", "tenant", tenantID, "count", len(models))
+	}
+
+	m.indexedMu.Lock()
+	defer m.indexedMu.Unlock()
+
+	if m.indexed == nil {
+		m.indexed = make(map[string]bool)
+	}
+	m.indexed[tenantID] = true
+
+	return nil
+}
+
+// ensureIndexesOnce reconciles a tenant's indexes the first time this
+// process writes to it, so tenants created after startup are indexed too.
+func (m *Repository) ensureIndexesOnce(ctx context.Context, tenantID string) error {
+	m.indexedMu.Lock()
+	done := m.indexed[tenantID]
+	m.indexedMu.Unlock()
+
+	if done {
+		return nil
+	}
+
+	return m.EnsureIndexes(ctx, tenantID)
+}
+
+// IndexDrift compares the indexes of every known tenant with Indexes.
+func (m *Repository) IndexDrift(ctx context.Context) ([]IndexDrift, error) {
+	tenants, err := m.Tenants(ctx)
+	if err != nil {
+		return nil, storageError(ctx, err)
+	}
+
+	report := make([]IndexDrift, 0, len(tenants))
+
+	for _, tenant := range tenants {
+		drift, err := m.indexDrift(ctx, tenant)
+		if err != nil {
+			return nil, storageError(ctx, err)
+		}
+
+		report = append(report, drift)
+	}
+
+	return report, nil
+}
+
+type existingIndex struct {
+	Name   string `bson:"name"`
+	Key    bson.D `bson:"key"`
+	Unique bool   `bson:"unique"`
+}
+
+func (m *Repository) indexDrift(ctx context.Context, tenantID string) (IndexDrift, error) {
+	drift := IndexDrift{Tenant: tenantID}
+
+	var existing []existingIndex
+
+	cursor, err := m.collection(tenantID).Indexes().List(ctx)
+	switch {
+	case isNamespaceNotFound(err):
+		// The collection is created along with its first index.
+	case err != nil:
+		return drift, err
+	default:
+		if err := cursor.All(ctx, &existing); err != nil {
+			return drift, err
+		}
+	}
+
+	byName := make(map[string]existingIndex, len(existing))
+	for _, index := range existing {
+		byName[index.Name] = index
+	}
+
+	for _, spec := range Indexes {
+		index, ok := byName[spec.Name]
+
+		switch {
+		case !ok:
+			drift.Missing = append(drift.Missing, spec.Name)
+		case index.Unique != spec.Unique || !sameKeys(index.Key, spec.Keys):
+			drift.Changed = append(drift.Changed, spec.Name)
+		}
+
+		delete(byName, spec.Name)
+	}
+
+	delete(byName, "_id_")
+	for name := range byName {
+		drift.Unexpected = append(drift.Unexpected, name)
+	}
+	sort.Strings(drift.Unexpected)
+
+	return drift, nil
+}
+
+// sameKeys compares index keys in order. Directions are compared as numbers
+// because the server may return them as int32, int64 or double.
+func sameKeys(a bson.D, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Key != b[i].Key || fmt.Sprint(toFloat(a[i].Value)) != fmt.Sprint(toFloat(b[i].Value)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func toFloat(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	default:
+		return v
+	}
+}
+
+func isNamespaceNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 26
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
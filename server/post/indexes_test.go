@@ -0,0 +1,27 @@
+package post
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSameKeysIgnoresNumericTypes(t *testing.T) {
+	existing := bson.D{{Key: fieldIsPublished, Value: int32(1)}, {Key: fieldPublishedAt, Value: float64(-1)}}
+
+	if !sameKeys(existing, Indexes[2].Keys) {
+		t.Errorf("Expected %v to match %v", existing, Indexes[2].Keys)
+	}
+}
+
+func TestSameKeysDetectsChanges(t *testing.T) {
+	reversed := bson.D{{Key: fieldPublishedAt, Value: -1}, {Key: fieldIsPublished, Value: 1}}
+
+	if sameKeys(reversed, Indexes[2].Keys) {
+		t.Errorf("Expected key order to matter")
+	}
+
+	if sameKeys(bson.D{{Key: fieldSlug, Value: -1}}, Indexes[0].Keys) {
+		t.Errorf("Expected direction to matter")
+	}
+}
@@ -0,0 +1,181 @@
+package post
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"glog/logging"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultMigrationBatchSize = 500
+	DefaultMigrationPause     = 100 * time.Millisecond
+)
+
+// Migrator rewrites documents stored with an older schema to SchemaVersion
+// while the server keeps serving them. Plan finds the tenants that need it;
+// Run then rewrites them in small batches, pausing between batches to keep
+// the load on the cluster low.
+type Migrator struct {
+	Repository *Repository
+	// BatchSize is the number of documents rewritten per update. 0 uses
+	// DefaultMigrationBatchSize.
+	BatchSize int
+	// Pause is the wait between batches. 0 uses DefaultMigrationPause.
+	Pause time.Duration
+}
+
+// Plan marks every tenant holding documents of an older schema, so that the
+// repository's queries also match the old layout until Run is done with it.
+// It returns the number of tenants marked.
+func (g *Migrator) Plan(ctx context.Context) (int, error) {
+	tenants, err := g.Repository.Tenants(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	marked := 0
+
+	for _, tenant := range tenants {
+		n, err := g.Repository.collection(tenant).CountDocuments(ctx, legacyFilter)
+		if err != nil {
+			return marked, fmt.Errorf("tenant %s: %w", tenant, err)
+		}
+
+		if n > 0 {
+			logging.FromContext(ctx).Info("schema migration planned", "tenant", tenant, "documents", n, "schema_version", SchemaVersion)
+			g.Repository.setLegacyDocuments(tenant, true)
+			marked++
+		}
+	}
+
+	return marked, nil
+}
+
+// Run migrates every tenant marked by Plan until it is done or ctx is
+// cancelled. A tenant that fails is logged and left marked, so it is still
+// served correctly and retried on the next start.
+func (g *Migrator) Run(ctx context.Context) error {
+	for _, tenant := range g.Repository.legacyTenants() {
+		n, err := g.MigrateTenant(ctx, tenant)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			logging.FromContext(ctx).Error("schema migration failed", "tenant", tenant, "migrated", n, "error", err)
+			continue
+		}
+
+		logging.FromContext(ctx).Info("schema migration done", "tenant", tenant, "migrated", n)
+	}
+
+	return nil
+}
+
+// MigrateTenant rewrites the older documents of one tenant and returns how
+// many it rewrote. It can be interrupted and run again at any point.
+func (g *Migrator) MigrateTenant(ctx context.Context, tenantID string) (int, error) {
+	collection := g.Repository.collection(tenantID)
+	batch := int64(g.batchSize())
+	total := 0
+
+	for {
+		cursor, err := collection.Find(ctx, legacyFilter, options.Find().
+			SetProjection(bson.D{{Key: "_id", Value: 1}}).
+			SetLimit(batch))
+		if err != nil {
+			return total, err
+		}
+
+		var docs []struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &docs); err != nil {
+			return total, err
+		}
+
+		if len(docs) == 0 {
+			g.Repository.setLegacyDocuments(tenantID, false)
+			return total, nil
+		}
+
+		ids := make(bson.A, len(docs))
+		for i, doc := range docs {
+			ids[i] = doc.ID
+		}
+
+		// Repeating legacyFilter skips documents that Save rewrote since
+		// they were selected.
+		filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+		filter = append(filter, legacyFilter...)
+
+		result, err := collection.UpdateMany(ctx, filter, migrationUpdate())
+		if err != nil {
+			return total, err
+		}
+
+		total += int(result.ModifiedCount)
+
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(g.pause()):
+		}
+	}
+}
+
+func (g *Migrator) batchSize() int {
+	if g.BatchSize <= 0 {
+		return DefaultMigrationBatchSize
+	}
+
+	return g.BatchSize
+}
+
+func (g *Migrator) pause() time.Duration {
+	if g.Pause <= 0 {
+		return DefaultMigrationPause
+	}
+
+	return g.Pause
+}
+
+func (m *Repository) hasLegacyDocuments(tenantID string) bool {
+	m.legacyMu.Lock()
+	defer m.legacyMu.Unlock()
+	return m.legacy[tenantID]
+}
+
+func (m *Repository) setLegacyDocuments(tenantID string, legacy bool) {
+	m.legacyMu.Lock()
+	defer m.legacyMu.Unlock()
+
+	if m.legacy == nil {
+		m.legacy = make(map[string]bool)
+	}
+
+	if legacy {
+		m.legacy[tenantID] = true
+	} else {
+		delete(m.legacy, tenantID)
+	}
+}
+
+func (m *Repository) legacyTenants() []string {
+	m.legacyMu.Lock()
+	defer m.legacyMu.Unlock()
+
+	tenants := make([]string, 0, len(m.legacy))
+	for tenant := range m.legacy {
+		tenants = append(tenants, tenant)
+	}
+
+	sort.Strings(tenants)
+	return tenants
+}
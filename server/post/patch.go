@@ -0,0 +1,124 @@
+package post
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"glog/apperror"
+	"glog/validation"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// Fields of a Post that clients are allowed to change through PATCH.
+// Everything else is managed by the server.
+var mutableFields = map[string]bool{
+	"Title":      true,
+	"Abstract":   true,
+	"ContentRaw": true,
+	"Tags":       true,
+}
+
+// CodeImmutableField is reported for every field a patch is not allowed to
+// change.
+const CodeImmutableField = "immutable_field"
+
+var ErrUnsupportedPatchType = apperror.New(
+	apperror.KindUnsupportedMediaType,
+	"unsupported_patch_type",
+	fmt.Sprintf("patches must be sent as %s or %s", MergePatchContentType, JSONPatchContentType),
+)
+
+func errInvalidPatch(err error) error {
+	return apperror.Wrap(apperror.KindBadRequest, "invalid_patch", "invalid patch: "+err.Error(), err)
+}
+
+// ApplyPatch applies a JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902)
+// document to p, depending on contentType, and returns the patched copy.
+// The original post is left untouched.
+func ApplyPatch(p Post, contentType string, patch []byte) (*Post, error) {
+	original, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched []byte
+
+	switch contentType {
+	case MergePatchContentType:
+		patched, err = jsonpatch.MergePatch(original, patch)
+	case JSONPatchContentType:
+		var ops jsonpatch.Patch
+		ops, err = jsonpatch.DecodePatch(patch)
+		if err == nil {
+			patched, err = ops.Apply(original)
+		}
+	default:
+		return nil, ErrUnsupportedPatchType
+	}
+
+	if err != nil {
+		return nil, errInvalidPatch(err)
+	}
+
+	if err := checkImmutableFields(original, patched); err != nil {
+		return nil, err
+	}
+
+	var result Post
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return nil, errInvalidPatch(err)
+	}
+
+	return &result, nil
+}
+
+func checkImmutableFields(original []byte, patched []byte) error {
+	var before, after map[string]interface{}
+
+	if err := json.Unmarshal(original, &before); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return errInvalidPatch(err)
+	}
+
+	var changed []string
+
+	for key, value := range after {
+		if mutableFields[key] {
+			continue
+		}
+
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, value) {
+			changed = append(changed, key)
+		}
+	}
+
+	for key := range before {
+		if _, ok := after[key]; !ok && !mutableFields[key] {
+			changed = append(changed, key)
+		}
+	}
+
+	if len(changed) > 0 {
+		sort.Strings(changed)
+
+		errs := make(validation.Errors, len(changed))
+		for i, field := range changed {
+			errs[i] = validation.FieldError{Field: field, Code: CodeImmutableField, Message: "cannot be modified"}
+		}
+
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package post
+
+import (
+	"testing"
+
+	"glog/validation"
+)
+
+func TestMergePatchChangesMutableFields(t *testing.T) {
+	p := NewPost("abaltra", CreatePostRequest{Title: "a title", Abstract: "old"})
+
+	patched, err := ApplyPatch(*p, MergePatchContentType, []byte(`{"Abstract": "new", "ContentRaw": "body"}`))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if patched.Abstract != "new" || patched.ContentRaw != "body" {
+		t.Errorf("Expected patch to be applied, got %+v", patched)
+	}
+
+	if patched.Title != p.Title || patched.ID != p.ID {
+		t.Errorf("Expected untouched fields to be kept, got %+v", patched)
+	}
+}
+
+func TestJSONPatchChangesMutableFields(t *testing.T) {
+	p := NewPost("abaltra", CreatePostRequest{Title: "a title"})
+
+	patched, err := ApplyPatch(*p, JSONPatchContentType, []byte(`[{"op": "replace", "path": "/Title", "value": "other"}]`))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if patched.Title != "other" {
+		t.Errorf("Expected Title to equal other, got %s", patched.Title)
+	}
+}
+
+func TestPatchRejectsImmutableFields(t *testing.T) {
+	p := NewPost("abaltra", CreatePostRequest{Title: "a title"})
+
+	patches := map[string]string{
+		MergePatchContentType: `{"ID": "other", "CreatedAt": "2020-01-01T00:00:00Z"}`,
+		JSONPatchContentType:  `[{"op": "remove", "path": "/ID"}]`,
+	}
+
+	for contentType, patch := range patches {
+		_, err := ApplyPatch(*p, contentType, []byte(patch))
+
+		errs, ok := err.(validation.Errors)
+		if !ok || errs[0].Code != CodeImmutableField {
+			t.Errorf("Expected immutable field errors for %s, got %v", contentType, err)
+		}
+	}
+}
+
+func TestPatchRejectsUnknownContentType(t *testing.T) {
+	p := NewPost("abaltra", CreatePostRequest{Title: "a title"})
+
+	if _, err := ApplyPatch(*p, "application/json", []byte(`{}`)); err != ErrUnsupportedPatchType {
+		t.Errorf("Expected ErrUnsupportedPatchType, got %v", err)
+	}
+}
@@ -1,46 +1,156 @@
 package post
 
 import (
+	"fmt"
 	"strings"
 	"time"
+	"unicode"
+
+	"glog/validation"
 
 	"github.com/google/uuid"
 )
 
+const (
+	MaxTitleLength    = 200
+	MaxAbstractLength = 1000
+	MaxContentLength  = 200000
+	MaxTags           = 10
+	MaxTagLength      = 50
+)
+
+// Post is both the API representation and the persisted document. The bson
+// tags are the stored schema; see schema.go for how older layouts are read
+// and migrated.
 type Post struct {
-	ID           string    `json:"ID"`
-	Slug         string    `json:"Slug"`
-	Title        string    `json:"Title"`
-	CreatedAt    time.Time `json:"CreatedAt"`
-	UpdatedAt    time.Time `json:"UpdatedAt"`
-	PublishedAt  time.Time `json:"PublishedAt"`
-	Version      int       `json:"Version"`
-	AuthorID     string    `json:"AuthorID"`
-	Abstract     string    `json:"Abstract"`
-	ContentRaw   string    `json:"ContentRaw"`
-	IsPublished  bool      `json:"IsPublished"`
-	LastEditedBy string    `json:"LastEditedBy"`
+	ID            string    `json:"ID" bson:"id"`
+	Slug          string    `json:"Slug" bson:"slug"`
+	Title         string    `json:"Title" bson:"title"`
+	CreatedAt     time.Time `json:"CreatedAt" bson:"createdAt"`
+	UpdatedAt     time.Time `json:"UpdatedAt" bson:"updatedAt"`
+	PublishedAt   time.Time `json:"PublishedAt" bson:"publishedAt"`
+	Version       int       `json:"Version" bson:"version"`
+	AuthorID      string    `json:"AuthorID" bson:"authorId"`
+	Abstract      string    `json:"Abstract" bson:"abstract"`
+	ContentRaw    string    `json:"ContentRaw" bson:"contentRaw"`
+	IsPublished   bool      `json:"IsPublished" bson:"isPublished"`
+	LastEditedBy  string    `json:"LastEditedBy" bson:"lastEditedBy"`
+	Tags          []string  `json:"Tags" bson:"tags"`
+	SchemaVersion int       `json:"-" bson:"schemaVersion"`
 }
 
+// Names of the Post fields as stored in Mongo. Queries and indexes must use
+// these.
+const (
+	fieldID            = "id"
+	fieldSlug          = "slug"
+	fieldTitle         = "title"
+	fieldCreatedAt     = "createdAt"
+	fieldUpdatedAt     = "updatedAt"
+	fieldPublishedAt   = "publishedAt"
+	fieldVersion       = "version"
+	fieldAuthorID      = "authorId"
+	fieldAbstract      = "abstract"
+	fieldContentRaw    = "contentRaw"
+	fieldIsPublished   = "isPublished"
+	fieldLastEditedBy  = "lastEditedBy"
+	fieldTags          = "tags"
+	fieldSchemaVersion = "schemaVersion"
+)
+
 type CreatePostRequest struct {
-	Title      string `json:"Title"`
-	Abstract   string `json:"Abstract"`
-	ContentRaw string `json:"ContentRaw"`
+	Title      string   `json:"Title"`
+	Abstract   string   `json:"Abstract"`
+	ContentRaw string   `json:"ContentRaw"`
+	Tags       []string `json:"Tags"`
+}
+
+func (r CreatePostRequest) Validate() error {
+	v := validation.New()
+
+	if v.Required("Title", r.Title) && v.Length("Title", r.Title, 1, MaxTitleLength) {
+		v.Charset("Title", r.Title, titleCharset)
+	}
+
+	if v.Length("Abstract", r.Abstract, 0, MaxAbstractLength) {
+		v.Charset("Abstract", r.Abstract, validation.SingleLine)
+	}
+
+	if v.Length("ContentRaw", r.ContentRaw, 0, MaxContentLength) {
+		v.Charset("ContentRaw", r.ContentRaw, validation.MultiLine)
+	}
+
+	if len(r.Tags) > MaxTags {
+		v.Add("Tags", validation.CodeTooLong, fmt.Sprintf("must have at most %d tags", MaxTags))
+	}
+
+	for i, tag := range r.Tags {
+		field := fmt.Sprintf("Tags[%d]", i)
+		if v.Length(field, strings.TrimSpace(tag), 1, MaxTagLength) {
+			v.Charset(field, tag, tagCharset)
+		}
+	}
+
+	return v.Err()
+}
+
+// tagCharset accepts what can be used in a tag page URL.
+func tagCharset(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == ' ' || r == '.'
+}
+
+// NormalizeTags lowercases tags, turns spaces into dashes and drops
+// duplicates, keeping the first occurrence.
+func NormalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized
+}
+
+// titleCharset rejects characters that would end up in the slug and break
+// the post URL.
+func titleCharset(r rune) bool {
+	return validation.SingleLine(r) && !strings.ContainsRune(`/\?#%`, r)
 }
 
 func NewPost(author string, pr CreatePostRequest) *Post {
 	return &Post{
-		CreatedAt:  time.Now(),
-		ID:         uuid.New().String(),
-		Version:    1,
-		AuthorID:   author,
-		Title:      pr.Title,
-		Abstract:   pr.Abstract,
-		ContentRaw: pr.ContentRaw,
-		Slug:       BuildSlug(pr.Title),
+		CreatedAt:     time.Now(),
+		ID:            uuid.New().String(),
+		Version:       1,
+		SchemaVersion: SchemaVersion,
+		AuthorID:      author,
+		Title:         pr.Title,
+		Abstract:      pr.Abstract,
+		ContentRaw:    pr.ContentRaw,
+		Tags:          NormalizeTags(pr.Tags),
+		Slug:          BuildSlug(pr.Title),
 	}
 }
 
+// lastModified is when the post last changed. Posts that were never
+// updated only have CreatedAt.
+func (p *Post) lastModified() time.Time {
+	if p.UpdatedAt.After(p.CreatedAt) {
+		return p.UpdatedAt
+	}
+
+	return p.CreatedAt
+}
+
 func BuildSlug(title string) string {
 	s := strings.ToLower(title)
 	s = strings.ReplaceAll(s, " ", "-")
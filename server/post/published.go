@@ -0,0 +1,161 @@
+package post
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"glog/logging"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PublishedQuery selects published posts for public pages, newest first.
+type PublishedQuery struct {
+	// Tag keeps the posts with this tag, if set.
+	Tag string
+	// Since and Until bound PublishedAt; Until is exclusive. Zero values
+	// leave that side open.
+	Since time.Time
+	Until time.Time
+	From  int
+	Size  int
+}
+
+func (q PublishedQuery) filter() map[string]interface{} {
+	filter := map[string]interface{}{fieldIsPublished: true}
+
+	if q.Tag != "" {
+		filter[fieldTags] = q.Tag
+	}
+
+	published := bson.D{}
+	if !q.Since.IsZero() {
+		published = append(published, bson.E{Key: "$gte", Value: q.Since})
+	}
+
+	if !q.Until.IsZero() {
+		published = append(published, bson.E{Key: "$lt", Value: q.Until})
+	}
+
+	if len(published) > 0 {
+		filter[fieldPublishedAt] = published
+	}
+
+	return filter
+}
+
+func (q PublishedQuery) key() string {
+	return fmt.Sprintf("published-query:%s:%d:%d:%d:%d", q.Tag, q.Since.Unix(), q.Until.Unix(), q.From, q.Size)
+}
+
+// Published returns the published posts q selects, without their content,
+// through the cache.
+func (m *Repository) Published(ctx context.Context, tenantID string, q PublishedQuery) ([]*Post, error) {
+	var posts []*Post
+
+	err := m.Cache.Load(ctx, tenantID, q.key(), &posts, func(ctx context.Context) (interface{}, error) {
+		return m.published(ctx, tenantID, q)
+	})
+
+	return posts, err
+}
+
+func (m *Repository) published(ctx context.Context, tenantID string, q PublishedQuery) (_ []*Post, err error) {
+	ctx, finish := m.start(ctx, "list_published", tenantID, "")
+	defer finish(&err)
+
+	logging.FromContext(ctx).Debug("listing published posts", "tenant", tenantID, "tag", q.Tag, "from", q.From, "size", q.Size)
+
+	// Documents still in the version 0 layout match, but sort as if they
+	// had no publishedAt until the Migrator rewrote them.
+	var query interface{} = q.filter()
+	if m.hasLegacyDocuments(tenantID) {
+		query = withLegacyFields(q.filter())
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: fieldPublishedAt, Value: -1}}).
+		SetSkip(int64(q.From)).
+		SetLimit(int64(q.Size)).
+		SetProjection(bson.D{
+			{Key: "_id", Value: 0},
+			{Key: fieldContentRaw, Value: 0},
+			{Key: legacyFields[fieldContentRaw], Value: 0},
+		})
+
+	cursor, err := m.collection(tenantID).Find(ctx, query, opts)
+	if err != nil {
+		return nil, storageError(ctx, err)
+	}
+
+	posts := []*Post{}
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, storageError(ctx, err)
+	}
+
+	return posts, nil
+}
+
+// ArchiveMonth counts the posts published in a month.
+type ArchiveMonth struct {
+	Year  int `json:"year" bson:"year"`
+	Month int `json:"month" bson:"month"`
+	Posts int `json:"posts" bson:"posts"`
+}
+
+// Archive returns the months with published posts, newest first, through
+// the cache.
+func (m *Repository) Archive(ctx context.Context, tenantID string) ([]ArchiveMonth, error) {
+	var months []ArchiveMonth
+
+	err := m.Cache.Load(ctx, tenantID, "archive", &months, func(ctx context.Context) (interface{}, error) {
+		return m.archive(ctx, tenantID)
+	})
+
+	return months, err
+}
+
+func (m *Repository) archive(ctx context.Context, tenantID string) (_ []ArchiveMonth, err error) {
+	ctx, finish := m.start(ctx, "list_archive", tenantID, "")
+	defer finish(&err)
+
+	var match interface{} = map[string]interface{}{fieldIsPublished: true}
+	var date interface{} = "$" + fieldPublishedAt
+
+	if m.hasLegacyDocuments(tenantID) {
+		match = withLegacyFields(map[string]interface{}{fieldIsPublished: true})
+		date = bson.D{{Key: "$ifNull", Value: bson.A{"$" + fieldPublishedAt, "$" + legacyFields[fieldPublishedAt]}}}
+	}
+
+	pipeline := bson.A{
+		bson.D{{Key: "$match", Value: match}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "year", Value: bson.D{{Key: "$year", Value: date}}},
+				{Key: "month", Value: bson.D{{Key: "$month", Value: date}}},
+			}},
+			{Key: "posts", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "year", Value: "$_id.year"},
+			{Key: "month", Value: "$_id.month"},
+			{Key: "posts", Value: 1},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "year", Value: -1}, {Key: "month", Value: -1}}}},
+	}
+
+	cursor, err := m.collection(tenantID).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, storageError(ctx, err)
+	}
+
+	months := []ArchiveMonth{}
+	if err := cursor.All(ctx, &months); err != nil {
+		return nil, storageError(ctx, err)
+	}
+
+	return months, nil
+}
@@ -0,0 +1,93 @@
+package post
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// Media types a post can be served as.
+const (
+	MediaTypeJSON     = "application/json"
+	MediaTypeMarkdown = "text/markdown"
+	MediaTypeHTML     = "text/html"
+)
+
+// markdown renders ContentRaw. Raw HTML in posts is not rendered, so a post
+// cannot inject scripts into the page.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+var page = template.Must(template.New("post").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+{{if .Abstract}}<meta name="description" content="{{.Abstract}}">
+{{end}}</head>
+<body>
+<article>
+<h1>{{.Title}}</h1>
+{{.Body}}
+</article>
+</body>
+</html>
+`))
+
+// RenderMarkdown renders the content of a post to HTML that is safe to
+// embed in a page.
+func RenderMarkdown(src string) (template.HTML, error) {
+	var body bytes.Buffer
+	if err := markdown.Convert([]byte(src), &body); err != nil {
+		return "", err
+	}
+
+	return template.HTML(body.String()), nil
+}
+
+// RenderHTML renders a post as a standalone HTML page.
+func RenderHTML(p *Post) ([]byte, error) {
+	body, err := RenderMarkdown(p.ContentRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	err = page.Execute(&out, struct {
+		Title    string
+		Abstract string
+		Body     template.HTML
+	}{
+		Title:    p.Title,
+		Abstract: p.Abstract,
+		Body:     body,
+	})
+
+	return out.Bytes(), err
+}
+
+// MediaReferences returns the URLs of the images a post's content embeds,
+// in order and without duplicates.
+func MediaReferences(src string) []string {
+	source := []byte(src)
+	doc := markdown.Parser().Parse(text.NewReader(source))
+
+	var refs []string
+	seen := make(map[string]bool)
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if img, ok := n.(*ast.Image); ok && entering {
+			if dest := string(img.Destination); dest != "" && !seen[dest] {
+				seen[dest] = true
+				refs = append(refs, dest)
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return refs
+}
@@ -0,0 +1,40 @@
+package post
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderHTML(t *testing.T) {
+	p := &Post{
+		Title:      "Fish & <Chips>",
+		ContentRaw: "# Hello\n\nSome *text*.\n\n<script>alert(1)</script>\n",
+	}
+
+	b, err := RenderHTML(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := string(b)
+
+	if !strings.Contains(page, "<title>Fish &amp; &lt;Chips&gt;</title>") {
+		t.Errorf("Expected escaped title, got %s", page)
+	}
+
+	if !strings.Contains(page, "<em>text</em>") {
+		t.Errorf("Expected rendered markdown, got %s", page)
+	}
+
+	if strings.Contains(page, "<script>") {
+		t.Errorf("Expected raw HTML to be dropped, got %s", page)
+	}
+}
+
+func TestMediaReferences(t *testing.T) {
+	refs := MediaReferences("![a](/media/a.png) and [a link](/x)\n\n![again](/media/a.png \"title\") ![b](https://cdn.example.com/b.jpg)\n")
+
+	if len(refs) != 2 || refs[0] != "/media/a.png" || refs[1] != "https://cdn.example.com/b.jpg" {
+		t.Errorf("Expected the two images once each, got %v", refs)
+	}
+}
@@ -2,106 +2,203 @@ package post
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"glog/apperror"
+	"glog/cache"
 	"glog/config"
+	"glog/logging"
+	"glog/metrics"
+	"glog/tracing"
+	"strings"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Repository stores posts in one database per tenant. It owns its Mongo
+// clients: Connect opens them and Disconnect closes them.
 type Repository struct {
-	Config *config.Config
+	Config  *config.Config
+	Metrics *metrics.Metrics
+	// Cache serves published posts and lists without querying Mongo. It is
+	// optional.
+	Cache *cache.Cache
+
+	clients *clients
+
+	// indexed remembers the tenants whose indexes this process reconciled,
+	// so Create only pays for it on a tenant's first post.
+	indexedMu sync.Mutex
+	indexed   map[string]bool
+
+	// legacy holds the tenants the Migrator found documents of an older
+	// schema in and has not finished rewriting.
+	legacyMu sync.Mutex
+	legacy   map[string]bool
 }
 
-var DB *mongo.Client
+// NewRepository returns a repository that keeps every tenant on an already
+// connected client instead of calling Connect, e.g. in tests.
+func NewRepository(cfg *config.Config, m *metrics.Metrics, client *mongo.Client) *Repository {
+	return &Repository{
+		Config:  cfg,
+		Metrics: m,
+		clients: &clients{
+			fallback: client,
+			clusters: []cluster{{name: "default", client: client}},
+		},
+	}
+}
 
-func (m *Repository) Init() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Connect creates the Mongo clients and checks that every cluster answers.
+// It can be retried: a failed attempt leaves no client behind.
+func (m *Repository) Connect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Config.Storage.Timeouts.For("connect"))
 	defer cancel()
-	var err error
-	DB, err = mongo.Connect(ctx, options.Client().ApplyURI(m.Config.DBConnectionString))
 
+	c, err := connectAll(ctx, m.Config.Storage, m.Metrics.PoolMonitor())
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	if err := m.Ping(); err != nil {
-		panic(err)
+	m.clients = c
+	logging.FromContext(ctx).Info("connected to mongo", "clusters", len(c.clusters))
+
+	return nil
+}
+
+// Disconnect closes the Mongo clients, waiting for in-use connections to be
+// returned until ctx is done.
+func (m *Repository) Disconnect(ctx context.Context) error {
+	if m.clients == nil {
+		return nil
 	}
 
-	fmt.Printf("Connected to Mongo DB at %s\n", m.Config.DBConnectionString)
+	return m.clients.disconnect(ctx)
 }
 
-func (m *Repository) Ping() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Ping checks every cluster the repository is connected to.
+func (m *Repository) Ping(ctx context.Context) error {
+	if m.clients == nil {
+		return errNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Config.Storage.Timeouts.For("ping"))
 	defer cancel()
-	return DB.Ping(ctx, readpref.Primary())
+
+	return m.clients.ping(ctx)
 }
 
-func (m *Repository) Create(tenantID string, post Post) (Post, error) {
-	fmt.Println("Creating a post")
+var errNotConnected = errors.New("not connected to mongo")
 
-	postsCollection := DB.Database(tenantID).Collection("posts")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// collection returns the posts collection of tenantID on its cluster.
+// postsCollection holds the posts of a tenant, in the tenant's database.
+const postsCollection = "posts"
+
+func (m *Repository) collection(tenantID string) *mongo.Collection {
+	return m.clients.forTenant(tenantID).Database(tenantID).Collection(postsCollection)
+}
+
+func (m *Repository) Create(ctx context.Context, tenantID string, post Post) (_ Post, err error) {
+	ctx, finish := m.start(ctx, "create", tenantID, post.Slug)
+	defer finish(&err)
+
+	logging.FromContext(ctx).Debug("creating a post", "tenant", tenantID, "slug", post.Slug)
+
+	if err := m.ensureIndexesOnce(ctx, tenantID); err != nil {
+		logging.FromContext(ctx).Warn("could not ensure indexes", "tenant", tenantID, "error", err)
+	}
 
-	_, err := postsCollection.InsertOne(ctx, post)
+	post.SchemaVersion = SchemaVersion
+	postsCollection := m.collection(tenantID)
 
-	return post, err
+	_, err = postsCollection.InsertOne(ctx, post)
+
+	if mongo.IsDuplicateKeyError(err) {
+		return post, apperror.Conflict("post_exists", fmt.Sprintf("a post with slug %q already exists", post.Slug))
+	}
+
+	return post, storageError(ctx, err)
 }
 
-func (m *Repository) Save(tenantID string, p Post) error {
-	fmt.Println("Updating a post")
+func (m *Repository) Save(ctx context.Context, tenantID string, p Post) (err error) {
+	defer m.invalidate(ctx, tenantID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	ctx, finish := m.start(ctx, "save", tenantID, p.Slug)
+	defer finish(&err)
+
+	logging.FromContext(ctx).Debug("updating a post", "tenant", tenantID, "slug", p.Slug)
 
 	filter := map[string]string{
-		"slug": p.Slug,
+		fieldID: p.ID,
+	}
+
+	postsCollection := m.collection(tenantID)
+	result, err := postsCollection.UpdateOne(ctx, filter, updateDocument(p))
+
+	if err != nil {
+		return storageError(ctx, err)
 	}
 
-	postsCollection := DB.Database(tenantID).Collection("posts")
-	_, err := postsCollection.UpdateOne(ctx, filter, p)
+	if result.MatchedCount == 0 {
+		return apperror.NotFound("post_not_found", fmt.Sprintf("post %q does not exist", p.Slug))
+	}
 
-	return err
+	return nil
 }
 
-func (m *Repository) DeleteBySlug(tenantID string, slug string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (m *Repository) DeleteBySlug(ctx context.Context, tenantID string, slug string) (err error) {
+	defer m.invalidate(ctx, tenantID)
+
+	ctx, finish := m.start(ctx, "delete_by_slug", tenantID, slug)
+	defer finish(&err)
+
+	logging.FromContext(ctx).Debug("deleting a post", "tenant", tenantID, "slug", slug)
+
 	filter := map[string]string{
-		"slug": slug,
+		fieldSlug: slug,
 	}
 
-	postsCollection := DB.Database(tenantID).Collection("posts")
-	_, err := postsCollection.DeleteMany(ctx, filter)
+	postsCollection := m.collection(tenantID)
+	_, err = postsCollection.DeleteMany(ctx, filter)
 
-	return err
+	return storageError(ctx, err)
 }
 
-func (m *Repository) DeleteByID(tenantID string, id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (m *Repository) DeleteByID(ctx context.Context, tenantID string, id string) (err error) {
+	defer m.invalidate(ctx, tenantID)
+
+	ctx, finish := m.start(ctx, "delete_by_id", tenantID, "")
+	defer finish(&err)
+
+	logging.FromContext(ctx).Debug("deleting a post", "tenant", tenantID, "id", id)
+
 	filter := map[string]string{
-		"id": id,
+		fieldID: id,
 	}
-	postsCollection := DB.Database(tenantID).Collection("posts")
-	_, err := postsCollection.DeleteMany(ctx, filter)
+	postsCollection := m.collection(tenantID)
+	_, err = postsCollection.DeleteMany(ctx, filter)
 
-	return err
+	return storageError(ctx, err)
 }
 
-func (m *Repository) List(tenantID string, from int, size int, filters map[string]interface{}) ([]*Post, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	fmt.Printf("Listing posts. From %d, page size %d\n", from, size)
+func (m *Repository) list(ctx context.Context, tenantID string, from int, size int, filters map[string]interface{}) (_ []*Post, err error) {
+	ctx, finish := m.start(ctx, "list", tenantID, "")
+	defer finish(&err)
 
-	query := make(map[string]interface{})
+	logging.FromContext(ctx).Debug("listing posts", "tenant", tenantID, "from", from, "size", size)
 
-	for key, value := range filters {
-		query[key] = value
+	var query interface{} = filters
+	if m.hasLegacyDocuments(tenantID) {
+		query = withLegacyFields(filters)
 	}
 
 	_f := int64(from)
@@ -110,18 +207,19 @@ func (m *Repository) List(tenantID string, from int, size int, filters map[strin
 		Skip:  &_f,
 		Limit: &_s,
 		Projection: map[string]int{
-			"_id":        0,
-			"ContentRaw": 0,
+			"_id":                         0,
+			fieldContentRaw:               0,
+			legacyFields[fieldContentRaw]: 0,
 		},
 	}
 
 	results := []*Post{}
 
-	postsCollection := DB.Database(tenantID).Collection("posts")
+	postsCollection := m.collection(tenantID)
 	curr, err := postsCollection.Find(ctx, query, options)
 
 	if err != nil {
-		return nil, err
+		return nil, storageError(ctx, err)
 	}
 
 	defer curr.Close(ctx)
@@ -130,7 +228,7 @@ func (m *Repository) List(tenantID string, from int, size int, filters map[strin
 		var result Post
 		err := curr.Decode(&result)
 		if err != nil {
-			return nil, err
+			return nil, storageError(ctx, err)
 		}
 
 		results = append(results, &result)
@@ -139,17 +237,94 @@ func (m *Repository) List(tenantID string, from int, size int, filters map[strin
 	return results, nil
 }
 
-func (m *Repository) GetBySlug(tenantID string, slug string) (*Post, error) {
-	fmt.Printf("Getting post by slug %s\n", slug)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func (m *Repository) getBySlug(ctx context.Context, tenantID string, slug string) (_ *Post, err error) {
+	ctx, finish := m.start(ctx, "get_by_slug", tenantID, slug)
+	defer finish(&err)
+
+	logging.FromContext(ctx).Debug("getting post by slug", "tenant", tenantID, "slug", slug)
+
 	filter := map[string]string{
-		"slug": slug,
+		fieldSlug: slug,
 	}
 
 	var result Post
-	postsCollection := DB.Database(tenantID).Collection("posts")
-	err := postsCollection.FindOne(ctx, filter).Decode(&result)
+	postsCollection := m.collection(tenantID)
+	err = postsCollection.FindOne(ctx, filter).Decode(&result)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, apperror.NotFound("post_not_found", fmt.Sprintf("post %q does not exist", slug))
+	}
+
+	if err != nil {
+		return nil, storageError(ctx, err)
+	}
+
+	return &result, nil
+}
+
+// start opens a span for a repository operation and bounds it by the
+// operation's configured timeout; delete_by_slug and delete_by_id share the
+// delete timeout, get_by_slug uses get. The returned function must be
+// deferred with a pointer to the operation's named error so it records the
+// final outcome in the span and in the metrics.
+func (m *Repository) start(ctx context.Context, operation string, tenantID string, slug string) (context.Context, func(*error)) {
+	timeoutKey, _, _ := strings.Cut(operation, "_")
+	ctx, cancel := context.WithTimeout(ctx, m.Config.Storage.Timeouts.For(timeoutKey))
+
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemMongoDB,
+		semconv.DBNameKey.String(tenantID),
+		semconv.DBMongoDBCollectionKey.String(postsCollection),
+		tracing.TenantKey.String(tenantID),
+	}
+
+	if slug != "" {
+		attrs = append(attrs, tracing.SlugKey.String(slug))
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "post.Repository/"+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	start := time.Now()
+
+	return ctx, func(err *error) {
+		cancel()
+		m.Metrics.ObserveRepository(operation, start, *err)
+
+		if *err != nil && !apperror.Is(*err, apperror.KindNotFound) {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+
+		span.End()
+	}
+}
+
+// storageError classifies driver errors. An operation cut short by ctx is
+// reported as canceled when the caller gave up and as a timeout when its
+// deadline passed; connectivity problems are an unavailable upstream and
+// anything else is internal.
+func storageError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled) || errors.Is(err, context.Canceled):
+		return apperror.Canceled("request_canceled", "the request was canceled", err)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err):
+		return apperror.Timeout("storage_timeout", "the post storage did not answer in time", err)
+	}
+
+	if mongo.IsNetworkError(err) {
+		return apperror.Unavailable("storage_unavailable", "the post storage is unavailable", err)
+	}
+
+	var serverSelection topology.ServerSelectionError
+	if errors.As(err, &serverSelection) {
+		return apperror.Unavailable("storage_unavailable", "the post storage is unavailable", err)
+	}
 
-	return &result, err
+	return apperror.Internal(err)
 }
@@ -0,0 +1,41 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"glog/apperror"
+)
+
+func TestStorageErrorReportsCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := storageError(ctx, errors.New("operation was interrupted"))
+
+	if !apperror.Is(err, apperror.KindCanceled) {
+		t.Errorf("Expected a canceled error, got %v", err)
+	}
+}
+
+func TestStorageErrorReportsTimeouts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	err := storageError(ctx, errors.New("operation was interrupted"))
+
+	if !apperror.Is(err, apperror.KindTimeout) {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+}
+
+func TestStorageErrorHidesOtherErrors(t *testing.T) {
+	err := storageError(context.Background(), errors.New("boom"))
+
+	if !apperror.Is(err, apperror.KindInternal) {
+		t.Errorf("Expected an internal error, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package post
+
+import (
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SchemaVersion is the layout new and updated documents are written with.
+//
+//	0: no schemaVersion field; field names are the Go names lowercased by
+//	   the driver (createdat, authorid, ispublished...)
+//	1: explicit camelCase names from the bson tags on Post
+const SchemaVersion = 1
+
+// legacyFields maps the current name of every field renamed since version 0
+// to its old name.
+var legacyFields = map[string]string{
+	fieldCreatedAt:    "createdat",
+	fieldUpdatedAt:    "updatedat",
+	fieldPublishedAt:  "publishedat",
+	fieldAuthorID:     "authorid",
+	fieldContentRaw:   "contentraw",
+	fieldIsPublished:  "ispublished",
+	fieldLastEditedBy: "lasteditedby",
+}
+
+// legacyPost is the version 0 layout.
+type legacyPost struct {
+	ID           string    `bson:"id"`
+	Slug         string    `bson:"slug"`
+	Title        string    `bson:"title"`
+	CreatedAt    time.Time `bson:"createdat"`
+	UpdatedAt    time.Time `bson:"updatedat"`
+	PublishedAt  time.Time `bson:"publishedat"`
+	Version      int       `bson:"version"`
+	AuthorID     string    `bson:"authorid"`
+	Abstract     string    `bson:"abstract"`
+	ContentRaw   string    `bson:"contentraw"`
+	IsPublished  bool      `bson:"ispublished"`
+	LastEditedBy string    `bson:"lasteditedby"`
+}
+
+// storedPost has Post's fields without its UnmarshalBSON method.
+type storedPost Post
+
+// UnmarshalBSON reads documents of any schema version, so posts can be
+// served while the Migrator is still rewriting them.
+func (p *Post) UnmarshalBSON(data []byte) error {
+	if _, err := bson.Raw(data).LookupErr(fieldSchemaVersion); err == nil {
+		return bson.Unmarshal(data, (*storedPost)(p))
+	}
+
+	var legacy legacyPost
+	if err := bson.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+
+	*p = Post{
+		ID:           legacy.ID,
+		Slug:         legacy.Slug,
+		Title:        legacy.Title,
+		CreatedAt:    legacy.CreatedAt,
+		UpdatedAt:    legacy.UpdatedAt,
+		PublishedAt:  legacy.PublishedAt,
+		Version:      legacy.Version,
+		AuthorID:     legacy.AuthorID,
+		Abstract:     legacy.Abstract,
+		ContentRaw:   legacy.ContentRaw,
+		IsPublished:  legacy.IsPublished,
+		LastEditedBy: legacy.LastEditedBy,
+	}
+
+	return nil
+}
+
+// updateDocument is the update Save writes. It sets every field but the
+// ones the filter matches on, so saving a post still in an older layout
+// rewrites it completely, and unsets the old names.
+func updateDocument(p Post) bson.D {
+	unset := bson.D{}
+	for _, legacy := range sortedLegacyFields() {
+		unset = append(unset, bson.E{Key: legacy, Value: ""})
+	}
+
+	return bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: fieldSlug, Value: p.Slug},
+			{Key: fieldTitle, Value: p.Title},
+			{Key: fieldCreatedAt, Value: p.CreatedAt},
+			{Key: fieldUpdatedAt, Value: p.UpdatedAt},
+			{Key: fieldPublishedAt, Value: p.PublishedAt},
+			{Key: fieldVersion, Value: p.Version},
+			{Key: fieldAuthorID, Value: p.AuthorID},
+			{Key: fieldAbstract, Value: p.Abstract},
+			{Key: fieldContentRaw, Value: p.ContentRaw},
+			{Key: fieldIsPublished, Value: p.IsPublished},
+			{Key: fieldLastEditedBy, Value: p.LastEditedBy},
+			{Key: fieldTags, Value: p.Tags},
+			{Key: fieldSchemaVersion, Value: SchemaVersion},
+		}},
+		{Key: "$unset", Value: unset},
+	}
+}
+
+// legacyFilter matches the documents still in the version 0 layout.
+var legacyFilter = bson.D{{Key: fieldSchemaVersion, Value: bson.D{{Key: "$exists", Value: false}}}}
+
+// migrationUpdate rewrites a version 0 document to the current layout. Only
+// documents the Migrator selected as version 0 may be given to it, since
+// $rename would otherwise overwrite current fields with stale ones.
+func migrationUpdate() bson.D {
+	rename := bson.D{}
+	for _, current := range sortedCurrentFields() {
+		rename = append(rename, bson.E{Key: legacyFields[current], Value: current})
+	}
+
+	return bson.D{
+		{Key: "$rename", Value: rename},
+		{Key: "$set", Value: bson.D{{Key: fieldSchemaVersion, Value: SchemaVersion}}},
+	}
+}
+
+// withLegacyFields rewrites an equality filter on current field names so it
+// also matches documents that still use the version 0 names.
+func withLegacyFields(filter map[string]interface{}) bson.D {
+	query := bson.D{}
+	var alternatives bson.A
+
+	for key, value := range filter {
+		legacy, renamed := legacyFields[key]
+		if !renamed {
+			query = append(query, bson.E{Key: key, Value: value})
+			continue
+		}
+
+		alternatives = append(alternatives, bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: key, Value: value}},
+			bson.D{{Key: legacy, Value: value}},
+		}}})
+	}
+
+	if len(alternatives) > 0 {
+		query = append(query, bson.E{Key: "$and", Value: alternatives})
+	}
+
+	return query
+}
+
+func sortedCurrentFields() []string {
+	fields := make([]string, 0, len(legacyFields))
+	for current := range legacyFields {
+		fields = append(fields, current)
+	}
+
+	sort.Strings(fields)
+	return fields
+}
+
+func sortedLegacyFields() []string {
+	fields := make([]string, 0, len(legacyFields))
+	for _, current := range sortedCurrentFields() {
+		fields = append(fields, legacyFields[current])
+	}
+
+	return fields
+}
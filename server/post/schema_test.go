@@ -0,0 +1,63 @@
+package post
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUnmarshalReadsLegacyDocuments(t *testing.T) {
+	created := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	data, err := bson.Marshal(legacyPost{ID: "1", Slug: "hello", CreatedAt: created, AuthorID: "abaltra", IsPublished: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p Post
+	if err := bson.Unmarshal(data, &p); err != nil {
+		t.Fatalf("Expected a legacy document to decode, got %v", err)
+	}
+
+	if p.Slug != "hello" || !p.CreatedAt.Equal(created) || p.AuthorID != "abaltra" || !p.IsPublished {
+		t.Errorf("Unexpected post %+v", p)
+	}
+}
+
+func TestPostsAreStoredWithExplicitNames(t *testing.T) {
+	data, err := bson.Marshal(Post{ID: "1", AuthorID: "abaltra", SchemaVersion: SchemaVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := bson.Raw(data)
+	for _, field := range []string{fieldID, fieldAuthorID, fieldIsPublished, fieldSchemaVersion} {
+		if _, err := raw.LookupErr(field); err != nil {
+			t.Errorf("Expected field %s to be stored, got %v", field, err)
+		}
+	}
+
+	var p Post
+	if err := bson.Unmarshal(data, &p); err != nil || p.AuthorID != "abaltra" {
+		t.Errorf("Expected the post to round trip, got %+v (%v)", p, err)
+	}
+}
+
+func TestWithLegacyFieldsMatchesBothNames(t *testing.T) {
+	query := withLegacyFields(map[string]interface{}{fieldSlug: "hello", fieldIsPublished: true})
+
+	expected := bson.D{
+		{Key: fieldSlug, Value: "hello"},
+		{Key: "$and", Value: bson.A{bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: fieldIsPublished, Value: true}},
+			bson.D{{Key: "ispublished", Value: true}},
+		}}}}},
+	}
+
+	got, _ := bson.MarshalExtJSON(query, false, false)
+	want, _ := bson.MarshalExtJSON(expected, false, false)
+
+	if string(got) != string(want) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,43 @@
+package post
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags := NormalizeTags([]string{"Go", " web  dev ", "go", "", "Web-Dev"})
+
+	if expected := []string{"go", "web-dev"}; !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Expected %v, got %v", expected, tags)
+	}
+
+	if NormalizeTags(nil) != nil {
+		t.Errorf("Expected no tags to stay nil")
+	}
+}
+
+func TestTagsAreValidated(t *testing.T) {
+	r := CreatePostRequest{Title: "Tagged", Tags: []string{"fine", "no/slash", strings.Repeat("a", MaxTagLength+1)}}
+
+	err := r.Validate()
+	for _, field := range []string{"Tags[1]", "Tags[2]"} {
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected %s to be reported, got %v", field, err)
+		}
+	}
+
+	if err != nil && strings.Contains(err.Error(), "Tags[0]") {
+		t.Errorf("Expected Tags[0] to be valid, got %v", err)
+	}
+
+	r.Tags = make([]string, MaxTags+1)
+	for i := range r.Tags {
+		r.Tags[i] = "tag"
+	}
+
+	if err := r.Validate(); err == nil {
+		t.Errorf("Expected more than %d tags to be rejected", MaxTags)
+	}
+}
@@ -0,0 +1,239 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"glog/apperror"
+	"glog/logging"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// eachBatchSize is how many posts Each reads per query.
+const eachBatchSize = 200
+
+// Each calls fn with every post of a tenant, drafts and content included.
+// Posts are read in batches, each under the list timeout, so tenants of any
+// size can be walked.
+func (m *Repository) Each(ctx context.Context, tenantID string, fn func(*Post) error) error {
+	var after interface{}
+
+	for {
+		posts, last, err := m.eachBatch(ctx, tenantID, after)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range posts {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+
+		if len(posts) < eachBatchSize {
+			return nil
+		}
+
+		after = last
+	}
+}
+
+// eachBatch reads the posts stored after the _id after, in _id order, and
+// returns the _id of the last one.
+func (m *Repository) eachBatch(ctx context.Context, tenantID string, after interface{}) (_ []*Post, last interface{}, err error) {
+	ctx, finish := m.start(ctx, "list_all", tenantID, "")
+	defer finish(&err)
+
+	filter := bson.D{}
+	if after != nil {
+		filter = bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: after}}}}
+	}
+
+	cursor, err := m.collection(tenantID).Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(eachBatchSize))
+	if err != nil {
+		return nil, nil, storageError(ctx, err)
+	}
+	defer cursor.Close(ctx)
+
+	posts := []*Post{}
+
+	for cursor.Next(ctx) {
+		var p Post
+		if err := cursor.Decode(&p); err != nil {
+			return nil, nil, storageError(ctx, err)
+		}
+
+		posts = append(posts, &p)
+		last = cursor.Current.Lookup("_id")
+	}
+
+	return posts, last, storageError(ctx, cursor.Err())
+}
+
+// Conflict is what Import does with a post whose ID or slug is taken.
+type Conflict string
+
+const (
+	// ConflictSkip keeps the stored post and drops the imported one.
+	ConflictSkip Conflict = "skip"
+	// ConflictOverwrite replaces the stored posts with the same ID or slug.
+	ConflictOverwrite Conflict = "overwrite"
+	// ConflictRename stores the imported post under a new ID or a free
+	// slug, such as my-post-2.
+	ConflictRename Conflict = "rename"
+)
+
+// ParseConflict parses a Conflict, defaulting to ConflictSkip.
+func ParseConflict(s string) (Conflict, error) {
+	switch c := Conflict(s); c {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return c, nil
+	}
+
+	return "", apperror.BadRequest("invalid_conflict", fmt.Sprintf("conflict must be skip, overwrite or rename, got %q", s))
+}
+
+// ImportOutcome is what Import did with a post.
+type ImportOutcome string
+
+const (
+	ImportCreated     ImportOutcome = "created"
+	ImportSkipped     ImportOutcome = "skipped"
+	ImportOverwritten ImportOutcome = "overwritten"
+	ImportRenamed     ImportOutcome = "renamed"
+)
+
+// Import stores a post taken from another tenant or environment as it is,
+// keeping its ID, dates and version. The ID and slug of p are updated when
+// it is renamed.
+func (m *Repository) Import(ctx context.Context, tenantID string, p *Post, conflict Conflict) (_ ImportOutcome, err error) {
+	defer m.invalidate(ctx, tenantID)
+
+	ctx, finish := m.start(ctx, "import", tenantID, p.Slug)
+	defer finish(&err)
+
+	logging.FromContext(ctx).Debug("importing a post", "tenant", tenantID, "slug", p.Slug, "conflict", conflict)
+
+	if err := m.ensureIndexesOnce(ctx, tenantID); err != nil {
+		logging.FromContext(ctx).Warn("could not ensure indexes", "tenant", tenantID, "error", err)
+	}
+
+	collection := m.collection(tenantID)
+	p.SchemaVersion = SchemaVersion
+
+	_, idTaken, err := m.findID(ctx, collection, fieldID, p.ID)
+	if err != nil {
+		return "", err
+	}
+
+	slugOwner, slugTaken, err := m.findID(ctx, collection, fieldSlug, p.Slug)
+	if err != nil {
+		return "", err
+	}
+
+	outcome := ImportCreated
+
+	switch {
+	case !idTaken && !slugTaken:
+	case conflict == ConflictSkip:
+		return ImportSkipped, nil
+	case conflict == ConflictOverwrite:
+		if slugTaken && slugOwner != p.ID {
+			if _, err := collection.DeleteMany(ctx, bson.D{{Key: fieldID, Value: slugOwner}}); err != nil {
+				return "", storageError(ctx, err)
+			}
+		}
+
+		if idTaken {
+			_, err := collection.ReplaceOne(ctx, bson.D{{Key: fieldID, Value: p.ID}}, p)
+			return ImportOverwritten, storageError(ctx, err)
+		}
+
+		outcome = ImportOverwritten
+	case conflict == ConflictRename:
+		if idTaken {
+			p.ID = uuid.New().String()
+		}
+
+		if slugTaken {
+			if p.Slug, err = m.freeSlug(ctx, collection, p.Slug); err != nil {
+				return "", err
+			}
+		}
+
+		outcome = ImportRenamed
+	default:
+		return "", apperror.BadRequest("invalid_conflict", fmt.Sprintf("unknown conflict strategy %q", conflict))
+	}
+
+	_, err = collection.InsertOne(ctx, p)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", apperror.Conflict("post_exists", fmt.Sprintf("a post with slug %q already exists", p.Slug))
+	}
+
+	if err != nil {
+		return "", storageError(ctx, err)
+	}
+
+	return outcome, nil
+}
+
+// findID returns the ID of the post whose field has value, if any.
+func (m *Repository) findID(ctx context.Context, collection *mongo.Collection, field, value string) (string, bool, error) {
+	var found struct {
+		ID string `bson:"id"`
+	}
+
+	err := collection.FindOne(ctx, bson.D{{Key: field, Value: value}},
+		options.FindOne().SetProjection(bson.D{{Key: fieldID, Value: 1}})).Decode(&found)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", false, nil
+	}
+
+	if err != nil {
+		return "", false, storageError(ctx, err)
+	}
+
+	return found.ID, true, nil
+}
+
+// freeSlug returns slug with the smallest suffix, from -2, no post has.
+func (m *Repository) freeSlug(ctx context.Context, collection *mongo.Collection, slug string) (string, error) {
+	pattern := "^" + regexp.QuoteMeta(slug) + "-[0-9]+$"
+
+	cursor, err := collection.Find(ctx, bson.D{{Key: fieldSlug, Value: bson.D{{Key: "$regex", Value: pattern}}}},
+		options.Find().SetProjection(bson.D{{Key: fieldSlug, Value: 1}}))
+	if err != nil {
+		return "", storageError(ctx, err)
+	}
+
+	var taken []struct {
+		Slug string `bson:"slug"`
+	}
+	if err := cursor.All(ctx, &taken); err != nil {
+		return "", storageError(ctx, err)
+	}
+
+	used := make(map[string]bool, len(taken))
+	for _, t := range taken {
+		used[t.Slug] = true
+	}
+
+	for n := 2; ; n++ {
+		if candidate := slug + "-" + strconv.Itoa(n); !used[candidate] {
+			return candidate, nil
+		}
+	}
+}
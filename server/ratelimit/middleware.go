@@ -0,0 +1,234 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"glog/apperror"
+	"glog/logging"
+	"glog/metrics"
+	"glog/responsehandler"
+
+	"github.com/gorilla/mux"
+)
+
+// Class groups routes sharing limits.
+type Class string
+
+const (
+	Read   Class = "read"
+	Write  Class = "write"
+	Search Class = "search"
+)
+
+// Rule limits one class of routes for each client and for each tenant. A
+// zero Limit is not enforced.
+type Rule struct {
+	Client Limit
+	Tenant Limit
+}
+
+// Limiter rejects requests with 429 once their client or tenant ran out of
+// tokens. A client is identified by its API key when it sends a known one,
+// and by its IP address otherwise. Store failures never reject a request.
+type Limiter struct {
+	Store   Store
+	Rules   map[Class]Rule
+	Metrics *metrics.Metrics
+
+	apiKeys        map[string]bool
+	trustedProxies []*net.IPNet
+}
+
+// NewLimiter returns a Limiter recognizing apiKeys and believing the
+// X-Forwarded-For header of requests coming from trustedProxies, given as
+// IP addresses or CIDR ranges.
+func NewLimiter(store Store, rules map[Class]Rule, apiKeys []string, trustedProxies []string) (*Limiter, error) {
+	l := &Limiter{
+		Store:   store,
+		Rules:   rules,
+		apiKeys: make(map[string]bool, len(apiKeys)),
+	}
+
+	for _, key := range apiKeys {
+		l.apiKeys[key] = true
+	}
+
+	for _, proxy := range trustedProxies {
+		network, err := ParseNetwork(proxy)
+		if err != nil {
+			return nil, err
+		}
+
+		l.trustedProxies = append(l.trustedProxies, network)
+	}
+
+	return l, nil
+}
+
+// ParseNetwork parses a CIDR range or a single IP address.
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: s}
+		}
+
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(s)
+	return network, err
+}
+
+// Middleware limits the routes it wraps as class. It must run as a mux
+// middleware or wrap a route handler, so the tenant of the route is known.
+func (l *Limiter) Middleware(class Class) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule := l.Rules[class]
+			tenantID := mux.Vars(r)["tenantID"]
+			if tenantID == "" {
+				rule.Tenant = Limit{}
+			}
+
+			var results []Result
+
+			buckets := []struct {
+				scope string
+				key   string
+				limit Limit
+			}{
+				{"client", string(class) + ":client:" + l.client(r), rule.Client},
+				{"tenant", string(class) + ":tenant:" + tenantID, rule.Tenant},
+			}
+
+			for _, b := range buckets {
+				if b.limit.Requests <= 0 {
+					continue
+				}
+
+				result, err := l.Store.Take(r.Context(), b.key, b.limit)
+				if err != nil {
+					logging.FromContext(r.Context()).Warn("rate limit store failed", "error", err)
+					continue
+				}
+
+				results = append(results, result)
+
+				if !result.Allowed {
+					l.Metrics.RateLimited(string(class), b.scope)
+					writeHeaders(w, result)
+					w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+					responsehandler.EncodeError(w, r, apperror.New(apperror.KindTooManyRequests, "rate_limited",
+						"too many "+string(class)+" requests for this "+b.scope+", retry later"))
+					return
+				}
+			}
+
+			if len(results) > 0 {
+				writeHeaders(w, tightest(results))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// client identifies who sent r. API keys are hashed so they never end up in
+// a shared store.
+func (l *Limiter) client(r *http.Request) string {
+	if key := apiKey(r); key != "" && l.apiKeys[key] {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+
+	return "ip:" + l.clientIP(r)
+}
+
+func apiKey(r *http.Request) string {
+	const prefix = "Bearer "
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return strings.TrimSpace(auth[len(prefix):])
+	}
+
+	return ""
+}
+
+// clientIP walks X-Forwarded-For from the right, skipping trusted proxies,
+// so a client cannot pick its own address by sending the header itself.
+func (l *Limiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !l.trusted(ip) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+
+		ip = hop
+		if !l.trusted(hop) {
+			break
+		}
+	}
+
+	return ip.String()
+}
+
+func (l *Limiter) trusted(ip net.IP) bool {
+	for _, network := range l.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeHeaders sets the RateLimit header fields of the IETF httpapi draft.
+func writeHeaders(w http.ResponseWriter, r Result) {
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(r.Limit.Requests))
+	h.Set("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(r.Reset)))
+	h.Set("RateLimit-Policy", strconv.Itoa(r.Limit.Requests)+";w="+strconv.Itoa(ceilSeconds(r.Limit.Period)))
+}
+
+// tightest returns the result closest to being rejected.
+func tightest(results []Result) Result {
+	best := results[0]
+
+	for _, r := range results[1:] {
+		if r.Remaining < best.Remaining {
+			best = r
+		}
+	}
+
+	return best
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a token bucket holding up to Requests tokens, refilled at
+// Requests per Period. A client can burst through a full bucket and is then
+// held to the average rate.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// rate returns the refill rate in tokens per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result reports the state of a bucket after taking a token from it.
+type Result struct {
+	Allowed bool
+	Limit   Limit
+	// Remaining is the number of whole tokens left.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token, when not Allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. Take removes a token from the bucket of key,
+// creating a full one if there is none.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	Close() error
+}
+
+// refill returns the tokens of a bucket that held tokens elapsed ago.
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return tokens
+	}
+
+	return math.Min(float64(limit.Requests), tokens+elapsed.Seconds()*limit.rate())
+}
+
+// newResult describes a bucket left with tokens.
+func newResult(limit Limit, tokens float64, allowed bool) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Requests) - tokens) / limit.rate()),
+	}
+
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / limit.rate())
+	}
+
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+var perMinute = Limit{Requests: 2, Period: time.Minute}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func testBucket(t *testing.T, store Store, c *clock) {
+	ctx := context.Background()
+
+	for i, want := range []int{1, 0} {
+		r, err := store.Take(ctx, "k", perMinute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !r.Allowed || r.Remaining != want {
+			t.Errorf("Expected request %d to be allowed with %d remaining, got %+v", i, want, r)
+		}
+	}
+
+	r, _ := store.Take(ctx, "k", perMinute)
+	if r.Allowed {
+		t.Errorf("Expected the third request to be rejected")
+	}
+
+	if r.RetryAfter <= 0 || r.RetryAfter > 30*time.Second {
+		t.Errorf("Expected to retry within 30s, got %s", r.RetryAfter)
+	}
+
+	c.now = c.now.Add(30 * time.Second)
+
+	if r, _ := store.Take(ctx, "k", perMinute); !r.Allowed {
+		t.Errorf("Expected a token after 30s, got %+v", r)
+	}
+
+	if r, _ := store.Take(ctx, "other", perMinute); !r.Allowed || r.Remaining != 1 {
+		t.Errorf("Expected keys to have their own bucket, got %+v", r)
+	}
+}
+
+func TestMemoryBucket(t *testing.T) {
+	c := &clock{now: time.Date(2022, 5, 6, 7, 8, 9, 0, time.UTC)}
+	store := NewMemory()
+	store.now = c.Now
+
+	testBucket(t, store, c)
+
+	c.now = c.now.Add(2 * sweepInterval)
+	store.Take(context.Background(), "k", perMinute)
+
+	if store.Len() != 1 {
+		t.Errorf("Expected full buckets to be forgotten, got %d buckets", store.Len())
+	}
+}
+
+func TestRedisBucket(t *testing.T) {
+	c := &clock{now: time.Date(2022, 5, 6, 7, 8, 9, 0, time.UTC)}
+	srv := miniredis.RunT(t)
+	store := NewRedis(redis.NewClient(&redis.Options{Addr: srv.Addr()}), "glog:")
+	store.now = c.Now
+	defer store.Close()
+
+	testBucket(t, store, c)
+
+	if !srv.Exists("glog:k") {
+		t.Errorf("Expected bucket to be stored under the prefix")
+	}
+}
+
+func serve(l *Limiter, r *http.Request) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.Handle("/tenant/{tenantID}/posts", l.Middleware(Write)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func request(remoteAddr string, headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/tenant/1/posts", nil)
+	r.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+
+	return r
+}
+
+func TestMiddlewareLimitsClients(t *testing.T) {
+	l, err := NewLimiter(NewMemory(), map[Class]Rule{
+		Write: {Client: Limit{Requests: 1, Period: time.Minute}, Tenant: Limit{Requests: 10, Period: time.Minute}},
+	}, []string{"0123456789abcdef"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(l, request("192.0.2.1:1234", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected first request to pass, got %d", w.Code)
+	}
+
+	if w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected the client bucket in the headers, got %v", w.Header())
+	}
+
+	w = serve(l, request("192.0.2.1:1234", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+
+	if w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected Retry-After 60, got %q", w.Header().Get("Retry-After"))
+	}
+
+	if w := serve(l, request("192.0.2.2:1234", nil)); w.Code != http.StatusCreated {
+		t.Errorf("Expected another IP to pass, got %d", w.Code)
+	}
+
+	key := map[string]string{"Authorization": "Bearer 0123456789abcdef"}
+	if w := serve(l, request("192.0.2.1:1234", key)); w.Code != http.StatusCreated {
+		t.Errorf("Expected a known API key to have its own bucket, got %d", w.Code)
+	}
+
+	unknown := map[string]string{"Authorization": "Bearer fedcba9876543210"}
+	if w := serve(l, request("192.0.2.1:1234", unknown)); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected an unknown API key to count against the IP, got %d", w.Code)
+	}
+}
+
+func TestMiddlewareLimitsTenants(t *testing.T) {
+	l, _ := NewLimiter(NewMemory(), map[Class]Rule{
+		Write: {Tenant: Limit{Requests: 1, Period: time.Minute}},
+	}, nil, nil)
+
+	serve(l, request("192.0.2.1:1234", nil))
+
+	if w := serve(l, request("192.0.2.2:1234", nil)); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the tenant limit to apply to every client, got %d", w.Code)
+	}
+}
+
+func TestClientIPBehindTrustedProxy(t *testing.T) {
+	l, err := NewLimiter(NewMemory(), nil, nil, []string{"10.0.0.0/8", "192.0.2.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forwarded := map[string]string{"X-Forwarded-For": "203.0.113.7, 198.51.100.1, 10.1.2.3"}
+
+	if ip := l.clientIP(request("10.0.0.1:1234", forwarded)); ip != "198.51.100.1" {
+		t.Errorf("Expected the first untrusted hop, got %s", ip)
+	}
+
+	if ip := l.clientIP(request("192.0.2.1:1234", forwarded)); ip != "192.0.2.1" {
+		t.Errorf("Expected X-Forwarded-For from an untrusted peer to be ignored, got %s", ip)
+	}
+
+	if _, err := NewLimiter(NewMemory(), nil, nil, []string{"not-an-ip"}); err == nil {
+		t.Errorf("Expected an invalid proxy to be rejected")
+	}
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// takeScript updates a bucket atomically, so instances sharing the database
+// enforce a single limit. Tokens are returned as a string because Redis
+// truncates Lua numbers to integers.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+
+if tokens == nil then
+	tokens = capacity
+	updated = now
+end
+
+if now > updated then
+	tokens = math.min(capacity, tokens + (now - updated) * rate)
+	updated = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(updated))
+redis.call("PEXPIRE", KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// Redis keeps buckets in a database shared by every instance of the server.
+// Keys are prefixed so the database can be shared with other applications.
+type Redis struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix, now: time.Now}
+}
+
+func (s *Redis) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	// The rate is in tokens per millisecond, the unit of now.
+	rate := limit.rate() / 1000
+
+	v, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Requests, strconv.FormatFloat(rate, 'g', -1, 64), s.now().UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := v[0].(int64)
+	raw, _ := v[1].(string)
+
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(limit, tokens, allowed == 1), nil
+}
+
+func (s *Redis) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *Redis) Close() error {
+	return s.client.Close()
+}
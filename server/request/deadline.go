@@ -0,0 +1,38 @@
+package request
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"glog/logging"
+)
+
+type connKey struct{}
+
+// ConnContext keeps the connection of each request in its context, so that
+// ExtendDeadlines can reach it. Set it as the http.Server's ConnContext.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// ExtendDeadlines gives requests d to send their body and read the response,
+// instead of the server's ReadTimeout and WriteTimeout, for routes streaming
+// large bodies. Over HTTP/2 the server times each stream itself and the
+// timeouts cannot be changed before Go 1.20, so those requests keep them.
+func ExtendDeadlines(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if conn, ok := r.Context().Value(connKey{}).(net.Conn); ok && r.ProtoMajor == 1 {
+				deadline := time.Now().Add(d)
+				conn.SetReadDeadline(deadline)
+				conn.SetWriteDeadline(deadline)
+			} else {
+				logging.FromContext(r.Context()).Warn("cannot extend the deadlines of the request; the server timeouts apply", "proto", r.Proto)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
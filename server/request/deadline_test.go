@@ -0,0 +1,70 @@
+package request
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trickle sends chunks of data a tick apart.
+func trickle(w io.Writer, chunks int, tick time.Duration) {
+	for i := 0; i < chunks; i++ {
+		time.Sleep(tick)
+		w.Write([]byte("chunk\n"))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+func TestExtendDeadlinesOutlastsServerTimeouts(t *testing.T) {
+	const tick = 40 * time.Millisecond
+
+	// Reading the upload and streaming the answer each take longer than the
+	// server's timeouts.
+	stream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.Copy(io.Discard, r.Body); err != nil {
+			return
+		}
+
+		trickle(w, 5, tick)
+	})
+
+	for _, tc := range []struct {
+		name     string
+		handler  http.Handler
+		complete bool
+	}{
+		{"server timeouts", stream, false},
+		{"extended", ExtendDeadlines(time.Minute)(stream), true},
+	} {
+		srv := httptest.NewUnstartedServer(tc.handler)
+		srv.Config.ReadTimeout = 2 * tick
+		srv.Config.WriteTimeout = 2 * tick
+		srv.Config.ConnContext = ConnContext
+		srv.Start()
+
+		body, upload := io.Pipe()
+		go func() {
+			trickle(upload, 5, tick)
+			upload.Close()
+		}()
+
+		var received []byte
+		res, err := http.Post(srv.URL, "application/zip", body)
+		if err == nil {
+			received, err = io.ReadAll(res.Body)
+			res.Body.Close()
+		}
+
+		complete := err == nil && string(received) == strings.Repeat("chunk\n", 5)
+		if complete != tc.complete {
+			t.Errorf("Expected a complete answer with %s to be %t, got %q and %v", tc.name, tc.complete, received, err)
+		}
+
+		srv.Close()
+	}
+}
@@ -0,0 +1,150 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"glog/apperror"
+	"glog/responsehandler"
+	"glog/validation"
+)
+
+// ContentTypeJSON is the media type DecodeJSON accepts.
+const ContentTypeJSON = "application/json"
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// ErrUnsupportedMediaType is returned by DecodeJSON for bodies that are not
+// sent as JSON.
+var ErrUnsupportedMediaType = apperror.New(
+	apperror.KindUnsupportedMediaType,
+	"unsupported_media_type",
+	"request bodies must be sent as "+ContentTypeJSON,
+)
+
+func tooLarge(maxBytes int64) error {
+	return apperror.Wrap(apperror.KindPayloadTooLarge, "body_too_large",
+		fmt.Sprintf("request bodies must not exceed %d bytes", maxBytes), errBodyTooLarge)
+}
+
+// LimitBody rejects requests with a body larger than maxBytes with 413.
+// Bodies announcing their length are rejected before the handler runs;
+// others fail the read that crosses the limit.
+func LimitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				responsehandler.EncodeError(w, r, tooLarge(maxBytes))
+				return
+			}
+
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &limitedBody{ReadCloser: r.Body, max: maxBytes, remaining: maxBytes}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	max       int64
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, tooLarge(b.max)
+	}
+
+	// Reading one byte past the limit tells a body of exactly maxBytes
+	// from a larger one.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+
+	if b.remaining < 0 {
+		return n + int(b.remaining), tooLarge(b.max)
+	}
+
+	return n, err
+}
+
+// DecodeJSON decodes the JSON object in the body of r into dst and
+// validates it. It requires a JSON Content-Type and rejects unknown fields
+// and anything after the object. Malformed JSON is reported as a bad
+// request, failing fields as validation errors.
+func DecodeJSON(r *http.Request, dst validation.Validatable) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != ContentTypeJSON {
+		return ErrUnsupportedMediaType
+	}
+
+	body := &recordingReader{r: r.Body}
+	err = validation.DecodeReader(body, dst)
+
+	if body.err != nil {
+		return readError(body.err)
+	}
+
+	var syntax *validation.SyntaxError
+	if errors.As(err, &syntax) {
+		return apperror.Wrap(apperror.KindBadRequest, "malformed_json", syntax.Error(), err)
+	}
+
+	return err
+}
+
+// ReadBody reads the whole body of r, which must be bounded by LimitBody.
+func ReadBody(r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, readError(err)
+	}
+
+	return b, nil
+}
+
+// CopyBody copies the body of r to dst, for bodies too large to hold in
+// memory. The body must be bounded by LimitBody.
+func CopyBody(dst io.Writer, r *http.Request) (int64, error) {
+	body := &recordingReader{r: r.Body}
+
+	n, err := io.Copy(dst, body)
+	if body.err != nil {
+		return n, readError(body.err)
+	}
+
+	return n, err
+}
+
+func readError(err error) error {
+	if errors.Is(err, errBodyTooLarge) {
+		return err
+	}
+
+	return apperror.Wrap(apperror.KindBadRequest, "unreadable_body", "could not read request body", err)
+}
+
+// recordingReader keeps the error of the underlying reader, which the JSON
+// decoder may report as malformed input.
+type recordingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if err != nil && err != io.EOF {
+		rr.err = err
+	}
+
+	return n, err
+}
@@ -0,0 +1,94 @@
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"glog/apperror"
+	"glog/validation"
+)
+
+type note struct {
+	Text string `json:"Text"`
+}
+
+func (n note) Validate() error {
+	v := validation.New()
+	v.Required("Text", n.Text)
+	return v.Err()
+}
+
+func post(body string, contentType string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+func decodeLimited(r *http.Request, maxBytes int64) (note, *httptest.ResponseRecorder, error) {
+	var n note
+	var err error
+
+	w := httptest.NewRecorder()
+	LimitBody(maxBytes)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = DecodeJSON(r, &n)
+	})).ServeHTTP(w, r)
+
+	return n, w, err
+}
+
+func TestDecodeJSON(t *testing.T) {
+	n, _, err := decodeLimited(post(`{"Text": "hello"}`, "application/json; charset=utf-8"), 1024)
+
+	if err != nil || n.Text != "hello" {
+		t.Errorf("Expected the note to be decoded, got %+v and %v", n, err)
+	}
+}
+
+func TestDecodeJSONRequiresJSON(t *testing.T) {
+	_, _, err := decodeLimited(post(`{"Text": "hello"}`, "text/plain"), 1024)
+
+	if !apperror.Is(err, apperror.KindUnsupportedMediaType) {
+		t.Errorf("Expected an unsupported media type error, got %v", err)
+	}
+}
+
+func TestDecodeJSONReportsMalformedBodies(t *testing.T) {
+	_, _, err := decodeLimited(post(`{"Text": "hello"} trailing`, ContentTypeJSON), 1024)
+
+	if !apperror.Is(err, apperror.KindBadRequest) {
+		t.Errorf("Expected a bad request, got %v", err)
+	}
+
+	_, _, err = decodeLimited(post(`{"Text": "hello", "Extra": 1}`, ContentTypeJSON), 1024)
+
+	if _, ok := err.(validation.Errors); !ok {
+		t.Errorf("Expected unknown fields to be validation errors, got %v", err)
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	body := `{"Text": "` + strings.Repeat("a", 100) + `"}`
+
+	_, w, _ := decodeLimited(post(body, ContentTypeJSON), 50)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected a declared oversized body to get 413, got %d", w.Code)
+	}
+
+	// Without Content-Length the limit applies while reading.
+	r := post(body, ContentTypeJSON)
+	r.ContentLength = -1
+
+	_, _, err := decodeLimited(r, 50)
+	if !apperror.Is(err, apperror.KindPayloadTooLarge) {
+		t.Errorf("Expected a payload too large error, got %v", err)
+	}
+
+	r = post(body, ContentTypeJSON)
+	r.ContentLength = -1
+
+	if _, _, err := decodeLimited(r, int64(len(body))); err != nil {
+		t.Errorf("Expected a body of exactly the limit to pass, got %v", err)
+	}
+}
@@ -2,24 +2,124 @@ package responsehandler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"glog/apperror"
+	"glog/logging"
+	"glog/validation"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+	ProblemTypeBase    = "https://blog.abaltra.me/problems/"
+
+	// StatusClientClosedRequest is the non-standard status, borrowed from
+	// nginx, reported when the client went away before the response was
+	// ready. It only ever reaches logs and metrics.
+	StatusClientClosedRequest = 499
 )
 
+// Problem model info
+// @Description RFC 7807 problem details with a stable error code and the request ID
+type Problem struct {
+	Type      string                  `json:"type"`
+	Title     string                  `json:"title"`
+	Status    int                     `json:"status"`
+	Code      string                  `json:"code"`
+	Detail    string                  `json:"detail,omitempty"`
+	Instance  string                  `json:"instance,omitempty"`
+	RequestID string                  `json:"requestId,omitempty"`
+	Errors    []validation.FieldError `json:"errors,omitempty"`
+	// Partial is what a request that failed part way did before it
+	// stopped, such as the report of an import.
+	Partial interface{} `json:"partial,omitempty"`
+}
+
+var statusByKind = map[apperror.Kind]int{
+	apperror.KindNotFound:             http.StatusNotFound,
+	apperror.KindConflict:             http.StatusConflict,
+	apperror.KindValidation:           http.StatusUnprocessableEntity,
+	apperror.KindUnauthorized:         http.StatusUnauthorized,
+	apperror.KindUnavailable:          http.StatusServiceUnavailable,
+	apperror.KindTimeout:              http.StatusGatewayTimeout,
+	apperror.KindCanceled:             StatusClientClosedRequest,
+	apperror.KindBadRequest:           http.StatusBadRequest,
+	apperror.KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	apperror.KindPayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	apperror.KindNotAcceptable:        http.StatusNotAcceptable,
+	apperror.KindMethodNotAllowed:     http.StatusMethodNotAllowed,
+	apperror.KindTooManyRequests:      http.StatusTooManyRequests,
+	apperror.KindInternal:             http.StatusInternalServerError,
+}
+
+// StatusFor returns the HTTP status code that err is reported with.
+func StatusFor(err error) int {
+	if status, ok := statusByKind[apperror.KindOf(err)]; ok {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// NewProblem builds the problem details for err as seen by request r.
+func NewProblem(r *http.Request, err error) *Problem {
+	kind := apperror.KindOf(err)
+	status := StatusFor(err)
+
+	problem := &Problem{
+		Type:      ProblemTypeBase + string(kind),
+		Title:     statusText(status),
+		Status:    status,
+		Code:      string(kind),
+		Instance:  r.URL.Path,
+		RequestID: r.Header.Get(logging.RequestIDHeader),
+	}
+
+	var appErr *apperror.Error
+	var validationErrs validation.Errors
+
+	switch {
+	case errors.As(err, &appErr):
+		problem.Code = appErr.Code
+		problem.Detail = appErr.Detail
+	case errors.As(err, &validationErrs):
+		problem.Code = "validation_failed"
+		problem.Detail = "request validation failed"
+		problem.Errors = validationErrs
+	default:
+		problem.Code = "internal_error"
+		problem.Detail = "an unexpected error occurred"
+	}
+
+	return problem
+}
+
+// EncodeError renders err as application/problem+json. Errors that are not
+// domain errors are reported as 500 without leaking their message.
+func EncodeError(w http.ResponseWriter, r *http.Request, err error) {
+	EncodeProblem(w, r, NewProblem(r, err), err)
+}
+
+// EncodeProblem renders a problem built by NewProblem for err, which a
+// handler may have added to, and logs err as EncodeError does.
+func EncodeProblem(w http.ResponseWriter, r *http.Request, problem *Problem, err error) {
+	switch {
+	case problem.Status >= http.StatusInternalServerError:
+		logging.FromContext(r.Context()).Error("request failed", "code", problem.Code, "error", err)
+	case problem.Status == StatusClientClosedRequest:
+		logging.FromContext(r.Context()).Info("request canceled by the client", "code", problem.Code)
+	}
 
-// Error model info
-// @Description Error message with HTTP status code and error message
-type Error struct {
-	StatusCode int    `json:"StatusCode"`
-	Message    string `json:"Message"`
+	w.Header().Set("Content-type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
 }
 
-func EncodeJSONError(w http.ResponseWriter, err error, status int) {
-	response := &Error{
-		StatusCode: status,
-		Message:    err.Error(),
+func statusText(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
 	}
 
-	w.Header().Set("Content-type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode((response))
+	return http.StatusText(status)
 }
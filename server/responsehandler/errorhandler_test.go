@@ -0,0 +1,84 @@
+package responsehandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"glog/apperror"
+	"glog/validation"
+)
+
+func encode(t *testing.T, err error) (*httptest.ResponseRecorder, Problem) {
+	r := httptest.NewRequest(http.MethodGet, "/tenant/1/posts/missing", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	w := httptest.NewRecorder()
+
+	EncodeError(w, r, err)
+
+	var problem Problem
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatalf("Expected a problem body, got %v", err)
+	}
+
+	return w, problem
+}
+
+func TestEncodeErrorMapsDomainErrors(t *testing.T) {
+	w, problem := encode(t, apperror.NotFound("post_not_found", "post does not exist"))
+
+	if w.Code != http.StatusNotFound || problem.Status != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	if ct := w.Header().Get("Content-type"); ct != ProblemContentType {
+		t.Errorf("Expected content type %s, got %s", ProblemContentType, ct)
+	}
+
+	if problem.Code != "post_not_found" || problem.Type != ProblemTypeBase+"not-found" {
+		t.Errorf("Unexpected code %s or type %s", problem.Code, problem.Type)
+	}
+
+	if problem.Instance != "/tenant/1/posts/missing" || problem.RequestID != "req-1" {
+		t.Errorf("Unexpected instance %s or request ID %s", problem.Instance, problem.RequestID)
+	}
+}
+
+func TestEncodeErrorListsValidationErrors(t *testing.T) {
+	err := validation.Errors{{Field: "Title", Code: validation.CodeRequired, Message: "is required"}}
+
+	w, problem := encode(t, err)
+
+	if w.Code != http.StatusUnprocessableEntity || len(problem.Errors) != 1 {
+		t.Errorf("Expected a 422 listing one field, got %d with %v", w.Code, problem.Errors)
+	}
+}
+
+func TestEncodeErrorHidesUnknownErrors(t *testing.T) {
+	w, problem := encode(t, errors.New("connection string has a password in it"))
+
+	if w.Code != http.StatusInternalServerError || problem.Code != "internal_error" {
+		t.Errorf("Expected an internal error, got %d %s", w.Code, problem.Code)
+	}
+
+	if problem.Detail == "connection string has a password in it" {
+		t.Errorf("Expected the original message to be hidden")
+	}
+}
+
+func TestEncodeErrorDistinguishesTimeoutsFromCancellations(t *testing.T) {
+	w, problem := encode(t, apperror.Timeout("storage_timeout", "timed out", context.DeadlineExceeded))
+
+	if w.Code != http.StatusGatewayTimeout || problem.Code != "storage_timeout" {
+		t.Errorf("Expected a 504 storage_timeout, got %d %s", w.Code, problem.Code)
+	}
+
+	w, problem = encode(t, apperror.Canceled("request_canceled", "canceled", context.Canceled))
+
+	if w.Code != StatusClientClosedRequest || problem.Title != "Client Closed Request" {
+		t.Errorf("Expected a 499 Client Closed Request, got %d %s", w.Code, problem.Title)
+	}
+}
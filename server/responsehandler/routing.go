@@ -0,0 +1,48 @@
+package responsehandler
+
+import (
+	"net/http"
+	"strings"
+
+	"glog/apperror"
+
+	"github.com/gorilla/mux"
+)
+
+// allowable are the methods MethodNotAllowed offers in Allow.
+var allowable = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// RouteNotFound answers requests that no route matches, as the router's
+// NotFoundHandler.
+func RouteNotFound(w http.ResponseWriter, r *http.Request) {
+	EncodeError(w, r, apperror.NotFound("route_not_found", "no route matches "+r.URL.Path))
+}
+
+// MethodNotAllowed answers requests whose path is routed by router but not
+// for their method, as its MethodNotAllowedHandler. Allow lists the methods
+// the path is routed for.
+func MethodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+
+		for _, method := range allowable {
+			probe := r.Clone(r.Context())
+			probe.Method = method
+
+			var match mux.RouteMatch
+			if router.Match(probe, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
+
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		EncodeError(w, r, apperror.New(apperror.KindMethodNotAllowed, "method_not_allowed", r.Method+" is not allowed on "+r.URL.Path))
+	})
+}
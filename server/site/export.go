@@ -0,0 +1,525 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"glog/logging"
+	"glog/post"
+)
+
+// ManifestName is the file in which an export records what it wrote.
+const ManifestName = ".glog-export.json"
+
+// Exporter writes the blog of a tenant as static files: every published
+// post, the index, tag and archive pages with their pagination, the theme's
+// assets, a 404.html and, given a BaseURL, the Atom feed and the sitemap.
+// Pages are laid out as directories, such as posts/<slug>/index.html, and
+// link to them with a trailing slash.
+//
+// An export records the files it wrote in ManifestName. The next export into
+// the same directory rewrites only the files whose content changed, does not
+// render again the posts that were not updated, and removes the files of
+// posts that are no longer published.
+type Exporter struct {
+	Posts    Posts
+	Themes   *Themes
+	Theme    string
+	PageSize int
+	// BaseURL is the absolute URL the files will be served from. Without
+	// it, links start at the root of the host and there is no feed or
+	// sitemap, which need absolute URLs.
+	BaseURL string
+	// Relative makes links relative to each page, so the files can be
+	// served from any path.
+	Relative  bool
+	FeedItems int
+	// Full rewrites every file, whatever the previous export wrote.
+	Full bool
+}
+
+// ExportStats counts the files an export went through.
+type ExportStats struct {
+	Written   int
+	Unchanged int
+	Removed   int
+}
+
+type exportManifest struct {
+	Tenant string `json:"tenant"`
+	// Settings fingerprints what post pages depend on besides their post.
+	Settings string `json:"settings"`
+	// Posts holds the UpdatedAt of every exported post, by slug.
+	Posts map[string]time.Time `json:"posts"`
+	// Files holds the SHA-256 of every file written, by path.
+	Files map[string]string `json:"files"`
+}
+
+// Export writes the blog of tenantID into dir.
+func (e *Exporter) Export(ctx context.Context, tenantID, dir string) (ExportStats, error) {
+	base := strings.TrimSuffix(e.BaseURL, "/")
+	if base != "" {
+		u, err := url.Parse(base)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ExportStats{}, fmt.Errorf("base URL %q is not an absolute http or https URL", e.BaseURL)
+		}
+	}
+
+	theme, err := e.Themes.Get(e.Theme)
+	if err != nil {
+		return ExportStats{}, err
+	}
+
+	posts, err := allPublished(ctx, e.Posts, tenantID)
+	if err != nil {
+		return ExportStats{}, err
+	}
+
+	run := &exportRun{
+		Exporter: e,
+		ctx:      ctx,
+		tenant:   tenantID,
+		base:     base,
+		theme:    theme,
+		size:     e.PageSize,
+	}
+
+	if run.size <= 0 {
+		run.size = DefaultPageSize
+	}
+
+	run.out, err = newExportWriter(dir, exportManifest{
+		Tenant:   tenantID,
+		Settings: fmt.Sprintf("%s|%s|%s|%t|%d", theme.Name, theme.digest, base, e.Relative, e.FeedItems),
+		Posts:    make(map[string]time.Time),
+		Files:    make(map[string]string),
+	}, e.Full)
+	if err != nil {
+		return ExportStats{}, err
+	}
+
+	for _, step := range []func([]*post.Post) error{run.posts, run.lists, run.extras, run.static} {
+		if err := step(posts); err != nil {
+			return run.out.stats, err
+		}
+	}
+
+	err = run.out.finish()
+	return run.out.stats, err
+}
+
+// exportRun is one Export.
+type exportRun struct {
+	*Exporter
+	ctx    context.Context
+	tenant string
+	base   string
+	theme  *Theme
+	size   int
+	out    *exportWriter
+}
+
+// page returns the Page written at file, whose links are relative to it if
+// the export asks for it.
+func (r *exportRun) page(file string) Page {
+	base := r.base
+	if r.Relative {
+		base = "."
+		if depth := strings.Count(file, "/"); depth > 0 {
+			base = strings.TrimSuffix(strings.Repeat("../", depth), "/")
+		}
+	}
+
+	page := Page{Tenant: r.tenant, BaseURL: base, StaticURL: base + "/static", dirs: true}
+	if r.feed() {
+		page.FeedURL = base + "/feed.xml"
+	}
+
+	return page
+}
+
+func (r *exportRun) feed() bool {
+	return r.base != "" && r.FeedItems > 0
+}
+
+func (r *exportRun) render(name, file string, page Page) error {
+	var buf bytes.Buffer
+	if err := r.theme.Execute(&buf, name, page); err != nil {
+		return fmt.Errorf("rendering %s: %w", file, err)
+	}
+
+	return r.out.write(file, buf.Bytes())
+}
+
+// posts writes a page per post, skipping those unchanged since the
+// previous export.
+func (r *exportRun) posts(posts []*post.Post) error {
+	sameSettings := r.out.previous.Tenant == r.tenant && r.out.previous.Settings == r.out.next.Settings
+
+	for _, summary := range posts {
+		if !validSegment(summary.Slug) {
+			logging.FromContext(r.ctx).Warn("skipping post with a slug unfit for a path", "tenant", r.tenant, "slug", summary.Slug)
+			continue
+		}
+
+		file := path.Join("posts", summary.Slug, "index.html")
+		r.out.next.Posts[summary.Slug] = summary.UpdatedAt
+
+		updatedAt, exported := r.out.previous.Posts[summary.Slug]
+		if sameSettings && exported && updatedAt.Equal(summary.UpdatedAt) && r.out.keep(file) {
+			continue
+		}
+
+		p, err := r.Posts.GetBySlug(r.ctx, r.tenant, summary.Slug)
+		if err != nil {
+			return fmt.Errorf("loading post %s: %w", summary.Slug, err)
+		}
+
+		if !p.IsPublished {
+			// Unpublished since the posts were listed.
+			delete(r.out.next.Posts, summary.Slug)
+			continue
+		}
+
+		content, err := post.RenderMarkdown(p.ContentRaw)
+		if err != nil {
+			return fmt.Errorf("rendering post %s: %w", summary.Slug, err)
+		}
+
+		page := r.page(file)
+		page.Post = p
+		page.Content = content
+
+		if err := r.render("post", file, page); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lists writes the index, tag and archive pages.
+func (r *exportRun) lists(posts []*post.Post) error {
+	if err := r.list("index", nil, posts, func(*Page) {}); err != nil {
+		return err
+	}
+
+	tags, tagged := byTag(posts)
+	for _, tag := range tags {
+		if !validSegment(tag) {
+			logging.FromContext(r.ctx).Warn("skipping tag unfit for a path", "tenant", r.tenant, "tag", tag)
+			continue
+		}
+
+		err := r.list("tag", []interface{}{"tags", tag}, tagged[tag], func(page *Page) {
+			page.Tag = tag
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	months, grouped := byMonth(posts)
+
+	page := r.page("archive/index.html")
+	page.Archive = months
+	if err := r.render("archive", "archive/index.html", page); err != nil {
+		return err
+	}
+
+	for _, month := range months {
+		key := post.ArchiveMonth{Year: month.Year, Month: month.Month}
+
+		err := r.list("archive", []interface{}{"archive", month.Year, month.Month}, grouped[key], func(page *Page) {
+			page.Year, page.Month = month.Year, month.Month
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// list writes posts page by page: the first page at dir/index.html and the
+// next ones at dir/page/<n>/index.html.
+func (r *exportRun) list(name string, dir []interface{}, posts []*post.Post, fill func(*Page)) error {
+	pages := (len(posts) + r.size - 1) / r.size
+	if pages == 0 {
+		pages = 1
+	}
+
+	at := func(n int) []interface{} {
+		segments := append([]interface{}{}, dir...)
+		if n > 1 {
+			segments = append(segments, "page", n)
+		}
+
+		return segments
+	}
+
+	for n := 1; n <= pages; n++ {
+		file := filePath(at(n))
+
+		page := r.page(file)
+		fill(&page)
+
+		page.Posts = posts[(n-1)*r.size:]
+		if len(page.Posts) > r.size {
+			page.Posts = page.Posts[:r.size]
+		}
+
+		page.Pagination.Page = n
+		if n > 1 {
+			page.Pagination.Prev = n - 1
+			page.Pagination.PrevURL = page.URL(at(n - 1)...)
+		}
+
+		if n < pages {
+			page.Pagination.Next = n + 1
+			page.Pagination.NextURL = page.URL(at(n + 1)...)
+		}
+
+		if err := r.render(name, file, page); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extras writes the 404 page, the feed and the sitemap.
+func (r *exportRun) extras(posts []*post.Post) error {
+	// 404.html is served at any path, so its links cannot be relative.
+	notFound := r.page("404.html")
+	notFound.BaseURL, notFound.StaticURL = r.base, r.base+"/static"
+	notFound.Status, notFound.Message = 404, "Not Found"
+
+	if err := r.render("error", "404.html", notFound); err != nil {
+		return err
+	}
+
+	if r.base == "" {
+		logging.FromContext(r.ctx).Warn("no base URL, leaving out the feed and the sitemap", "tenant", r.tenant)
+		return nil
+	}
+
+	absolute := Page{Tenant: r.tenant, BaseURL: r.base, FeedURL: r.base + "/feed.xml", dirs: true}
+
+	if r.feed() {
+		latest := posts
+		if len(latest) > r.FeedItems {
+			latest = latest[:r.FeedItems]
+		}
+
+		var buf bytes.Buffer
+		if err := writeFeed(&buf, absolute, latest); err != nil {
+			return err
+		}
+
+		if err := r.out.write("feed.xml", buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeSitemap(&buf, absolute, posts); err != nil {
+		return err
+	}
+
+	return r.out.write("sitemap.xml", buf.Bytes())
+}
+
+// static copies the theme's assets under static/.
+func (r *exportRun) static([]*post.Post) error {
+	seen := make(map[string]bool)
+
+	for _, src := range r.theme.static {
+		err := fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || seen[name] {
+				return err
+			}
+			seen[name] = true
+
+			// The theme resolves the asset, so overrides win.
+			f, err := r.theme.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			b, err := io.ReadAll(f)
+			if err != nil {
+				return err
+			}
+
+			return r.out.write(path.Join("static", name), b)
+		})
+
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("copying the assets of theme %s: %w", r.theme.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// filePath returns the index.html of the directory made of segments.
+func filePath(segments []interface{}) string {
+	parts := make([]string, 0, len(segments)+1)
+	for _, segment := range segments {
+		parts = append(parts, fmt.Sprint(segment))
+	}
+
+	return path.Join(append(parts, "index.html")...)
+}
+
+// validSegment tells whether s can be a single directory name.
+func validSegment(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `/\`)
+}
+
+// exportWriter writes files that changed and keeps the manifest.
+type exportWriter struct {
+	dir      string
+	full     bool
+	previous exportManifest
+	next     exportManifest
+	stats    ExportStats
+}
+
+func newExportWriter(dir string, next exportManifest, full bool) (*exportWriter, error) {
+	w := &exportWriter{dir: dir, full: full, next: next}
+
+	b, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(b, &w.previous); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", ManifestName, err)
+		}
+	}
+
+	return w, nil
+}
+
+// write writes b at name, unless the previous export wrote the same.
+func (w *exportWriter) write(name string, b []byte) error {
+	sum := sha256.Sum256(b)
+	digest := hex.EncodeToString(sum[:])
+	w.next.Files[name] = digest
+
+	target := filepath.Join(w.dir, filepath.FromSlash(name))
+
+	if !w.full && w.previous.Files[name] == digest && exists(target) {
+		w.stats.Unchanged++
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(target, b); err != nil {
+		return err
+	}
+
+	w.stats.Written++
+	return nil
+}
+
+// keep keeps name as the previous export wrote it, if it is still there.
+func (w *exportWriter) keep(name string) bool {
+	digest, ok := w.previous.Files[name]
+	if w.full || !ok || !exists(filepath.Join(w.dir, filepath.FromSlash(name))) {
+		return false
+	}
+
+	w.next.Files[name] = digest
+	w.stats.Unchanged++
+	return true
+}
+
+// finish removes the files of the previous export that this one did not
+// write and saves the manifest.
+func (w *exportWriter) finish() error {
+	stale := make([]string, 0)
+	for name := range w.previous.Files {
+		if _, ok := w.next.Files[name]; !ok && fs.ValidPath(name) && name != ManifestName {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+
+	for _, name := range stale {
+		target := filepath.Join(w.dir, filepath.FromSlash(name))
+		if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		w.stats.Removed++
+
+		// Drop the directories left empty, such as posts/<slug>/.
+		for dir := filepath.Dir(target); dir != filepath.Clean(w.dir); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(w.next, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(w.dir, ManifestName), b)
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// writeFileAtomic writes through a temporary file, so an interrupted export
+// leaves no truncated page behind.
+func writeFileAtomic(name string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), ".glog-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o644)
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
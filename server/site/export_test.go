@@ -0,0 +1,200 @@
+package site
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"glog/apperror"
+	"glog/post"
+)
+
+type fakePosts struct {
+	posts []*post.Post
+	gets  int
+}
+
+func (f *fakePosts) Published(ctx context.Context, tenantID string, q post.PublishedQuery) ([]*post.Post, error) {
+	var published []*post.Post
+	for _, p := range f.posts {
+		if p.IsPublished {
+			summary := *p
+			summary.ContentRaw = ""
+			published = append(published, &summary)
+		}
+	}
+
+	if q.From >= len(published) {
+		return nil, nil
+	}
+
+	published = published[q.From:]
+	if len(published) > q.Size {
+		published = published[:q.Size]
+	}
+
+	return published, nil
+}
+
+func (f *fakePosts) GetBySlug(ctx context.Context, tenantID string, slug string) (*post.Post, error) {
+	f.gets++
+
+	for _, p := range f.posts {
+		if p.Slug == slug {
+			copied := *p
+			return &copied, nil
+		}
+	}
+
+	return nil, apperror.NotFound("post_not_found", "post not found")
+}
+
+func readExported(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatalf("Expected %s to be exported, got %v", name, err)
+	}
+
+	return string(b)
+}
+
+func TestExportWritesTheBlog(t *testing.T) {
+	at := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	source := &fakePosts{posts: []*post.Post{
+		{Slug: "third", Title: "Third", ContentRaw: "Some *text*.", IsPublished: true, PublishedAt: at.AddDate(0, 1, 0), UpdatedAt: at, Tags: []string{"go"}},
+		{Slug: "second", Title: "Second", IsPublished: true, PublishedAt: at.AddDate(0, 0, 1), UpdatedAt: at},
+		{Slug: "first", Title: "First", IsPublished: true, PublishedAt: at, UpdatedAt: at, Tags: []string{"go"}},
+		{Slug: "draft", Title: "Draft", UpdatedAt: at},
+	}}
+
+	exporter := &Exporter{
+		Posts:     source,
+		Themes:    NewThemes("", false),
+		Theme:     "default",
+		PageSize:  2,
+		BaseURL:   "https://acme.example.com/",
+		Relative:  true,
+		FeedItems: 2,
+	}
+
+	dir := t.TempDir()
+
+	stats, err := exporter.Export(context.Background(), "acme", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Written == 0 || stats.Unchanged != 0 || stats.Removed != 0 {
+		t.Errorf("Expected a first export to write every file, got %+v", stats)
+	}
+
+	post := readExported(t, dir, "posts/third/index.html")
+	for _, expected := range []string{"<em>text</em>", `href="../../tags/go/"`, `href="../../static/style.css"`} {
+		if !strings.Contains(post, expected) {
+			t.Errorf("Expected %s in the post page, got %s", expected, post)
+		}
+	}
+
+	if index := readExported(t, dir, "index.html"); !strings.Contains(index, `href="./page/2/"`) {
+		t.Errorf("Expected a link to the second page, got %s", index)
+	}
+
+	if second := readExported(t, dir, "page/2/index.html"); !strings.Contains(second, `href="../../posts/first/"`) || !strings.Contains(second, `href="../../"`) {
+		t.Errorf("Expected the oldest post and a link back, got %s", second)
+	}
+
+	if tag := readExported(t, dir, "tags/go/index.html"); !strings.Contains(tag, "Third") || !strings.Contains(tag, "First") {
+		t.Errorf("Expected both tagged posts, got %s", tag)
+	}
+
+	if month := readExported(t, dir, "archive/2024/3/index.html"); !strings.Contains(month, "Second") || strings.Contains(month, "Third") {
+		t.Errorf("Expected the posts of March 2024, got %s", month)
+	}
+
+	feed := readExported(t, dir, "feed.xml")
+	if !strings.Contains(feed, "<id>https://acme.example.com/posts/third/</id>") || strings.Contains(feed, "First") {
+		t.Errorf("Expected the two latest posts with absolute links, got %s", feed)
+	}
+
+	if sitemap := readExported(t, dir, "sitemap.xml"); !strings.Contains(sitemap, "<loc>https://acme.example.com/archive/2024/4/</loc>") {
+		t.Errorf("Expected the months in the sitemap, got %s", sitemap)
+	}
+
+	if notFound := readExported(t, dir, "404.html"); !strings.Contains(notFound, `href="https://acme.example.com/"`) {
+		t.Errorf("Expected absolute links in the 404 page, got %s", notFound)
+	}
+
+	readExported(t, dir, "static/style.css")
+
+	if _, err := os.Stat(filepath.Join(dir, "posts", "draft")); err == nil {
+		t.Errorf("Expected drafts to be left out")
+	}
+}
+
+func TestExportIsIncremental(t *testing.T) {
+	at := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	source := &fakePosts{posts: []*post.Post{
+		{Slug: "kept", Title: "Kept", IsPublished: true, PublishedAt: at, UpdatedAt: at},
+		{Slug: "edited", Title: "Before", IsPublished: true, PublishedAt: at, UpdatedAt: at},
+		{Slug: "withdrawn", Title: "Withdrawn", IsPublished: true, PublishedAt: at, UpdatedAt: at},
+	}}
+
+	exporter := &Exporter{Posts: source, Themes: NewThemes("", false), Theme: "default"}
+	dir := t.TempDir()
+
+	if _, err := exporter.Export(context.Background(), "acme", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	source.gets = 0
+
+	stats, err := exporter.Export(context.Background(), "acme", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Written != 0 || stats.Removed != 0 || source.gets != 0 {
+		t.Errorf("Expected nothing to change, got %+v after %d loads", stats, source.gets)
+	}
+
+	source.posts[1].Title, source.posts[1].UpdatedAt = "After", at.Add(time.Hour)
+	source.posts[2].IsPublished = false
+
+	stats, err = exporter.Export(context.Background(), "acme", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if source.gets != 1 {
+		t.Errorf("Expected only the edited post to be loaded, got %d loads", source.gets)
+	}
+
+	// The edited post, the index and the archive pages changed.
+	if stats.Written != 4 || stats.Removed != 1 {
+		t.Errorf("Expected 4 files written and 1 removed, got %+v", stats)
+	}
+
+	if page := readExported(t, dir, "posts/edited/index.html"); !strings.Contains(page, "After") {
+		t.Errorf("Expected the edited post, got %s", page)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "posts", "withdrawn")); err == nil {
+		t.Errorf("Expected the withdrawn post and its directory to be removed")
+	}
+
+	exporter.Full = true
+
+	stats, err = exporter.Export(context.Background(), "acme", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Unchanged != 0 {
+		t.Errorf("Expected a full export to rewrite everything, got %+v", stats)
+	}
+}
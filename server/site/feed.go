@@ -0,0 +1,202 @@
+package site
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"sort"
+	"time"
+
+	"glog/post"
+)
+
+// Posts is where pages get their posts from; *post.Repository is one.
+type Posts interface {
+	Published(ctx context.Context, tenantID string, q post.PublishedQuery) ([]*post.Post, error)
+	GetBySlug(ctx context.Context, tenantID string, slug string) (*post.Post, error)
+}
+
+// allPublished pages through every published post of a tenant, newest
+// first.
+func allPublished(ctx context.Context, posts Posts, tenantID string) ([]*post.Post, error) {
+	const batch = 100
+
+	var all []*post.Post
+
+	for from := 0; ; from += batch {
+		page, err := posts.Published(ctx, tenantID, post.PublishedQuery{From: from, Size: batch})
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, page...)
+
+		if len(page) < batch {
+			return all, nil
+		}
+	}
+}
+
+// byTag groups posts by tag, keeping their order, and returns the tags
+// sorted.
+func byTag(posts []*post.Post) ([]string, map[string][]*post.Post) {
+	tagged := make(map[string][]*post.Post)
+	for _, p := range posts {
+		for _, tag := range p.Tags {
+			tagged[tag] = append(tagged[tag], p)
+		}
+	}
+
+	tags := make([]string, 0, len(tagged))
+	for tag := range tagged {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	return tags, tagged
+}
+
+// byMonth groups posts, newest first, by the UTC month they were published
+// in, as Repository.Archive does.
+func byMonth(posts []*post.Post) ([]post.ArchiveMonth, map[post.ArchiveMonth][]*post.Post) {
+	var months []post.ArchiveMonth
+	grouped := make(map[post.ArchiveMonth][]*post.Post)
+
+	for _, p := range posts {
+		at := p.PublishedAt.UTC()
+		key := post.ArchiveMonth{Year: at.Year(), Month: int(at.Month())}
+
+		if _, ok := grouped[key]; !ok {
+			months = append(months, key)
+		}
+
+		grouped[key] = append(grouped[key], p)
+	}
+
+	for i, month := range months {
+		months[i].Posts = len(grouped[month])
+	}
+
+	return months, grouped
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Link       atomLink       `xml:"link"`
+	Summary    string         `xml:"summary,omitempty"`
+	Categories []atomCategory `xml:"category"`
+}
+
+// writeFeed writes an Atom feed of posts. page.BaseURL must be absolute,
+// as feed readers resolve nothing.
+func writeFeed(w io.Writer, page Page, posts []*post.Post) error {
+	feed := atomFeed{
+		Title:   page.Tenant,
+		ID:      page.URL(),
+		Author:  atomAuthor{Name: page.Tenant},
+		Links:   []atomLink{{Href: page.URL()}, {Href: page.FeedURL, Rel: "self"}},
+		Entries: make([]atomEntry, 0, len(posts)),
+	}
+
+	var updated time.Time
+
+	for _, p := range posts {
+		if p.UpdatedAt.After(updated) {
+			updated = p.UpdatedAt
+		}
+
+		link := page.URL("posts", p.Slug)
+		entry := atomEntry{
+			Title:     p.Title,
+			ID:        link,
+			Updated:   atomDate(p.UpdatedAt),
+			Published: atomDate(p.PublishedAt),
+			Link:      atomLink{Href: link},
+			Summary:   p.Abstract,
+		}
+
+		for _, tag := range p.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	feed.Updated = atomDate(updated)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(feed)
+}
+
+func atomDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// writeSitemap writes the sitemap of a blog: the index, the archive, every
+// tag and month, and every post. page.BaseURL must be absolute.
+func writeSitemap(w io.Writer, page Page, posts []*post.Post) error {
+	set := sitemapURLSet{URLs: []sitemapURL{{Loc: page.URL()}, {Loc: page.URL("archive")}}}
+
+	months, _ := byMonth(posts)
+	for _, month := range months {
+		set.URLs = append(set.URLs, sitemapURL{Loc: page.URL("archive", month.Year, month.Month)})
+	}
+
+	tags, _ := byTag(posts)
+	for _, tag := range tags {
+		set.URLs = append(set.URLs, sitemapURL{Loc: page.URL("tags", tag)})
+	}
+
+	for _, p := range posts {
+		set.URLs = append(set.URLs, sitemapURL{Loc: page.URL("posts", p.Slug), LastMod: atomDate(p.UpdatedAt)})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(set)
+}
@@ -0,0 +1,345 @@
+package site
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"glog/apperror"
+	"glog/config"
+	"glog/httpcache"
+	"glog/logging"
+	"glog/post"
+	"glog/responsehandler"
+
+	"github.com/gorilla/mux"
+)
+
+const DefaultPageSize = 10
+
+// Site renders the public pages of every tenant's blog with the tenant's
+// theme. Only published posts are ever shown.
+type Site struct {
+	Repository *post.Repository
+	Themes     *Themes
+	// Theme returns the name of the theme of a tenant.
+	Theme     func(tenantID string) string
+	HTTPCache config.HTTPCacheConfig
+	PageSize  int
+}
+
+// Page is the data templates are executed with.
+type Page struct {
+	Tenant string
+	// BaseURL is the path of the tenant's blog, without a trailing slash.
+	BaseURL   string
+	StaticURL string
+	// FeedURL is the Atom feed of the blog, if the export has one.
+	FeedURL string
+	// dirs makes URL link to directories, as static exports lay pages out.
+	dirs bool
+
+	Posts   []*post.Post
+	Post    *post.Post
+	Content template.HTML
+
+	Tag     string
+	Year    int
+	Month   int
+	Archive []post.ArchiveMonth
+
+	Pagination Pagination
+
+	Status  int
+	Message string
+}
+
+// With returns a copy of the page about p, for partials rendering one post
+// of a list.
+func (pg Page) With(p *post.Post) Page {
+	pg.Post = p
+	return pg
+}
+
+// URL returns the link to a page of the blog from its path segments, as in
+// {{.URL "tags" .Tag}}. Themes should build links with it, so that they
+// also work in static exports.
+func (pg Page) URL(segments ...interface{}) string {
+	u := pg.BaseURL
+	for _, segment := range segments {
+		u += "/" + url.PathEscape(fmt.Sprint(segment))
+	}
+
+	if len(segments) == 0 || pg.dirs {
+		u += "/"
+	}
+
+	return u
+}
+
+// Pagination holds the neighbouring pages; 0 and "" mean there is none.
+type Pagination struct {
+	Page    int
+	Prev    int
+	Next    int
+	PrevURL string
+	NextURL string
+}
+
+// Index renders the latest published posts, page by page.
+func (s *Site) Index(w http.ResponseWriter, r *http.Request) {
+	page, theme, ok := s.begin(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.list(w, r, theme, &page, post.PublishedQuery{}) {
+		return
+	}
+
+	s.render(w, r, theme, "index", page)
+}
+
+// Post renders a published post. Drafts are not found.
+func (s *Site) Post(w http.ResponseWriter, r *http.Request) {
+	page, theme, ok := s.begin(w, r)
+	if !ok {
+		return
+	}
+
+	p, err := s.Repository.GetBySlug(r.Context(), page.Tenant, mux.Vars(r)["slug"])
+	if err == nil && !p.IsPublished {
+		err = apperror.NotFound("post_not_found", "post not found")
+	}
+
+	if err != nil {
+		s.renderError(w, r, theme, page, err)
+		return
+	}
+
+	content, err := post.RenderMarkdown(p.ContentRaw)
+	if err != nil {
+		s.renderError(w, r, theme, page, apperror.Internal(err))
+		return
+	}
+
+	page.Post = p
+	page.Content = content
+
+	s.render(w, r, theme, "post", page, httpcache.PostKey(page.Tenant, p.Slug))
+}
+
+// Tag renders the published posts with a tag, page by page.
+func (s *Site) Tag(w http.ResponseWriter, r *http.Request) {
+	page, theme, ok := s.begin(w, r)
+	if !ok {
+		return
+	}
+
+	page.Tag = mux.Vars(r)["tag"]
+
+	if !s.list(w, r, theme, &page, post.PublishedQuery{Tag: page.Tag}) {
+		return
+	}
+
+	s.render(w, r, theme, "tag", page)
+}
+
+// Archive renders the months with published posts or, given a year and
+// a month, the posts published that month.
+func (s *Site) Archive(w http.ResponseWriter, r *http.Request) {
+	page, theme, ok := s.begin(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+
+	if vars["year"] == "" {
+		months, err := s.Repository.Archive(r.Context(), page.Tenant)
+		if err != nil {
+			s.renderError(w, r, theme, page, err)
+			return
+		}
+
+		page.Archive = months
+		s.render(w, r, theme, "archive", page)
+		return
+	}
+
+	year, yearErr := strconv.Atoi(vars["year"])
+	month, monthErr := strconv.Atoi(vars["month"])
+
+	if yearErr != nil || monthErr != nil || month < 1 || month > 12 {
+		s.renderError(w, r, theme, page, apperror.NotFound("month_not_found", "no such month"))
+		return
+	}
+
+	page.Year, page.Month = year, month
+	since := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+
+	if !s.list(w, r, theme, &page, post.PublishedQuery{Since: since, Until: since.AddDate(0, 1, 0)}) {
+		return
+	}
+
+	s.render(w, r, theme, "archive", page)
+}
+
+// Static serves the static assets of a theme.
+func (s *Site) Static(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	theme, err := s.Themes.Get(vars["theme"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := path.Clean(vars["path"])
+	if !fs.ValidPath(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := theme.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// ServeContent answers conditional requests against the ETag.
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("ETag", httpcache.ETag(string(b)))
+
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(b))
+}
+
+// begin resolves the tenant and its theme. It answers the request itself
+// when the theme cannot be loaded.
+func (s *Site) begin(w http.ResponseWriter, r *http.Request) (Page, *Theme, bool) {
+	tenant := mux.Vars(r)["tenantID"]
+	name := s.Theme(tenant)
+
+	page := Page{
+		Tenant:    tenant,
+		BaseURL:   "/blog/" + url.PathEscape(tenant),
+		StaticURL: "/themes/" + url.PathEscape(name) + "/static",
+	}
+
+	theme, err := s.Themes.Get(name)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("could not load theme", "theme", name, "tenant", tenant, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return page, nil, false
+	}
+
+	return page, theme, true
+}
+
+// list fills page with the posts of the requested page of q.
+func (s *Site) list(w http.ResponseWriter, r *http.Request, theme *Theme, page *Page, q post.PublishedQuery) bool {
+	number := 1
+	if raw := r.URL.Query().Get("page"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			s.renderError(w, r, theme, *page, apperror.NotFound("page_not_found", "no such page"))
+			return false
+		}
+
+		number = n
+	}
+
+	size := s.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+
+	// One more post than shown tells whether there is a next page.
+	q.From, q.Size = (number-1)*size, size+1
+
+	posts, err := s.Repository.Published(r.Context(), page.Tenant, q)
+	if err != nil {
+		s.renderError(w, r, theme, *page, err)
+		return false
+	}
+
+	if number > 1 && len(posts) == 0 {
+		s.renderError(w, r, theme, *page, apperror.NotFound("page_not_found", "no such page"))
+		return false
+	}
+
+	page.Pagination.Page = number
+	if number > 1 {
+		page.Pagination.Prev = number - 1
+		page.Pagination.PrevURL = "?page=" + strconv.Itoa(number-1)
+	}
+
+	if len(posts) > size {
+		posts = posts[:size]
+		page.Pagination.Next = number + 1
+		page.Pagination.NextURL = "?page=" + strconv.Itoa(number+1)
+	}
+
+	page.Posts = posts
+	return true
+}
+
+// render executes a page into a buffer, so a failing template does not send
+// half a page, and serves it with the caching headers of published content.
+func (s *Site) render(w http.ResponseWriter, r *http.Request, theme *Theme, name string, page Page, keys ...string) {
+	var buf bytes.Buffer
+	if err := theme.Execute(&buf, name, page); err != nil {
+		logging.FromContext(r.Context()).Error("could not render page", "theme", theme.Name, "page", name, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	httpcache.Policy{
+		CacheControl:       s.HTTPCache.Published,
+		SurrogateKeyHeader: s.HTTPCache.SurrogateKeyHeader,
+	}.Apply(w, append([]string{httpcache.TenantKey(page.Tenant)}, keys...)...)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if httpcache.NotModified(w, r, httpcache.Validators{ETag: httpcache.ETag(buf.String())}) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+func (s *Site) renderError(w http.ResponseWriter, r *http.Request, theme *Theme, page Page, err error) {
+	page.Status = responsehandler.StatusFor(err)
+	page.Message = http.StatusText(page.Status)
+
+	if page.Status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error("could not serve page", "tenant", page.Tenant, "error", err)
+	}
+
+	var buf bytes.Buffer
+	if err := theme.Execute(&buf, "error", page); err != nil {
+		logging.FromContext(r.Context()).Error("could not render error page", "theme", theme.Name, "error", err)
+		http.Error(w, page.Message, page.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(page.Status)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,263 @@
+package site
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed themes
+var builtin embed.FS
+
+// Pages every theme must provide, directly or through the theme it extends.
+var pageNames = []string{"index", "post", "tag", "archive", "error"}
+
+// ErrUnknownTheme is returned for a theme found neither in the themes
+// directory nor among the built-in ones.
+var ErrUnknownTheme = errors.New("site: unknown theme")
+
+// Theme is a set of templates and static assets. Its files live in
+//
+//	theme.yaml      optional; "extends: <theme>" inherits another theme
+//	templates/      layout.html, partials/*.html and one file per page
+//	static/         served under /themes/<name>/static/
+//
+// layout.html defines the "layout" template, which pages fill by defining
+// the blocks it declares, such as "title" and "content". Files of a theme
+// replace the files of the same path in the theme it extends, so a theme
+// can change a single partial.
+type Theme struct {
+	Name   string
+	pages  map[string]*template.Template
+	static []fs.FS
+	// digest changes whenever a template of the theme does.
+	digest string
+}
+
+// Execute renders the page named name, such as "post", with data.
+func (t *Theme) Execute(w io.Writer, name string, data interface{}) error {
+	page, ok := t.pages[name]
+	if !ok {
+		return fmt.Errorf("theme %s has no %s page", t.Name, name)
+	}
+
+	return page.ExecuteTemplate(w, "layout", data)
+}
+
+// Open opens a static asset, looking through the themes it extends.
+func (t *Theme) Open(name string) (fs.File, error) {
+	for _, static := range t.static {
+		f, err := static.Open(name)
+		if err == nil {
+			return f, nil
+		}
+	}
+
+	return nil, fs.ErrNotExist
+}
+
+// Themes loads themes from a directory, falling back to the built-in ones.
+// With reload, every Get reads the files again, so edits show up without a
+// restart while a theme is being developed.
+type Themes struct {
+	dir    string
+	reload bool
+
+	mu     sync.Mutex
+	loaded map[string]*Theme
+}
+
+func NewThemes(dir string, reload bool) *Themes {
+	return &Themes{dir: dir, reload: reload, loaded: make(map[string]*Theme)}
+}
+
+// Get returns the theme named name.
+func (t *Themes) Get(name string) (*Theme, error) {
+	if t.reload {
+		return t.load(name)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if theme, ok := t.loaded[name]; ok {
+		return theme, nil
+	}
+
+	theme, err := t.load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	t.loaded[name] = theme
+	return theme, nil
+}
+
+// source returns the files of a theme, from the themes directory if it has
+// it.
+func (t *Themes) source(name string) (fs.FS, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTheme, name)
+	}
+
+	if t.dir != "" {
+		dir := filepath.Join(t.dir, name)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return os.DirFS(dir), nil
+		}
+	}
+
+	if _, err := fs.Stat(builtin, "themes/"+name); err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTheme, name)
+	}
+
+	return fs.Sub(builtin, "themes/"+name)
+}
+
+type manifest struct {
+	Extends string `yaml:"extends"`
+}
+
+func (t *Themes) load(name string) (*Theme, error) {
+	// chain lists the theme and the ones it extends, most derived first.
+	var chain []fs.FS
+	seen := make(map[string]bool)
+
+	for current := name; current != ""; {
+		if seen[current] {
+			return nil, fmt.Errorf("theme %s: %s is extended twice", name, current)
+		}
+		seen[current] = true
+
+		src, err := t.source(current)
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append(chain, src)
+
+		var m manifest
+		b, err := fs.ReadFile(src, "theme.yaml")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("theme %s: %w", current, err)
+		}
+
+		if err := yaml.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("theme %s: theme.yaml: %w", current, err)
+		}
+
+		current = m.Extends
+	}
+
+	files := make(map[string]string)
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		err := fs.WalkDir(chain[i], "templates", func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || path.Ext(p) != ".html" {
+				return err
+			}
+
+			b, err := fs.ReadFile(chain[i], p)
+			files[strings.TrimPrefix(p, "templates/")] = string(b)
+			return err
+		})
+
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("theme %s: %w", name, err)
+		}
+	}
+
+	theme, err := parse(name, files)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, src := range chain {
+		static, err := fs.Sub(src, "static")
+		if err != nil {
+			return nil, err
+		}
+
+		theme.static = append(theme.static, static)
+	}
+
+	return theme, nil
+}
+
+// parse builds one template set per page: the layout and partials, then the
+// page, whose definitions replace the layout's blocks.
+func parse(name string, files map[string]string) (*Theme, error) {
+	shared := template.New(name).Funcs(funcs)
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		if p == "layout.html" || strings.HasPrefix(p, "partials/") {
+			if _, err := shared.New(p).Parse(files[p]); err != nil {
+				return nil, fmt.Errorf("theme %s: %w", name, err)
+			}
+		}
+	}
+
+	if shared.Lookup("layout") == nil {
+		return nil, fmt.Errorf("theme %s: layout.html must define the layout template", name)
+	}
+
+	theme := &Theme{Name: name, pages: make(map[string]*template.Template)}
+
+	h := sha256.New()
+	for _, p := range paths {
+		fmt.Fprintf(h, "%s\x00%s\x00", p, files[p])
+	}
+	theme.digest = hex.EncodeToString(h.Sum(nil))
+
+	for _, page := range pageNames {
+		src, ok := files[page+".html"]
+		if !ok {
+			return nil, fmt.Errorf("theme %s: missing templates/%s.html", name, page)
+		}
+
+		tpl, err := shared.Clone()
+		if err == nil {
+			_, err = tpl.New(page + ".html").Parse(src)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("theme %s: %w", name, err)
+		}
+
+		theme.pages[page] = tpl
+	}
+
+	return theme, nil
+}
+
+var funcs = template.FuncMap{
+	"date": func(t time.Time) string {
+		return t.Format("January 2, 2006")
+	},
+	"isoDate": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+	"monthName": func(month int) string {
+		return time.Month(month).String()
+	},
+}
@@ -0,0 +1,191 @@
+package site
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"glog/post"
+
+	"github.com/gorilla/mux"
+)
+
+func writeTheme(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, contents := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDefaultThemeRendersPages(t *testing.T) {
+	theme, err := NewThemes("", false).Get("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &post.Post{
+		Slug:        "fish-chips",
+		Title:       "Fish & Chips",
+		PublishedAt: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		Tags:        []string{"food"},
+	}
+
+	page := Page{Tenant: "acme", BaseURL: "/blog/acme", Posts: []*post.Post{p}, Pagination: Pagination{Page: 1, Next: 2, NextURL: "?page=2"}}
+
+	var buf bytes.Buffer
+	if err := theme.Execute(&buf, "index", page); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`href="/blog/acme/posts/fish-chips"`,
+		"Fish &amp; Chips",
+		"March 5, 2024",
+		`href="/blog/acme/tags/food"`,
+		`href="?page=2"`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected %s in the index, got %s", expected, buf.String())
+		}
+	}
+}
+
+func TestThemesExtendOtherThemes(t *testing.T) {
+	dir := t.TempDir()
+	writeTheme(t, filepath.Join(dir, "plain"), map[string]string{
+		"theme.yaml":                     "extends: default\n",
+		"templates/partials/footer.html": `<footer>plain footer</footer>`,
+		"static/extra.css":               "body{}",
+	})
+
+	theme, err := NewThemes(dir, false).Get("plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := theme.Execute(&buf, "error", Page{Status: 404, Message: "Not Found"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "plain footer") {
+		t.Errorf("Expected the overridden footer, got %s", buf.String())
+	}
+
+	if !strings.Contains(buf.String(), `class="site-header"`) {
+		t.Errorf("Expected the inherited header, got %s", buf.String())
+	}
+
+	for _, name := range []string{"extra.css", "style.css"} {
+		f, err := theme.Open(name)
+		if err != nil {
+			t.Errorf("Expected %s to be served, got %v", name, err)
+			continue
+		}
+		f.Close()
+	}
+}
+
+func TestThemesReportBrokenThemes(t *testing.T) {
+	dir := t.TempDir()
+	writeTheme(t, filepath.Join(dir, "a"), map[string]string{"theme.yaml": "extends: b\n"})
+	writeTheme(t, filepath.Join(dir, "b"), map[string]string{"theme.yaml": "extends: a\n"})
+	writeTheme(t, filepath.Join(dir, "bare"), map[string]string{"templates/layout.html": `{{define "layout"}}{{end}}`})
+
+	themes := NewThemes(dir, false)
+
+	if _, err := themes.Get("a"); err == nil || !strings.Contains(err.Error(), "extended twice") {
+		t.Errorf("Expected a cycle to be reported, got %v", err)
+	}
+
+	if _, err := themes.Get("bare"); err == nil || !strings.Contains(err.Error(), "templates/index.html") {
+		t.Errorf("Expected a missing page to be reported, got %v", err)
+	}
+
+	if _, err := themes.Get("../default"); !errors.Is(err, ErrUnknownTheme) {
+		t.Errorf("Expected ErrUnknownTheme, got %v", err)
+	}
+}
+
+func TestThemesReload(t *testing.T) {
+	dir := t.TempDir()
+	footer := filepath.Join(dir, "plain", "templates", "partials", "footer.html")
+	writeTheme(t, filepath.Join(dir, "plain"), map[string]string{
+		"theme.yaml":                     "extends: default\n",
+		"templates/partials/footer.html": "<footer>before</footer>",
+	})
+
+	cached, reloading := NewThemes(dir, false), NewThemes(dir, true)
+
+	render := func(themes *Themes) string {
+		theme, err := themes.Get("plain")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := theme.Execute(&buf, "error", Page{}); err != nil {
+			t.Fatal(err)
+		}
+
+		return buf.String()
+	}
+
+	render(cached)
+
+	if err := os.WriteFile(footer, []byte("<footer>after</footer>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if page := render(cached); !strings.Contains(page, "before") {
+		t.Errorf("Expected the cached theme, got %s", page)
+	}
+
+	if page := render(reloading); !strings.Contains(page, "after") {
+		t.Errorf("Expected the edited theme, got %s", page)
+	}
+}
+
+func TestStaticServesThemeAssets(t *testing.T) {
+	s := &Site{Themes: NewThemes("", false)}
+
+	serve := func(theme, name string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/themes/"+theme+"/static/"+name, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+
+		w := httptest.NewRecorder()
+		s.Static(w, mux.SetURLVars(r, map[string]string{"theme": theme, "path": name}))
+		return w
+	}
+
+	w := serve("default", "style.css", nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") {
+		t.Fatalf("Expected the stylesheet, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	if w := serve("default", "style.css", http.Header{"If-None-Match": {w.Header().Get("ETag")}}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching ETag, got %d", w.Code)
+	}
+
+	for _, c := range [][2]string{{"default", "missing.css"}, {"default", "../templates/layout.html"}, {"nope", "style.css"}} {
+		if w := serve(c[0], c[1], nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s/%s, got %d", c[0], c[1], w.Code)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writePair(t *testing.T, dir string, commonName string, modTime time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, r *Reloader) string {
+	cert, _ := r.GetCertificate(nil)
+
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed.Subject.CommonName
+}
+
+func TestReloaderPicksUpChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writePair(t, dir, "first", time.Now().Add(-time.Minute))
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Expected the pair to load, got %v", err)
+	}
+
+	if reloaded, _ := r.reload(); reloaded {
+		t.Errorf("Expected unchanged files not to be reloaded")
+	}
+
+	writePair(t, dir, "second", time.Now())
+
+	if reloaded, err := r.reload(); !reloaded || err != nil {
+		t.Fatalf("Expected changed files to be reloaded, got %v", err)
+	}
+
+	if name := commonName(t, r); name != "second" {
+		t.Errorf("Expected the new certificate, got %s", name)
+	}
+}
+
+func TestReloaderKeepsCertificateOnBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writePair(t, dir, "good", time.Now().Add(-time.Minute))
+
+	r, _ := NewReloader(certFile, keyFile)
+	os.WriteFile(certFile, []byte("garbage"), 0o600)
+
+	if _, err := r.reload(); err == nil {
+		t.Errorf("Expected an error for a broken certificate")
+	}
+
+	if name := commonName(t, r); name != "good" {
+		t.Errorf("Expected the previous certificate to be kept, got %s", name)
+	}
+}
+
+func TestServerConfigEnablesHTTP2(t *testing.T) {
+	dir := t.TempDir()
+	r, _ := NewReloader(writePair(t, dir, "h2", time.Now()))
+
+	cfg, err := ServerConfig(r, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.NextProtos[0] != "h2" || cfg.ClientAuth != tls.NoClientCert {
+		t.Errorf("Unexpected config %v %v", cfg.NextProtos, cfg.ClientAuth)
+	}
+}
+
+func TestRequireClientCert(t *testing.T) {
+	h := RequireClientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a client certificate, got %d", w.Code)
+	}
+
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{}}}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with a verified client certificate, got %d", w.Code)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	cases := map[string]string{
+		"443":  "https://blog.example.com/tenant/1/posts?from=10",
+		"8443": "https://blog.example.com:8443/tenant/1/posts?from=10",
+	}
+
+	for port, expected := range cases {
+		r := httptest.NewRequest(http.MethodGet, "http://blog.example.com:8080/tenant/1/posts?from=10", nil)
+		w := httptest.NewRecorder()
+		RedirectHandler(port).ServeHTTP(w, r)
+
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != expected {
+			t.Errorf("Expected redirect to %s, got %d %s", expected, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ServiceName         = "glog"
+	instrumentationName = "glog"
+)
+
+// Attribute keys shared by HTTP and repository spans.
+const (
+	TenantKey = attribute.Key("glog.tenant")
+	SlugKey   = attribute.Key("glog.slug")
+)
+
+type Options struct {
+	// Endpoint is the host:port of the OTLP/HTTP collector. Tracing is
+	// disabled when it is empty.
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the fraction of new traces that are recorded. Traces
+	// started upstream keep the caller's sampling decision.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	clientOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := NewProvider(sdktrace.NewBatchSpanProcessor(exporter), opts.SampleRatio)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// NewProvider builds a tracer provider around processor. Tests pass a
+// simple span processor over an in-memory exporter.
+func NewProvider(processor sdktrace.SpanProcessor, sampleRatio float64) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(sdkresource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(ServiceName),
+		)),
+	)
+}
+
+// Tracer returns the tracer used for glog's own spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// RouteAttributes adds the tenant and slug of the matched route to the
+// current server span. It must run as a mux middleware after otelmux.
+func RouteAttributes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		vars := mux.Vars(r)
+
+		if tenant, ok := vars["tenantID"]; ok {
+			span.SetAttributes(TenantKey.String(tenant))
+		}
+
+		if slug, ok := vars["slug"]; ok {
+			span.SetAttributes(SlugKey.String(slug))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestServerSpansContinueInboundTraces(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := NewProvider(sdktrace.NewSimpleSpanProcessor(exporter), 1)
+
+	router := mux.NewRouter()
+	router.Use(
+		otelmux.Middleware(ServiceName,
+			otelmux.WithTracerProvider(tp),
+			otelmux.WithPropagators(propagation.TraceContext{}),
+		),
+		RouteAttributes,
+	)
+	router.HandleFunc("/tenant/{tenantID}/posts/{slug}", func(w http.ResponseWriter, r *http.Request) {})
+
+	r := httptest.NewRequest(http.MethodGet, "/tenant/t1/posts/hello", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected one span, got %d", len(spans))
+	}
+
+	span := spans[0]
+
+	if span.Name != "/tenant/{tenantID}/posts/{slug}" {
+		t.Errorf("Expected span to be named after the route template, got %s", span.Name)
+	}
+
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the inbound trace to be continued, got %s", span.SpanContext.TraceID())
+	}
+
+	attrs := make(map[string]string)
+	for _, kv := range span.Attributes {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+
+	if attrs[string(TenantKey)] != "t1" || attrs[string(SlugKey)] != "hello" {
+		t.Errorf("Expected tenant and slug attributes, got %v", attrs)
+	}
+}
+
+func TestSamplerHonorsRatio(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := NewProvider(sdktrace.NewSimpleSpanProcessor(exporter), 0)
+
+	_, span := tp.Tracer(instrumentationName).Start(context.Background(), "dropped")
+	span.End()
+
+	if len(exporter.GetSpans()) != 0 {
+		t.Errorf("Expected no spans with a sample ratio of 0")
+	}
+}
@@ -0,0 +1,272 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Machine-readable codes reported for each failing field.
+const (
+	CodeRequired          = "required"
+	CodeTooShort          = "too_short"
+	CodeTooLong           = "too_long"
+	CodeInvalidCharacters = "invalid_characters"
+	CodeInvalidType       = "invalid_type"
+	CodeUnknownField      = "unknown_field"
+)
+
+// FieldError model info
+// @Description A single failing field of a request
+type FieldError struct {
+	Field   string `json:"Field"`
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+}
+
+// Errors is the list of every field that failed validation. It implements
+// error so it can travel through the usual error return values.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+	}
+
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Validatable is implemented by request DTOs that can check their own fields.
+type Validatable interface {
+	Validate() error
+}
+
+// Validator accumulates field errors so every failing field is reported at
+// once instead of stopping at the first one.
+type Validator struct {
+	errors Errors
+}
+
+func New() *Validator {
+	return &Validator{}
+}
+
+func (v *Validator) Add(field string, code string, message string) {
+	v.errors = append(v.errors, FieldError{
+		Field:   field,
+		Code:    code,
+		Message: message,
+	})
+}
+
+// Required fails if value is empty or only whitespace.
+func (v *Validator) Required(field string, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Add(field, CodeRequired, "is required")
+		return false
+	}
+
+	return true
+}
+
+// Length fails if value has fewer than min or more than max characters.
+// A max of 0 means there is no upper bound.
+func (v *Validator) Length(field string, value string, min int, max int) bool {
+	n := utf8.RuneCountInString(value)
+
+	if n < min {
+		v.Add(field, CodeTooShort, fmt.Sprintf("must be at least %d characters long", min))
+		return false
+	}
+
+	if max > 0 && n > max {
+		v.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters long", max))
+		return false
+	}
+
+	return true
+}
+
+// Charset fails if any character of value is rejected by allowed.
+func (v *Validator) Charset(field string, value string, allowed func(rune) bool) bool {
+	for _, r := range value {
+		if !allowed(r) {
+			v.Add(field, CodeInvalidCharacters, fmt.Sprintf("contains invalid character %q", r))
+			return false
+		}
+	}
+
+	return true
+}
+
+// Err returns the accumulated errors, or nil if every check passed.
+func (v *Validator) Err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+
+	return v.errors
+}
+
+// SingleLine accepts printable characters without line breaks.
+func SingleLine(r rune) bool {
+	return unicode.IsPrint(r)
+}
+
+// MultiLine accepts printable characters, line breaks and tabs.
+func MultiLine(r rune) bool {
+	return unicode.IsPrint(r) || r == '\n' || r == '\r' || r == '\t'
+}
+
+// Decode unmarshals data into dst, rejecting fields that dst does not
+// declare, and then runs dst's own validation. Malformed JSON is returned as
+// a *SyntaxError; everything else is reported as Errors.
+func Decode(data []byte, dst Validatable) error {
+	return DecodeReader(bytes.NewReader(data), dst)
+}
+
+// SyntaxError reports a body that is not a single JSON object.
+type SyntaxError struct {
+	Msg string
+	Err error
+}
+
+func (e *SyntaxError) Error() string {
+	return "malformed JSON: " + e.Msg
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeReader is Decode for a stream, such as a request body. It reads a
+// single JSON object and rejects anything but whitespace after it. Errors
+// returned by r are passed through, wrapped, so callers can tell them apart
+// from malformed JSON.
+func DecodeReader(r io.Reader, dst Validatable) error {
+	dec := json.NewDecoder(r)
+
+	var raw map[string]json.RawMessage
+
+	if err := dec.Decode(&raw); err != nil {
+		return syntaxError(dec, err)
+	}
+
+	if raw == nil {
+		return &SyntaxError{Msg: "expected an object, got null"}
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			return &SyntaxError{Msg: fmt.Sprintf("unexpected data after the object at offset %d", dec.InputOffset())}
+		}
+
+		return syntaxError(dec, err)
+	}
+
+	var errs Errors
+
+	known := jsonFields(dst)
+	for key := range raw {
+		if !known[key] {
+			errs = append(errs, FieldError{Field: key, Code: CodeUnknownField, Message: "is not a known field"})
+		}
+	}
+
+	for key, value := range raw {
+		if !known[key] {
+			continue
+		}
+
+		field := map[string]json.RawMessage{key: value}
+		b, _ := json.Marshal(field)
+
+		if err := json.NewDecoder(bytes.NewReader(b)).Decode(dst); err != nil {
+			errs = append(errs, FieldError{Field: key, Code: CodeInvalidType, Message: "has an invalid type"})
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+
+	if err := dst.Validate(); err != nil {
+		fieldErrs, ok := err.(Errors)
+		if !ok {
+			return err
+		}
+
+		failed := make(map[string]bool)
+		for _, fe := range errs {
+			failed[fe.Field] = true
+		}
+
+		for _, fe := range fieldErrs {
+			if !failed[fe.Field] {
+				errs = append(errs, fe)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// syntaxError explains why dec could not decode an object. Errors of the
+// underlying reader are returned as they are.
+func syntaxError(dec *json.Decoder, err error) error {
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+
+	switch {
+	case err == io.EOF:
+		return &SyntaxError{Msg: "the body is empty", Err: err}
+	case err == io.ErrUnexpectedEOF:
+		return &SyntaxError{Msg: "the body ends in the middle of a value", Err: err}
+	case errors.As(err, &syntax):
+		return &SyntaxError{Msg: fmt.Sprintf("%s at offset %d", syntax.Error(), syntax.Offset), Err: err}
+	case errors.As(err, &typ):
+		return &SyntaxError{Msg: "expected an object, got " + typ.Value, Err: err}
+	default:
+		return err
+	}
+}
+
+// jsonFields returns the JSON names of the exported fields of v's struct.
+func jsonFields(v interface{}) map[string]bool {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fields := make(map[string]bool)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields[name] = true
+	}
+
+	return fields
+}
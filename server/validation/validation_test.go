@@ -0,0 +1,117 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+type request struct {
+	Name string `json:"Name"`
+	Bio  string `json:"Bio"`
+}
+
+func (r request) Validate() error {
+	v := New()
+
+	if v.Required("Name", r.Name) {
+		v.Length("Name", r.Name, 1, 5)
+	}
+
+	v.Charset("Bio", r.Bio, SingleLine)
+
+	return v.Err()
+}
+
+func TestDecodeReportsEveryFailingField(t *testing.T) {
+	var r request
+
+	err := Decode([]byte(`{"Name": "too long name", "Bio": "a\nb", "Extra": 1}`), &r)
+
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+
+	expected := []FieldError{
+		{Field: "Extra", Code: CodeUnknownField},
+		{Field: "Name", Code: CodeTooLong},
+		{Field: "Bio", Code: CodeInvalidCharacters},
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), errs)
+	}
+
+	for i, e := range expected {
+		if errs[i].Field != e.Field || errs[i].Code != e.Code {
+			t.Errorf("Expected %s/%s, got %s/%s", e.Field, e.Code, errs[i].Field, errs[i].Code)
+		}
+	}
+}
+
+func TestDecodeRequiresFieldsOnEmptyPayload(t *testing.T) {
+	var r request
+
+	errs, ok := Decode([]byte(`{}`), &r).(Errors)
+
+	if !ok || len(errs) != 1 || errs[0].Code != CodeRequired {
+		t.Errorf("Expected a single required error, got %v", errs)
+	}
+}
+
+func TestDecodeReportsInvalidTypes(t *testing.T) {
+	var r request
+
+	errs, ok := Decode([]byte(`{"Name": 5}`), &r).(Errors)
+
+	if !ok || len(errs) != 1 || errs[0].Code != CodeInvalidType {
+		t.Errorf("Expected a single invalid_type error, got %v", errs)
+	}
+}
+
+func TestDecodeRejectsMalformedJSON(t *testing.T) {
+	var r request
+
+	err := Decode([]byte(`{"Name": `), &r)
+
+	if _, ok := err.(Errors); ok || err == nil {
+		t.Errorf("Expected a malformed JSON error, got %v", err)
+	}
+}
+
+func TestDecodeRejectsTrailingData(t *testing.T) {
+	for _, body := range []string{`{"Name": "ann"} {}`, `{"Name": "ann"}}`, `{"Name": "ann"} x`} {
+		var r request
+
+		err := Decode([]byte(body), &r)
+
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("Expected a syntax error for %q, got %v", body, err)
+		}
+	}
+
+	var r request
+	if err := Decode([]byte("{\"Name\": \"ann\"}\n"), &r); err != nil {
+		t.Errorf("Expected trailing whitespace to be accepted, got %v", err)
+	}
+}
+
+func TestDecodeExplainsMalformedJSON(t *testing.T) {
+	cases := map[string]string{
+		``:               "the body is empty",
+		`{"Name": "ann"`: "ends in the middle",
+		`[1, 2]`:         "expected an object, got array",
+		`null`:           "expected an object, got null",
+		`{"Name" "ann"}`: "after object key at offset 9",
+	}
+
+	for body, expected := range cases {
+		var r request
+
+		err := Decode([]byte(body), &r)
+
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to be reported for %q, got %v", expected, body, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Package web serves the Svelte frontend built into web/dist by
+// `npm run build` in frontend/, and embedded in the binary.
+package web
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"glog/httpcache"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// ErrNotBuilt is returned by New when the binary was built without the
+// frontend.
+var ErrNotBuilt = errors.New("web: the frontend was not built into this binary")
+
+// Cache policies of the files served. Vite puts fingerprinted files in
+// assets/, so they never change; index.html must be revalidated to pick up
+// a new build.
+const (
+	cacheImmutable = "public, max-age=31536000, immutable"
+	cacheIndex     = "no-cache"
+	cacheOther     = "public, max-age=3600"
+)
+
+// Types the frontend uses, set explicitly because the system MIME tables
+// mime falls back on differ between hosts.
+var contentTypes = map[string]string{
+	".css":         "text/css; charset=utf-8",
+	".html":        "text/html; charset=utf-8",
+	".ico":         "image/x-icon",
+	".js":          "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".map":         "application/json",
+	".mjs":         "text/javascript; charset=utf-8",
+	".png":         "image/png",
+	".svg":         "image/svg+xml",
+	".txt":         "text/plain; charset=utf-8",
+	".wasm":        "application/wasm",
+	".webmanifest": "application/manifest+json",
+	".webp":        "image/webp",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+}
+
+// RuntimeConfig is handed to the frontend as window.__GLOG_CONFIG__.
+type RuntimeConfig struct {
+	APIBaseURL string `json:"apiBaseUrl"`
+	Tenant     string `json:"tenant"`
+}
+
+// Frontend serves the embedded single page app. Paths that are not files
+// get index.html, so the app's own router handles them.
+type Frontend struct {
+	files fs.FS
+	index []byte
+	// Config returns the runtime config of a request, such as the tenant
+	// the host it was sent to belongs to.
+	Config func(r *http.Request) RuntimeConfig
+	// Reserved are the path prefixes of the API, which Serves leaves to
+	// other routes even when none of them matches.
+	Reserved []string
+}
+
+// New returns the embedded frontend, or ErrNotBuilt.
+func New(config func(r *http.Request) RuntimeConfig) (*Frontend, error) {
+	files, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, err
+	}
+
+	return newFrontend(files, config)
+}
+
+func newFrontend(files fs.FS, config func(r *http.Request) RuntimeConfig) (*Frontend, error) {
+	index, err := fs.ReadFile(files, "index.html")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotBuilt
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Frontend{files: files, index: index, Config: config}, nil
+}
+
+// Serves reports whether r is for the app, that is outside the Reserved
+// prefixes. It is a mux.MatcherFunc, so a mistyped API path is answered by
+// the router rather than with index.html.
+func (f *Frontend) Serves(r *http.Request, _ *mux.RouteMatch) bool {
+	p := path.Clean("/" + r.URL.Path)
+	for _, prefix := range f.Reserved {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f *Frontend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+	if name == "" || name == "index.html" {
+		f.serveIndex(w, r)
+		return
+	}
+
+	b, err := fs.ReadFile(f.files, name)
+	if err != nil {
+		// A missing file with an extension is a broken link to an asset,
+		// not a route of the app.
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		f.serveIndex(w, r)
+		return
+	}
+
+	cacheControl := cacheOther
+	if strings.HasPrefix(name, "assets/") {
+		cacheControl = cacheImmutable
+	}
+
+	f.serve(w, r, name, b, cacheControl)
+}
+
+// serveIndex serves index.html with the runtime config of r injected before
+// </head>. json.Marshal escapes <, > and &, so the config cannot close the
+// script element.
+func (f *Frontend) serveIndex(w http.ResponseWriter, r *http.Request) {
+	var cfg RuntimeConfig
+	if f.Config != nil {
+		cfg = f.Config(r)
+	}
+
+	encoded, err := json.Marshal(cfg)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	script := []byte("<script>window.__GLOG_CONFIG__ = " + string(encoded) + ";</script>\n")
+
+	page := f.index
+	if i := bytes.Index(page, []byte("</head>")); i >= 0 {
+		page = append(append(append([]byte(nil), page[:i]...), script...), page[i:]...)
+	} else {
+		page = append(script, page...)
+	}
+
+	f.serve(w, r, "index.html", page, cacheIndex)
+}
+
+func (f *Frontend) serve(w http.ResponseWriter, r *http.Request, name string, b []byte, cacheControl string) {
+	h := w.Header()
+	h.Set("Content-Type", contentType(name, b))
+	h.Set("Cache-Control", cacheControl)
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	if httpcache.NotModified(w, r, httpcache.Validators{ETag: httpcache.ETag(string(b))}) {
+		return
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		w.Write(b)
+	}
+}
+
+func contentType(name string, b []byte) string {
+	ext := strings.ToLower(path.Ext(name))
+
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+
+	return http.DetectContentType(b)
+}
@@ -0,0 +1,132 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"glog/responsehandler"
+
+	"github.com/gorilla/mux"
+)
+
+var files = fstest.MapFS{
+	"index.html":           {Data: []byte("<html><head><title>glog</title></head><body></body></html>")},
+	"assets/index-1a2b.js": {Data: []byte("console.log('glog')")},
+	"vite.svg":             {Data: []byte("<svg></svg>")},
+}
+
+func get(t *testing.T, path string, host string) *httptest.ResponseRecorder {
+	f, err := newFrontend(files, func(r *http.Request) RuntimeConfig {
+		tenant := "default"
+		if r.Host == "acme.example.com" {
+			tenant = "acme"
+		}
+
+		return RuntimeConfig{APIBaseURL: "/api", Tenant: tenant}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Host = host
+
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, r)
+	return w
+}
+
+func TestServesAssets(t *testing.T) {
+	w := get(t, "/assets/index-1a2b.js", "example.com")
+
+	if w.Code != http.StatusOK || w.Body.String() != "console.log('glog')" {
+		t.Fatalf("Expected the asset, got %d %q", w.Code, w.Body.String())
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "text/javascript; charset=utf-8" {
+		t.Errorf("Expected a JavaScript type, got %q", got)
+	}
+
+	if got := w.Header().Get("Cache-Control"); got != cacheImmutable {
+		t.Errorf("Expected hashed assets to be immutable, got %q", got)
+	}
+
+	if got := get(t, "/vite.svg", "example.com").Header().Get("Cache-Control"); got != cacheOther {
+		t.Errorf("Expected unhashed files to be revalidated, got %q", got)
+	}
+}
+
+func TestHistoryFallback(t *testing.T) {
+	w := get(t, "/posts/hello-world", "acme.example.com")
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("Expected index.html for an app route, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	expected := `<script>window.__GLOG_CONFIG__ = {"apiBaseUrl":"/api","tenant":"acme"};</script>` + "\n</head>"
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected runtime config before </head>, got %s", w.Body.String())
+	}
+
+	if got := w.Header().Get("Cache-Control"); got != cacheIndex {
+		t.Errorf("Expected index.html to be revalidated, got %q", got)
+	}
+
+	if w := get(t, "/assets/missing.js", "example.com"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing asset to be 404, got %d", w.Code)
+	}
+}
+
+func TestNotBuilt(t *testing.T) {
+	if _, err := newFrontend(fstest.MapFS{".gitkeep": {}}, nil); err != ErrNotBuilt {
+		t.Errorf("Expected ErrNotBuilt, got %v", err)
+	}
+}
+
+func TestAPIPathsAreNotServedTheApp(t *testing.T) {
+	f, err := newFrontend(files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Reserved = []string{"/tenant", "/admin"}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/tenant/{tenantID}/posts", ok).Methods(http.MethodGet, http.MethodPost)
+	router.PathPrefix("/").MatcherFunc(f.Serves).Methods(http.MethodGet, http.MethodHead).Handler(f)
+	router.NotFoundHandler = http.HandlerFunc(responsehandler.RouteNotFound)
+	router.MethodNotAllowedHandler = responsehandler.MethodNotAllowed(router)
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{http.MethodGet, "/tenant/acme/postz", http.StatusNotFound, ""},
+		{http.MethodGet, "/admin", http.StatusNotFound, ""},
+		{http.MethodDelete, "/tenant/acme/posts", http.StatusMethodNotAllowed, "GET, POST"},
+		{http.MethodPost, "/posts/hello-world", http.StatusMethodNotAllowed, "GET, HEAD"},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+
+		if w.Code != tc.status || w.Header().Get("Content-Type") != responsehandler.ProblemContentType {
+			t.Errorf("Expected %s %s to be a %d problem, got %d %q", tc.method, tc.path, tc.status, w.Code, w.Header().Get("Content-Type"))
+		}
+
+		if got := w.Header().Get("Allow"); got != tc.allow {
+			t.Errorf("Expected %s %s to allow %q, got %q", tc.method, tc.path, tc.allow, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/administrators", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<title>glog</title>") {
+		t.Errorf("Expected app routes sharing a prefix with the API to get index.html, got %d", w.Code)
+	}
+}